@@ -27,7 +27,11 @@ func init() {
 		SetRedirectPolicy(resty.FlexibleRedirectPolicy(2))
 }
 
-var Host = core.GetApp().Host() + "/api/ssr/v1"
+// Host is the base url of ProxyPanel ssr api, api_host is used if it is empty
+var Host string
+
+// IdempotencyHeader carry the key of traffic report, panel can drop the report it already received
+const IdempotencyHeader = "Idempotency-Key"
 
 // implement for vnet api get request
 func get(url string) (result string, err error) {
@@ -51,6 +55,11 @@ func get(url string) (result string, err error) {
 }
 
 func post(url, param string) (result string, err error) {
+	return postWithHeader(url, param, nil)
+}
+
+// postWithHeader post with extra headers
+func postWithHeader(url, param string, extraHeader map[string]string) (result string, err error) {
 	logrus.WithFields(logrus.Fields{
 		"param": param,
 		"url":   url,
@@ -60,6 +69,9 @@ func post(url, param string) (result string, err error) {
 		"timestamp":    strconv.FormatInt(time.Now().Unix(), 10),
 		"Content-Type": "application/json",
 	}
+	for key, value := range extraHeader {
+		header[key] = value
+	}
 	r, err := restyc.R().SetHeaders(header).SetBody(param).Post(url)
 	if err != nil {
 		return "", errors.Wrap(err, "get request error")
@@ -71,11 +83,49 @@ func post(url, param string) (result string, err error) {
 	return responseJson, nil
 }
 
+// request send the request with query parameters and json body for other panels,
+// the body is returned if status is 200
+func request(method, url string, query map[string]string, body interface{}) ([]byte, error) {
+	return requestWithHeader(method, url, query, nil, body)
+}
+
+// requestWithHeader send the request with extra headers
+func requestWithHeader(method, url string, query, header map[string]string, body interface{}) ([]byte, error) {
+	logrus.WithFields(logrus.Fields{
+		"method": method,
+		"url":    url,
+		"body":   fmt.Sprintf("%+v", body),
+	}).Debug("request")
+	req := restyc.R().SetQueryParams(query).SetHeaders(header)
+	if body != nil {
+		req.SetHeader("Content-Type", "application/json").SetBody(body)
+	}
+	r, err := req.Execute(method, url)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("%s request error", method))
+	}
+	if r.StatusCode() != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("%s request status: %d body: %s", method, r.StatusCode(), string(r.Body())))
+	}
+	return r.Body(), nil
+}
+
 /*------------------------------ code below is webapi implement ------------------------------*/
 
+// ProxyPanel is the adapter of ProxyPanel web api
+type ProxyPanel struct{}
+
+// baseURL return Host if it is set, otherwise the ssr api of api_host
+func (w *ProxyPanel) baseURL() string {
+	if Host != "" {
+		return Host
+	}
+	return core.GetApp().ApiHost() + "/api/ssr/v1"
+}
+
 // GetNodeInfo Get Node Info
-func GetNodeInfo() (*model.NodeInfo, error) {
-	response, err := get(fmt.Sprintf("%s/node/%s", Host, strconv.Itoa(core.GetApp().NodeId())))
+func (w *ProxyPanel) GetNodeInfo() (*model.NodeInfo, error) {
+	response, err := get(fmt.Sprintf("%s/node/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())))
 	if err != nil {
 		return nil, err
 	}
@@ -96,8 +146,8 @@ func GetNodeInfo() (*model.NodeInfo, error) {
 }
 
 // GetUserList Get User List
-func GetUserList() ([]*model.UserInfo, error) {
-	response, err := get(fmt.Sprintf("%s/userList/%s", Host, strconv.Itoa(core.GetApp().NodeId())))
+func (w *ProxyPanel) GetUserList() ([]*model.UserInfo, error) {
+	response, err := get(fmt.Sprintf("%s/userList/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())))
 	if err != nil {
 		return nil, err
 	}
@@ -116,11 +166,11 @@ func GetUserList() ([]*model.UserInfo, error) {
 	return result, nil
 }
 
-func PostAllUserTraffic(allUserTraffic []*model.UserTraffic) error {
-	value, err := post(fmt.Sprintf("%s/userTraffic/%s", Host, strconv.Itoa(core.GetApp().NodeId())),
+func (w *ProxyPanel) PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	value, err := postWithHeader(fmt.Sprintf("%s/userTraffic/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())),
 		string(langx.Must(func() (interface{}, error) {
 			return json.Marshal(allUserTraffic)
-		}).([]byte)))
+		}).([]byte)), map[string]string{IdempotencyHeader: key})
 
 	if err != nil {
 		return err
@@ -131,8 +181,8 @@ func PostAllUserTraffic(allUserTraffic []*model.UserTraffic) error {
 	return nil
 }
 
-func PostNodeOnline(nodeOnline []*model.NodeOnline) error {
-	value, err := post(fmt.Sprintf("%s/nodeOnline/%s", Host, strconv.Itoa(core.GetApp().NodeId())),
+func (w *ProxyPanel) PostNodeOnline(nodeOnline []*model.NodeOnline) error {
+	value, err := post(fmt.Sprintf("%s/nodeOnline/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())),
 		string(langx.Must(func() (interface{}, error) {
 			return json.Marshal(nodeOnline)
 		}).([]byte)))
@@ -147,8 +197,8 @@ func PostNodeOnline(nodeOnline []*model.NodeOnline) error {
 	return nil
 }
 
-func PostNodeStatus(status model.NodeStatus) error {
-	value, err := post(fmt.Sprintf("%s/nodeStatus/%s", Host, strconv.Itoa(core.GetApp().NodeId())),
+func (w *ProxyPanel) PostNodeStatus(status model.NodeStatus) error {
+	value, err := post(fmt.Sprintf("%s/nodeStatus/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())),
 		string(langx.Must(func() (interface{}, error) {
 			return json.Marshal(status)
 		}).([]byte)))
@@ -163,8 +213,8 @@ func PostNodeStatus(status model.NodeStatus) error {
 }
 
 // PostTrigger when user trigger audit rules then report
-func PostTrigger(trigger model.Trigger) error {
-	value, err := post(fmt.Sprintf("%s/trigger/%s", Host, strconv.Itoa(core.GetApp().NodeId())),
+func (w *ProxyPanel) PostTrigger(trigger model.Trigger) error {
+	value, err := post(fmt.Sprintf("%s/trigger/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())),
 		string(langx.Must(func() (interface{}, error) {
 			return json.Marshal(trigger)
 		}).([]byte)))
@@ -179,8 +229,8 @@ func PostTrigger(trigger model.Trigger) error {
 }
 
 // GetNodeRule Get Node Rule
-func GetNodeRule() (*model.Rule, error) {
-	response, err := get(fmt.Sprintf("%s/nodeRule/%s", Host, strconv.Itoa(core.GetApp().NodeId())))
+func (w *ProxyPanel) GetNodeRule() (*model.Rule, error) {
+	response, err := get(fmt.Sprintf("%s/nodeRule/%s", w.baseURL(), strconv.Itoa(core.GetApp().NodeId())))
 	if err != nil {
 		return nil, err
 	}
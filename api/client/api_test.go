@@ -27,9 +27,9 @@ func ExampleGetUserList() {
 func ExamplePostAllUserTraffic() {
 	Host = "http://localhost"
 	logrus.SetLevel(logrus.DebugLevel)
-	PostAllUserTraffic([]*model.UserTraffic{
+	PostAllUserTraffic("key", []*model.UserTraffic{
 		{
-			1, 200, 200, 0, 0,
+			Uid: 1, Upload: 200, Download: 200,
 		},
 	})
 	//Output:
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// watchDelay merge the events of one save, editors may write file several times
+const watchDelay = 200 * time.Millisecond
+
+// FileConfig is the content of the standalone file, in json or yaml
+type FileConfig struct {
+	Node  *model.NodeInfo   `json:"node"`
+	Users []*model.UserInfo `json:"users"`
+	Rule  *model.Rule       `json:"rule"`
+}
+
+// FileProvider read node info, users and rules from local file instead of web api,
+// reports are appended to report file as json lines
+type FileProvider struct {
+	sync.RWMutex
+	path       string
+	reportPath string
+	config     *FileConfig
+	reportLock sync.Mutex
+	watcher    *fsnotify.Watcher
+}
+
+func NewFileProvider(path, reportPath string) (*FileProvider, error) {
+	f := &FileProvider{
+		path:       path,
+		reportPath: reportPath,
+	}
+	if err := f.Load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load read the file again, json is used unless extension is .yaml or .yml
+func (f *FileProvider) Load() error {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return errors.Wrap(err, "read standalone file error")
+	}
+	ext := strings.ToLower(filepath.Ext(f.path))
+	if ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return errors.Wrap(err, "parse standalone yaml file error")
+		}
+	}
+	config := new(FileConfig)
+	if err := json.Unmarshal(data, config); err != nil {
+		return errors.Wrap(err, "parse standalone file error")
+	}
+	if config.Node == nil {
+		return errors.New("standalone file miss node")
+	}
+	if config.Rule == nil {
+		config.Rule = &model.Rule{Model: "all"}
+	}
+	f.Lock()
+	f.config = config
+	f.Unlock()
+	return nil
+}
+
+// Watch reload the file when it changed, and call onChange after reload success
+func (f *FileProvider) Watch(onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory, because editors may replace the file by rename
+	if err := watcher.Add(filepath.Dir(f.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	f.watcher = watcher
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(f.path) ||
+					event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(watchDelay, func() {
+					if err := f.Load(); err != nil {
+						logrus.WithFields(logrus.Fields{
+							"path": f.path,
+							"err":  err,
+						}).Error("reload standalone file error")
+						return
+					}
+					logrus.WithFields(logrus.Fields{
+						"path": f.path,
+					}).Info("standalone file reloaded")
+					if onChange != nil {
+						onChange()
+					}
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("watch standalone file error %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (f *FileProvider) Close() error {
+	if f.watcher == nil {
+		return nil
+	}
+	return f.watcher.Close()
+}
+
+func (f *FileProvider) GetNodeInfo() (*model.NodeInfo, error) {
+	f.RLock()
+	defer f.RUnlock()
+	nodeInfo := *f.config.Node
+	return &nodeInfo, nil
+}
+
+func (f *FileProvider) GetUserList() ([]*model.UserInfo, error) {
+	f.RLock()
+	defer f.RUnlock()
+	result := make([]*model.UserInfo, 0, len(f.config.Users))
+	for _, user := range f.config.Users {
+		userInfo := *user
+		result = append(result, &userInfo)
+	}
+	return result, nil
+}
+
+func (f *FileProvider) GetNodeRule() (*model.Rule, error) {
+	f.RLock()
+	defer f.RUnlock()
+	rule := *f.config.Rule
+	rule.Rules = append([]model.RuleItem(nil), f.config.Rule.Rules...)
+	return &rule, nil
+}
+
+func (f *FileProvider) PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	return f.report("traffic", struct {
+		Key     string               `json:"key"`
+		Traffic []*model.UserTraffic `json:"traffic"`
+	}{key, allUserTraffic})
+}
+
+func (f *FileProvider) PostNodeOnline(nodeOnline []*model.NodeOnline) error {
+	return f.report("online", nodeOnline)
+}
+
+func (f *FileProvider) PostNodeStatus(status model.NodeStatus) error {
+	return f.report("status", status)
+}
+
+func (f *FileProvider) PostTrigger(trigger model.Trigger) error {
+	return f.report("trigger", trigger)
+}
+
+// report append a json line {"time": ..., "type": ..., "data": ...} to report file
+func (f *FileProvider) report(reportType string, data interface{}) error {
+	if f.reportPath == "" {
+		logrus.WithFields(logrus.Fields{
+			"type": reportType,
+			"data": fmt.Sprintf("%+v", data),
+		}).Debug("standalone report is dropped because report file is empty")
+		return nil
+	}
+	line, err := json.Marshal(struct {
+		Time string      `json:"time"`
+		Type string      `json:"type"`
+		Data interface{} `json:"data"`
+	}{
+		Time: time.Now().Format(time.RFC3339),
+		Type: reportType,
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+	f.reportLock.Lock()
+	defer f.reportLock.Unlock()
+	file, err := os.OpenFile(f.reportPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open report file error")
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// yamlToJSON convert yaml to json, so the json tags of model are reused
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(convertYAML(value))
+}
+
+func convertYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = convertYAML(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
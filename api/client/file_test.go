@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+const standaloneYAML = `
+node:
+  id: 1
+  port: "0"
+  method: aes-256-cfb
+  protocol: origin
+  obfs: plain
+  single: 0
+users:
+  - uid: 1
+    port: 10001
+    passwd: pass1
+    speed_limit: 1024
+rule:
+  mode: reject
+  rules:
+    - id: 2
+      type: domain
+      pattern: example.com
+`
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "standalone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "standalone.yaml")
+	reportPath := filepath.Join(dir, "report.log")
+	if err := ioutil.WriteFile(path, []byte(standaloneYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewFileProvider(path, reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeInfo, _ := provider.GetNodeInfo()
+	if nodeInfo.Method != "aes-256-cfb" || nodeInfo.Protocol != "origin" {
+		t.Fatalf("GetNodeInfo() = %+v", nodeInfo)
+	}
+	users, _ := provider.GetUserList()
+	if len(users) != 1 || users[0].Port != 10001 || users[0].Limit != 1024 {
+		t.Fatalf("GetUserList() = %+v", users)
+	}
+	rule, _ := provider.GetNodeRule()
+	if rule.Model != "reject" || len(rule.Rules) != 1 || rule.Rules[0].Pattern != "example.com" {
+		t.Fatalf("GetNodeRule() = %+v", rule)
+	}
+
+	changed := make(chan struct{}, 1)
+	if err := provider.Watch(func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+	data, _ := json.Marshal(FileConfig{
+		Node:  nodeInfo,
+		Users: append(users, &model.UserInfo{Uid: 2, Port: 10002, Passwd: "pass2"}),
+	})
+	jsonPath := filepath.Join(dir, "standalone.json")
+	if err := ioutil.WriteFile(jsonPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// json content in yaml file is also valid
+	if err := os.Rename(jsonPath, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change is not watched")
+	}
+	if users, _ = provider.GetUserList(); len(users) != 2 {
+		t.Fatalf("GetUserList() after change = %+v", users)
+	}
+	if rule, _ = provider.GetNodeRule(); rule.Model != "all" {
+		t.Fatalf("GetNodeRule() default mode = %v", rule.Model)
+	}
+
+	if err := provider.PostAllUserTraffic("key", []*model.UserTraffic{{Uid: 1, Upload: 100, Download: 200}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.PostNodeOnline([]*model.NodeOnline{{Uid: 1, IP: "127.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var types []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, line.Type)
+	}
+	if len(types) != 2 || types[0] != "traffic" || types[1] != "online" {
+		t.Fatalf("report types = %v", types)
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	PanelTypeProxyPanel = "proxypanel"
+	PanelTypeSSPanel    = "sspanel"
+	PanelTypeV2Board    = "v2board"
+)
+
+// PanelClient supply node info, users and rules to the node, and receive its reports
+type PanelClient interface {
+	GetNodeInfo() (*model.NodeInfo, error)
+	GetUserList() ([]*model.UserInfo, error)
+	GetNodeRule() (*model.Rule, error)
+	// PostAllUserTraffic report traffic with the idempotency key, the key is same when the report is retried
+	PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error
+	PostNodeOnline(nodeOnline []*model.NodeOnline) error
+	PostNodeStatus(status model.NodeStatus) error
+	PostTrigger(trigger model.Trigger) error
+}
+
+var (
+	panelClient     PanelClient = new(ProxyPanel)
+	panelClientLock sync.RWMutex
+)
+
+// NewPanelClient create the adapter of panel type, api host, node id and key are read from core.App
+func NewPanelClient(panelType string) (PanelClient, error) {
+	switch strings.ToLower(panelType) {
+	case "", PanelTypeProxyPanel:
+		return new(ProxyPanel), nil
+	case PanelTypeSSPanel:
+		return new(SSPanel), nil
+	case PanelTypeV2Board:
+		return new(V2Board), nil
+	}
+	return nil, errors.Errorf("unknown panel type %s", panelType)
+}
+
+// SetPanelClient replace the panel client, default is ProxyPanel
+func SetPanelClient(p PanelClient) {
+	panelClientLock.Lock()
+	defer panelClientLock.Unlock()
+	panelClient = p
+}
+
+func GetPanelClient() PanelClient {
+	panelClientLock.RLock()
+	defer panelClientLock.RUnlock()
+	return panelClient
+}
+
+// GetNodeInfo Get Node Info
+func GetNodeInfo() (*model.NodeInfo, error) {
+	return GetPanelClient().GetNodeInfo()
+}
+
+// GetUserList Get User List
+func GetUserList() ([]*model.UserInfo, error) {
+	return GetPanelClient().GetUserList()
+}
+
+// GetNodeRule Get Node Rule
+func GetNodeRule() (*model.Rule, error) {
+	return GetPanelClient().GetNodeRule()
+}
+
+func PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	return GetPanelClient().PostAllUserTraffic(key, allUserTraffic)
+}
+
+func PostNodeOnline(nodeOnline []*model.NodeOnline) error {
+	return GetPanelClient().PostNodeOnline(nodeOnline)
+}
+
+func PostNodeStatus(status model.NodeStatus) error {
+	return GetPanelClient().PostNodeStatus(status)
+}
+
+// PostTrigger when user trigger audit rules then report
+func PostTrigger(trigger model.Trigger) error {
+	return GetPanelClient().PostTrigger(trigger)
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+// panelServer replies the body of "METHOD path" and record the request body
+func panelServer(t *testing.T, replies map[string]string, bodies map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		reply, ok := replies[key]
+		if !ok {
+			t.Errorf("unexpected request %s", key)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("node_id") != "3" {
+			t.Errorf("%s miss node_id", key)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies[key] = string(body)
+		bodies[key+" "+IdempotencyHeader] = r.Header.Get(IdempotencyHeader)
+		_, _ = w.Write([]byte(reply))
+	}))
+}
+
+func TestNewPanelClient(t *testing.T) {
+	for panelType, want := range map[string]string{
+		"":           "*client.ProxyPanel",
+		"ProxyPanel": "*client.ProxyPanel",
+		"sspanel":    "*client.SSPanel",
+		"v2board":    "*client.V2Board",
+	} {
+		got, err := NewPanelClient(panelType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotType := fmt.Sprintf("%T", got); gotType != want {
+			t.Fatalf("NewPanelClient(%q) = %s, want %s", panelType, gotType, want)
+		}
+	}
+	if _, err := NewPanelClient("unknown"); err == nil {
+		t.Fatal("NewPanelClient(unknown) should fail")
+	}
+}
+
+func TestSSPanel(t *testing.T) {
+	bodies := make(map[string]string)
+	server := panelServer(t, map[string]string{
+		"GET /mod_mu/nodes/3/info":      `{"ret":1,"data":{"node_speedlimit":8,"mu_only":1,"custom_config":{"port":"443","method":"aes-256-cfb","protocol":"auth_aes128_md5","obfs":"plain"}}}`,
+		"GET /mod_mu/users":             `{"ret":1,"data":[{"id":1,"port":1025,"passwd":"pass","node_speedlimit":0}]}`,
+		"GET /mod_mu/func/detect_rules": `{"ret":1,"data":[{"id":5,"regex":"(.*)bad\\.com"}]}`,
+		"POST /mod_mu/users/traffic":    `{"ret":1,"data":"ok"}`,
+		"POST /mod_mu/users/aliveip":    `{"ret":1,"data":"ok"}`,
+		"POST /mod_mu/users/detectlog":  `{"ret":0,"data":"error"}`,
+	}, bodies)
+	defer server.Close()
+	core.GetApp().SetApiHost(server.URL)
+	core.GetApp().SetNodeId(3)
+
+	panel := new(SSPanel)
+	nodeInfo, err := panel.GetNodeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeInfo.Single != 1 || nodeInfo.Port != "443" || nodeInfo.Protocol != "auth_aes128_md5" || nodeInfo.SpeedLimit != 1000000 {
+		t.Fatalf("GetNodeInfo() = %+v", nodeInfo)
+	}
+	users, err := panel.GetUserList()
+	if err != nil || len(users) != 1 || users[0].Uid != 1 || users[0].Port != 1025 {
+		t.Fatalf("GetUserList() = %+v, %v", users, err)
+	}
+	rule, err := panel.GetNodeRule()
+	if err != nil || rule.Model != "reject" || rule.Rules[0].Type != "reg" || rule.Rules[0].Id != 5 {
+		t.Fatalf("GetNodeRule() = %+v, %v", rule, err)
+	}
+	if err := panel.PostAllUserTraffic("key-1", []*model.UserTraffic{{Uid: 1, Upload: 10, Download: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":[{"d":20,"u":10,"user_id":1}]}`; bodies["POST /mod_mu/users/traffic"] != want {
+		t.Fatalf("traffic body = %s, want %s", bodies["POST /mod_mu/users/traffic"], want)
+	}
+	if key := bodies["POST /mod_mu/users/traffic "+IdempotencyHeader]; key != "key-1" {
+		t.Fatalf("traffic idempotency key = %s, want key-1", key)
+	}
+	if err := panel.PostNodeOnline([]*model.NodeOnline{{Uid: 1, IP: "1.1.1.1,2.2.2.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":[{"ip":"1.1.1.1","user_id":1},{"ip":"2.2.2.2","user_id":1}]}`; bodies["POST /mod_mu/users/aliveip"] != want {
+		t.Fatalf("online body = %s, want %s", bodies["POST /mod_mu/users/aliveip"], want)
+	}
+	if err := panel.PostTrigger(model.Trigger{Uid: 1, RuleId: 5}); err == nil {
+		t.Fatal("PostTrigger() should fail when ret is 0")
+	}
+}
+
+func TestV2Board(t *testing.T) {
+	bodies := make(map[string]string)
+	server := panelServer(t, map[string]string{
+		"GET /api/v1/server/UniProxy/config": `{"server_port":8388,"cipher":"2022-blake3-aes-128-gcm","server_key":"AAAAAAAAAAAAAAAAAAAAAA==","obfs":"http","obfs_settings":{"host":"example.com"},"routes":[{"id":2,"match":["regexp:.*\\.bad\\.com","bad.org"],"action":"block"},{"id":3,"match":"good.com","action":"dns"}]}`,
+		"GET /api/v1/server/UniProxy/user":   `{"users":[{"id":7,"uuid":"2f5a3e1c-7b8d-4c2a-9e6f-0d1b2c3a4e5f","speed_limit":16}]}`,
+		"POST /api/v1/server/UniProxy/push":  `{"data":true}`,
+		"POST /api/v1/server/UniProxy/alive": `{"data":true}`,
+	}, bodies)
+	defer server.Close()
+	core.GetApp().SetApiHost(server.URL)
+	core.GetApp().SetNodeId(3)
+
+	panel := new(V2Board)
+	nodeInfo, err := panel.GetNodeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeInfo.Port != "8388" || nodeInfo.Method != "2022-blake3-aes-128-gcm" || nodeInfo.Obfs != "http_simple" || nodeInfo.ObfsParam != "example.com" {
+		t.Fatalf("GetNodeInfo() = %+v", nodeInfo)
+	}
+	users, err := panel.GetUserList()
+	if err != nil || len(users) != 1 || users[0].Uid != 7 || users[0].Passwd != base64.StdEncoding.EncodeToString([]byte("2f5a3e1c-7b8d-4c")) || users[0].Limit != 2000000 {
+		t.Fatalf("GetUserList() = %+v, %v", users, err)
+	}
+	rule, err := panel.GetNodeRule()
+	if err != nil || rule.Model != "reject" || len(rule.Rules) != 2 ||
+		rule.Rules[0].Type != "reg" || rule.Rules[0].Pattern != `.*\.bad\.com` || rule.Rules[1].Type != "domain" {
+		t.Fatalf("GetNodeRule() = %+v, %v", rule, err)
+	}
+	if err := panel.PostAllUserTraffic("key-7", []*model.UserTraffic{{Uid: 7, Upload: 10, Download: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"7":[10,20]}`; bodies["POST /api/v1/server/UniProxy/push"] != want {
+		t.Fatalf("traffic body = %s, want %s", bodies["POST /api/v1/server/UniProxy/push"], want)
+	}
+	if key := bodies["POST /api/v1/server/UniProxy/push "+IdempotencyHeader]; key != "key-7" {
+		t.Fatalf("traffic idempotency key = %s, want key-7", key)
+	}
+	if err := panel.PostNodeOnline([]*model.NodeOnline{{Uid: 7, IP: "1.1.1.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"7":["1.1.1.1"]}`; bodies["POST /api/v1/server/UniProxy/alive"] != want {
+		t.Fatalf("online body = %s, want %s", bodies["POST /api/v1/server/UniProxy/alive"], want)
+	}
+
+	// cipher without identity header can not identify users
+	for _, cipher := range []string{"aes-128-gcm", "2022-blake3-chacha20-poly1305"} {
+		server := panelServer(t, map[string]string{
+			"GET /api/v1/server/UniProxy/config": `{"server_port":8388,"cipher":"` + cipher + `"}`,
+			"GET /api/v1/server/UniProxy/user":   `{"users":[]}`,
+		}, bodies)
+		core.GetApp().SetApiHost(server.URL)
+		if _, err := panel.GetNodeInfo(); err == nil {
+			t.Errorf("GetNodeInfo() with %s should fail", cipher)
+		}
+		if _, err := panel.GetUserList(); err == nil {
+			t.Errorf("GetUserList() with %s should fail", cipher)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// SSPanel is the adapter of SSPanel-UIM mod_mu api, the ssr parameters of node
+// are read from custom_config, its speed limit is Mbps
+type SSPanel struct{}
+
+type ssPanelNode struct {
+	SpeedLimit   float64 `json:"node_speedlimit"`
+	MuOnly       int     `json:"mu_only"`
+	CustomConfig struct {
+		Port          string `json:"port"`
+		Passwd        string `json:"passwd"`
+		Method        string `json:"method"`
+		Protocol      string `json:"protocol"`
+		ProtocolParam string `json:"protocol_param"`
+		Obfs          string `json:"obfs"`
+		ObfsParam     string `json:"obfs_param"`
+		Redirect      string `json:"redirect"`
+	} `json:"custom_config"`
+}
+
+type ssPanelUser struct {
+	ID             int     `json:"id"`
+	Port           int     `json:"port"`
+	Passwd         string  `json:"passwd"`
+	SpeedLimit     float64 `json:"node_speedlimit"`
+	Upload         int64   `json:"u"`
+	Download       int64   `json:"d"`
+	TransferEnable int64   `json:"transfer_enable"`
+	IPLimit        int     `json:"node_iplimit"`
+}
+
+type ssPanelRule struct {
+	ID    int    `json:"id"`
+	Regex string `json:"regex"`
+}
+
+func (s *SSPanel) url(path string) string {
+	return fmt.Sprintf("%s/mod_mu/%s", strings.TrimRight(core.GetApp().ApiHost(), "/"), path)
+}
+
+func (s *SSPanel) query() map[string]string {
+	return map[string]string{
+		"key":     core.GetApp().Key(),
+		"node_id": strconv.Itoa(core.GetApp().NodeId()),
+	}
+}
+
+// call send request and return the data of {"ret": 1, "data": ...} envelope
+func (s *SSPanel) call(method, path string, body interface{}) (string, error) {
+	response, err := request(method, s.url(path), s.query(), body)
+	if err != nil {
+		return "", err
+	}
+	if gjson.GetBytes(response, "ret").Int() != 1 {
+		return "", errors.New("sspanel response error: " + string(response))
+	}
+	return gjson.GetBytes(response, "data").Raw, nil
+}
+
+// mbpsToBytes convert the Mbps speed limit to bytes per second
+func mbpsToBytes(mbps float64) uint64 {
+	return uint64(mbps * 1000000 / 8)
+}
+
+func (s *SSPanel) GetNodeInfo() (*model.NodeInfo, error) {
+	data, err := s.call(http.MethodGet, fmt.Sprintf("nodes/%v/info", core.GetApp().NodeId()), nil)
+	if err != nil {
+		return nil, err
+	}
+	node := new(ssPanelNode)
+	if err := json.Unmarshal([]byte(data), node); err != nil {
+		return nil, err
+	}
+	config := node.CustomConfig
+	result := &model.NodeInfo{
+		ID:            core.GetApp().NodeId(),
+		Port:          config.Port,
+		Passwd:        config.Passwd,
+		Method:        config.Method,
+		Protocol:      config.Protocol,
+		ProtocolParam: config.ProtocolParam,
+		Obfs:          config.Obfs,
+		ObfsParam:     config.ObfsParam,
+		Redirect:      config.Redirect,
+		SpeedLimit:    mbpsToBytes(node.SpeedLimit),
+		IsUDP:         1,
+	}
+	if node.MuOnly == 1 {
+		result.Single = 1
+	}
+	return result, nil
+}
+
+func (s *SSPanel) GetUserList() ([]*model.UserInfo, error) {
+	data, err := s.call(http.MethodGet, "users", nil)
+	if err != nil {
+		return nil, err
+	}
+	var users []*ssPanelUser
+	if err := json.Unmarshal([]byte(data), &users); err != nil {
+		return nil, err
+	}
+	result := make([]*model.UserInfo, 0, len(users))
+	for _, user := range users {
+		result = append(result, &model.UserInfo{
+			Uid:     user.ID,
+			Port:    user.Port,
+			Passwd:  user.Passwd,
+			Limit:   mbpsToBytes(user.SpeedLimit),
+			Enable:  1,
+			Quota:   user.TransferEnable,
+			Used:    user.Upload + user.Download,
+			IPLimit: user.IPLimit,
+		})
+	}
+	return result, nil
+}
+
+// GetNodeRule the detect rules of sspanel are regex black list
+func (s *SSPanel) GetNodeRule() (*model.Rule, error) {
+	data, err := s.call(http.MethodGet, "func/detect_rules", nil)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*ssPanelRule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, err
+	}
+	result := &model.Rule{Model: "all"}
+	for _, rule := range rules {
+		result.Model = "reject"
+		result.Rules = append(result.Rules, model.RuleItem{
+			Id:      rule.ID,
+			Type:    "reg",
+			Pattern: rule.Regex,
+		})
+	}
+	return result, nil
+}
+
+func (s *SSPanel) PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	data := make([]map[string]interface{}, 0, len(allUserTraffic))
+	for _, traffic := range allUserTraffic {
+		data = append(data, map[string]interface{}{
+			"user_id": traffic.Uid,
+			"u":       traffic.Upload,
+			"d":       traffic.Download,
+		})
+	}
+	response, err := requestWithHeader(http.MethodPost, s.url("users/traffic"), s.query(),
+		map[string]string{IdempotencyHeader: key}, map[string]interface{}{"data": data})
+	if err == nil && gjson.GetBytes(response, "ret").Int() != 1 {
+		err = errors.New("sspanel response error: " + string(response))
+	}
+	return err
+}
+
+func (s *SSPanel) PostNodeOnline(nodeOnline []*model.NodeOnline) error {
+	data := make([]map[string]interface{}, 0, len(nodeOnline))
+	for _, online := range nodeOnline {
+		for _, ip := range strings.Split(online.IP, ",") {
+			data = append(data, map[string]interface{}{
+				"user_id": online.Uid,
+				"ip":      ip,
+			})
+		}
+	}
+	_, err := s.call(http.MethodPost, "users/aliveip", map[string]interface{}{"data": data})
+	return err
+}
+
+func (s *SSPanel) PostNodeStatus(status model.NodeStatus) error {
+	_, err := s.call(http.MethodPost, fmt.Sprintf("nodes/%v/info", core.GetApp().NodeId()), map[string]interface{}{
+		"uptime": status.UPTIME,
+		"load":   fmt.Sprintf("cpu %s mem %s disk %s", status.CPU, status.MEM, status.DISK),
+	})
+	return err
+}
+
+// PostTrigger only rule trigger is reported, sspanel detect log has no other type
+func (s *SSPanel) PostTrigger(trigger model.Trigger) error {
+	if trigger.Type != "" && trigger.Type != model.TriggerTypeRule {
+		return nil
+	}
+	_, err := s.call(http.MethodPost, "users/detectlog", map[string]interface{}{
+		"data": []map[string]interface{}{{
+			"list_id": trigger.RuleId,
+			"user_id": trigger.Uid,
+		}},
+	})
+	return err
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// V2Board is the adapter of V2Board server/UniProxy api with shadowsocks node type.
+// shadowsocks node has no ssr protocol, so it runs in single port mode and users are
+// identified by the identity header of 2022-blake3-aes ciphers, server_key is the identity
+// psk and the first key size bytes of uuid is the user psk. other ciphers can not identify
+// users and are rejected. http obfs is mapped to http_simple. v2board has no status and trigger api
+type V2Board struct{}
+
+func (v *V2Board) url(path string) string {
+	return fmt.Sprintf("%s/api/v1/server/UniProxy/%s", strings.TrimRight(core.GetApp().ApiHost(), "/"), path)
+}
+
+func (v *V2Board) query() map[string]string {
+	return map[string]string{
+		"token":     core.GetApp().Key(),
+		"node_id":   strconv.Itoa(core.GetApp().NodeId()),
+		"node_type": "shadowsocks",
+	}
+}
+
+func (v *V2Board) GetNodeInfo() (*model.NodeInfo, error) {
+	response, err := request(http.MethodGet, v.url("config"), v.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	config := gjson.ParseBytes(response)
+	if _, err := v.keySize(config); err != nil {
+		return nil, err
+	}
+	result := &model.NodeInfo{
+		ID:       core.GetApp().NodeId(),
+		Port:     config.Get("server_port").String(),
+		Passwd:   config.Get("server_key").String(),
+		Method:   config.Get("cipher").String(),
+		Protocol: "origin",
+		Obfs:     "plain",
+		Single:   1,
+		IsUDP:    1,
+	}
+	if config.Get("obfs").String() == "http" {
+		result.Obfs = "http_simple"
+		result.ObfsParam = config.Get("obfs_settings.host").String()
+	}
+	return result, nil
+}
+
+// keySize return the psk size of node cipher, only the ciphers support identity header are allowed
+func (v *V2Board) keySize(config gjson.Result) (int, error) {
+	method := config.Get("cipher").String()
+	if aead2022.GetIdentityCipher(method) == nil {
+		return 0, errors.Errorf("v2board shadowsocks node with cipher %s can not identify users, use 2022-blake3-aes-128-gcm or 2022-blake3-aes-256-gcm", method)
+	}
+	return aead2022.GetAEAD2022Cipher(method).KeySize(), nil
+}
+
+func (v *V2Board) GetUserList() ([]*model.UserInfo, error) {
+	response, err := request(http.MethodGet, v.url("config"), v.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	keySize, err := v.keySize(gjson.ParseBytes(response))
+	if err != nil {
+		return nil, err
+	}
+	response, err = request(http.MethodGet, v.url("user"), v.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	users := gjson.GetBytes(response, "users").Array()
+	result := make([]*model.UserInfo, 0, len(users))
+	for _, user := range users {
+		uuid := user.Get("uuid").String()
+		if len(uuid) < keySize {
+			return nil, errors.Errorf("v2board user %v uuid is shorter than key size", user.Get("id").Int())
+		}
+		result = append(result, &model.UserInfo{
+			Uid: int(user.Get("id").Int()),
+			// user port is the uid in single port mode
+			Port:   int(user.Get("id").Int()),
+			Passwd: base64.StdEncoding.EncodeToString([]byte(uuid[:keySize])),
+			Limit:  mbpsToBytes(user.Get("speed_limit").Float()),
+			Enable: 1,
+		})
+	}
+	return result, nil
+}
+
+// GetNodeRule the block routes of node are the black list, match with
+// "regexp:" prefix is regex rule, others are domain rule
+func (v *V2Board) GetNodeRule() (*model.Rule, error) {
+	response, err := request(http.MethodGet, v.url("config"), v.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.Rule{Model: "all"}
+	for _, route := range gjson.GetBytes(response, "routes").Array() {
+		if route.Get("action").String() != "block" {
+			continue
+		}
+		var matches []string
+		if match := route.Get("match"); match.IsArray() {
+			for _, item := range match.Array() {
+				matches = append(matches, item.String())
+			}
+		} else {
+			matches = strings.Split(match.String(), ",")
+		}
+		for _, match := range matches {
+			item := model.RuleItem{Id: int(route.Get("id").Int()), Type: "domain", Pattern: match}
+			if strings.HasPrefix(match, "regexp:") {
+				item.Type = "reg"
+				item.Pattern = strings.TrimPrefix(match, "regexp:")
+			}
+			result.Model = "reject"
+			result.Rules = append(result.Rules, item)
+		}
+	}
+	return result, nil
+}
+
+func (v *V2Board) PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	data := make(map[string][]int64, len(allUserTraffic))
+	for _, traffic := range allUserTraffic {
+		data[strconv.Itoa(traffic.Uid)] = []int64{traffic.Upload, traffic.Download}
+	}
+	_, err := requestWithHeader(http.MethodPost, v.url("push"), v.query(), map[string]string{IdempotencyHeader: key}, data)
+	return err
+}
+
+func (v *V2Board) PostNodeOnline(nodeOnline []*model.NodeOnline) error {
+	data := make(map[string][]string, len(nodeOnline))
+	for _, online := range nodeOnline {
+		data[strconv.Itoa(online.Uid)] = strings.Split(online.IP, ",")
+	}
+	_, err := request(http.MethodPost, v.url("alive"), v.query(), data)
+	return err
+}
+
+func (v *V2Board) PostNodeStatus(status model.NodeStatus) error {
+	return nil
+}
+
+func (v *V2Board) PostTrigger(trigger model.Trigger) error {
+	return nil
+}
@@ -5,7 +5,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
-	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/model"
 	"github.com/ProxyPanel/VNet-SSR/service"
@@ -98,6 +98,20 @@ func StartServer(port int, s string) {
 	})
 }
 
+// StartMetricsServer expose /metrics on a separate port without secret check,
+// so the monitoring stack can scrape it directly
+func StartMetricsServer(port int) {
+	addr := fmt.Sprintf(":%v", port)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	log.Info("start metrics server on %s", addr)
+	go goroutine.Protect(func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			panic(err)
+		}
+	})
+}
+
 func StopServer() {
 	httpServerMutex.Lock()
 	defer httpServerMutex.Unlock()
@@ -112,6 +126,7 @@ func InitRouter() *gin.Engine {
 	r := gin.Default()
 	r.Use(detailLog())
 	r.Use(secretCheck())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	r1 := r.Group("/api")
 	{
 		r1.POST("/user/add", UserAdd)
@@ -124,6 +139,9 @@ func InitRouter() *gin.Engine {
 		r2.POST("/user/del/list", UsersDel)
 		r2.POST("/user/add/list", UsersAdd)
 		r2.POST("/node/reload", NodeReload)
+		r2.POST("/rule/reload", RuleReload)
+		r2.GET("/sessions", Sessions)
+		r2.POST("/user/kick/:uid", UserKick)
 	}
 	return r
 }
@@ -205,21 +223,61 @@ func NodeReload(c *gin.Context) {
 		fail(c, err)
 		return
 	}
-	core.GetApp().SetNodeInfo(&nodeInfo)
-	core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData(nodeInfo.Protocol))
-	if nodeInfo.ClientLimit != 0 {
-		log.Info("set client limit with %v", nodeInfo.ClientLimit)
-		core.GetApp().GetObfsProtocolService().SetMaxClient(nodeInfo.ClientLimit)
+	before := core.GetApp().NodeInfo()
+	if err := service.ReloadNode(&nodeInfo); err != nil {
+		fail(c, err)
+		return
+	}
+	success(c)
+	// restart http server only when push port changed
+	if before == nil || before.PushPort != nodeInfo.PushPort {
+		httpServerChan <- CLOSE
+		httpServerChan <- START
 	} else {
-		log.Info("ignore client limit, because client_limit is zero, use default limit is 64")
+		SetSecret(nodeInfo.Secret)
 	}
-	if err := service.Reload(); err != nil {
+}
+
+// RuleReload reload audit rules from api and return the version in use
+func RuleReload(c *gin.Context) {
+	if err := service.GetRuleService().LoadFromApi(); err != nil {
 		fail(c, err)
 		return
 	}
-	success(c)
-	httpServerChan <- CLOSE
-	httpServerChan <- START
+	successWithData(c, gin.H{"version": service.GetRuleService().Version()})
+}
+
+// Sessions list the active sessions, they can be filtered by query uid, port and ip
+func Sessions(c *gin.Context) {
+	var query struct {
+		Uid  int    `form:"uid"`
+		Port int    `form:"port"`
+		IP   string `form:"ip"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		fail(c, err)
+		return
+	}
+	successWithData(c, service.GetSSRManager().Sessions(service.SessionFilter{
+		Uid:  query.Uid,
+		Port: query.Port,
+		IP:   query.IP,
+	}))
+}
+
+// UserKick close the tcp sessions and udp nat entries of user, the user is not deleted
+func UserKick(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	count, err := service.GetSSRManager().KickUser(uid)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	successWithData(c, gin.H{"count": count})
 }
 
 func fail(c *gin.Context, err error) {
@@ -1,10 +1,19 @@
 package server
 
 import (
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/ProxyPanel/VNet-SSR/service"
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"testing"
 )
 
 func ExampleStartServer() {
@@ -15,3 +24,86 @@ func ExampleStartServer() {
 	<-c
 	//Output:
 }
+
+func TestInitRouter_Metrics(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	SetSecret("abc")
+	metrics.HandshakeFail(metrics.ReasonReplay)
+	r := InitRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(w.Body.String(), "vnet_handshake_failures_total") {
+		t.Fatal("metrics is exposed without secret")
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("secret", "abc")
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `vnet_handshake_failures_total{reason="replay"}`) {
+		t.Fatalf("metrics body miss handshake failures: %s", w.Body.String())
+	}
+}
+
+// ruleClient is a panel only return rule
+type ruleClient struct {
+	client.PanelClient
+	rule *model.Rule
+}
+
+func (r *ruleClient) GetNodeRule() (*model.Rule, error) {
+	return r.rule, nil
+}
+
+func TestInitRouter_RuleReload(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	SetSecret("abc")
+	rule := &model.Rule{
+		Model: service.RuleModeReject,
+		Rules: []model.RuleItem{{Id: 1, Type: service.RuleTypePort, Pattern: "25"}},
+	}
+	client.SetPanelClient(&ruleClient{rule: rule})
+	r := InitRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/rule/reload", nil)
+	req.Header.Set("secret", "abc")
+	r.ServeHTTP(w, req)
+	if version := gjson.Get(w.Body.String(), "data.version").String(); version != service.RuleVersion(rule) {
+		t.Fatalf("reload version = %s, want %s: %s", version, service.RuleVersion(rule), w.Body.String())
+	}
+	if service.GetRuleService().Version() != service.RuleVersion(rule) {
+		t.Fatal("rule is not reloaded")
+	}
+}
+
+func TestInitRouter_Sessions(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	SetSecret("abc")
+	r := InitRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sessions?uid=1&ip=127.0.0.1", nil)
+	req.Header.Set("secret", "abc")
+	r.ServeHTTP(w, req)
+	if !gjson.Get(w.Body.String(), "data").IsArray() {
+		t.Fatalf("sessions is not a list: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/sessions?uid=bad", nil)
+	req.Header.Set("secret", "abc")
+	r.ServeHTTP(w, req)
+	if gjson.Get(w.Body.String(), "success").String() != "false" {
+		t.Fatalf("bad uid is accepted: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/v2/user/kick/99999", nil)
+	req.Header.Set("secret", "abc")
+	r.ServeHTTP(w, req)
+	if gjson.Get(w.Body.String(), "success").String() != "false" {
+		t.Fatalf("unknown uid is kicked: %s", w.Body.String())
+	}
+}
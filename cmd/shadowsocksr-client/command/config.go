@@ -0,0 +1,88 @@
+package command
+
+import "reflect"
+
+const (
+	SERVER         = "server"
+	SERVER_PORT    = "server_port"
+	PASSWORD       = "password"
+	METHOD         = "method"
+	PROTOCOL       = "protocol"
+	PROTOCOL_PARAM = "protocol_param"
+	OBFS           = "obfs"
+	OBFS_PARAM     = "obfs_param"
+	LOCAL_SOCKS5   = "local_socks5"
+	LOCAL_HTTP     = "local_http"
+)
+
+type FlagSetting struct {
+	Name     string
+	Default  interface{}
+	Usage    string
+	Example  string
+	Type     reflect.Kind
+	Required bool
+}
+
+var flagConfigs = []FlagSetting{
+	FlagSetting{
+		Type:     reflect.String,
+		Name:     SERVER,
+		Usage:    "shadowsocksr server address example: 1.2.3.4",
+		Required: true,
+	},
+	FlagSetting{
+		Type:     reflect.Int,
+		Name:     SERVER_PORT,
+		Usage:    "shadowsocksr server port",
+		Required: true,
+	},
+	FlagSetting{
+		Type:     reflect.String,
+		Name:     PASSWORD,
+		Usage:    "password",
+		Required: true,
+	},
+	FlagSetting{
+		Type:     reflect.String,
+		Name:     METHOD,
+		Usage:    "encrypt method example: aes-128-cfb",
+		Required: true,
+		Default:  "aes-128-cfb",
+	},
+	FlagSetting{
+		Type:     reflect.String,
+		Name:     PROTOCOL,
+		Usage:    "protocol example: auth_chain_a",
+		Required: true,
+		Default:  "origin",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  PROTOCOL_PARAM,
+		Usage: "protocol param example: 1024:password",
+	},
+	FlagSetting{
+		Type:     reflect.String,
+		Name:     OBFS,
+		Usage:    "obfs example: tls1.2_ticket_auth",
+		Required: true,
+		Default:  "plain",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  OBFS_PARAM,
+		Usage: "obfs param example: www.bing.com",
+	},
+	FlagSetting{
+		Type:    reflect.String,
+		Name:    LOCAL_SOCKS5,
+		Usage:   "local socks5 listen address, empty to disable",
+		Default: "127.0.0.1:1080",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  LOCAL_HTTP,
+		Usage: "local http proxy listen address example: 127.0.0.1:1087, empty to disable",
+	},
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/ProxyPanel/VNet-SSR/cmd/shadowsocksr-client/command"
+	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/proxy/client"
+	"github.com/ProxyPanel/VNet-SSR/utils/osx"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func main() {
+	logrus.SetLevel(logrus.InfoLevel)
+	command.Execute(func() {
+		ssrClient := &client.ShadowsocksClient{
+			Host:          viper.GetString(command.SERVER),
+			Port:          viper.GetInt(command.SERVER_PORT),
+			Passwd:        viper.GetString(command.PASSWORD),
+			Method:        viper.GetString(command.METHOD),
+			Protocol:      viper.GetString(command.PROTOCOL),
+			ProtocolParam: viper.GetString(command.PROTOCOL_PARAM),
+			Obfs:          viper.GetString(command.OBFS),
+			ObfsParam:     viper.GetString(command.OBFS_PARAM),
+		}
+		core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData(ssrClient.Protocol))
+
+		socks5Addr := viper.GetString(command.LOCAL_SOCKS5)
+		httpAddr := viper.GetString(command.LOCAL_HTTP)
+		if socks5Addr == "" && httpAddr == "" {
+			logrus.Fatal("both local_socks5 and local_http are empty")
+		}
+		if socks5Addr != "" {
+			if err := ssrClient.ListenSocks5(socks5Addr); err != nil {
+				logrus.Fatal(err)
+			}
+			log.Info("socks5 proxy listen on %s", socks5Addr)
+		}
+		if httpAddr != "" {
+			if err := ssrClient.ListenHTTP(httpAddr); err != nil {
+				logrus.Fatal(err)
+			}
+			log.Info("http proxy listen on %s", httpAddr)
+		}
+		osx.WaitSignal()
+		_ = ssrClient.Close()
+	})
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/audit"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "query access log by uid, ip or time range",
+	Long: "query access log written by --access_log, records of rotated files are included.\n" +
+		"example: audit --uid 1 --ip 8.8.8.8 --from 2021-01-01T00:00:00+08:00",
+	Args: cobra.NoArgs,
+	RunE: runAudit,
+}
+
+func init() {
+	auditCmd.Flags().String("file", "", "access log file, default is access_log of config")
+	auditCmd.Flags().Int("uid", 0, "uid of user")
+	auditCmd.Flags().String("ip", "", "ip of client or destination")
+	auditCmd.Flags().String("from", "", "start of time range in RFC3339 example: 2021-01-01T00:00:00+08:00")
+	auditCmd.Flags().String("to", "", "end of time range in RFC3339")
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		file = viper.GetString(ACCESS_LOG)
+	}
+	if file == "" {
+		return fmt.Errorf("miss access log file")
+	}
+	var filter audit.Filter
+	filter.Uid, _ = cmd.Flags().GetInt("uid")
+	filter.IP, _ = cmd.Flags().GetString("ip")
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value, _ := cmd.Flags().GetString(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, err)
+		}
+		*t = parsed
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return audit.Query(file, filter, func(record *audit.Record) error {
+		return encoder.Encode(record)
+	})
+}
@@ -3,10 +3,39 @@ package command
 import "reflect"
 
 const (
-	API_HOST   = "api_host"
-	HOST       = "host"
-	NODE_ID    = "node_id"
-	KEY        = "key"
+	API_HOST = "api_host"
+	HOST     = "host"
+	NODE_ID  = "node_id"
+	KEY      = "key"
+
+	PANEL_TYPE         = "panel_type"
+	USER_SYNC_INTERVAL = "user_sync_interval"
+
+	RELOAD_GRACE_TIMEOUT = "reload_grace_timeout"
+	IP_LIMIT_WINDOW      = "ip_limit_window"
+	REPORT_INTERVAL      = "report_interval"
+	REPORT_THRESHOLD     = "report_threshold"
+	TRAFFIC_JOURNAL      = "traffic_journal"
+	NODE_UP_LIMIT        = "node_up_limit"
+	NODE_DOWN_LIMIT      = "node_down_limit"
+	CONN_UP_LIMIT        = "conn_up_limit"
+	CONN_DOWN_LIMIT      = "conn_down_limit"
+	GEOIP_FILE           = "geoip_file"
+	GEOSITE_FILE         = "geosite_file"
+	SNIFF_TIMEOUT        = "sniff_timeout"
+	RULE_REFRESH         = "rule_refresh_interval"
+	ACCESS_LOG           = "access_log"
+	ACCESS_LOG_MAX_SIZE  = "access_log_max_size"
+	ACCESS_LOG_MAX_AGE   = "access_log_max_age"
+
+	REPLAY_CAPACITY = "replay_capacity"
+	REPLAY_FP_RATE  = "replay_fp_rate"
+	REPLAY_FILE     = "replay_file"
+
+	METRICS_PORT = "metrics_port"
+
+	STANDALONE_FILE = "standalone_file"
+	REPORT_FILE     = "report_file"
 )
 
 type FlagSetting struct {
@@ -16,14 +45,17 @@ type FlagSetting struct {
 	Example  string
 	Type     reflect.Kind
 	Required bool
+	// PanelOnly flag is not required in standalone mode
+	PanelOnly bool
 }
 
 var flagConfigs = []FlagSetting{
 	FlagSetting{
-		Type:     reflect.String,
-		Name:     API_HOST,
-		Usage:    "api host example: http://localhost",
-		Required: true,
+		Type:      reflect.String,
+		Name:      API_HOST,
+		Usage:     "api host example: http://localhost",
+		Required:  true,
+		PanelOnly: true,
 	},
 	FlagSetting{
 		Type:     reflect.String,
@@ -33,15 +65,151 @@ var flagConfigs = []FlagSetting{
 		Default:  "0.0.0.0",
 	},
 	FlagSetting{
-		Type:     reflect.Int,
-		Name:     NODE_ID,
-		Usage:    "node_id",
-		Required: true,
+		Type:      reflect.Int,
+		Name:      NODE_ID,
+		Usage:     "node_id",
+		Required:  true,
+		PanelOnly: true,
 	},
 	FlagSetting{
-		Type:     reflect.String,
-		Name:     KEY,
-		Usage:    "key",
-		Required: true,
+		Type:      reflect.String,
+		Name:      KEY,
+		Usage:     "key",
+		Required:  true,
+		PanelOnly: true,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    REPLAY_CAPACITY,
+		Usage:   "iv replay filter capacity, 0 disable the filter",
+		Default: 1000000,
+	},
+	FlagSetting{
+		Type:    reflect.Float64,
+		Name:    REPLAY_FP_RATE,
+		Usage:   "iv replay filter false positive rate",
+		Default: 0.000001,
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  REPLAY_FILE,
+		Usage: "file to save iv replay filter on shutdown example: replay.bloom",
+	},
+	FlagSetting{
+		Type:    reflect.String,
+		Name:    PANEL_TYPE,
+		Usage:   "panel type: proxypanel, sspanel or v2board",
+		Default: "proxypanel",
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    USER_SYNC_INTERVAL,
+		Usage:   "interval in milliseconds to pull user list from panel, 0 disable it",
+		Default: 60000,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    RELOAD_GRACE_TIMEOUT,
+		Usage:   "milliseconds to keep established connections of rebound ports on node reload",
+		Default: 30000,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    IP_LIMIT_WINDOW,
+		Usage:   "milliseconds a source ip is counted in ip limit after its last connection",
+		Default: 120000,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    REPORT_INTERVAL,
+		Usage:   "interval in milliseconds to report traffic, online and node status",
+		Default: 60000,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    REPORT_THRESHOLD,
+		Usage:   "min traffic bytes of user to report, less traffic is carried over to next report",
+		Default: 51200,
+	},
+	FlagSetting{
+		Type:    reflect.String,
+		Name:    TRAFFIC_JOURNAL,
+		Usage:   "journal file to keep traffic until panel receives it, empty only keep it in memory",
+		Default: "traffic.journal",
+	},
+	FlagSetting{
+		Type:  reflect.Int,
+		Name:  NODE_UP_LIMIT,
+		Usage: "aggregate upload bytes per second of all users, 0 is unlimited",
+	},
+	FlagSetting{
+		Type:  reflect.Int,
+		Name:  NODE_DOWN_LIMIT,
+		Usage: "aggregate download bytes per second of all users, 0 is unlimited",
+	},
+	FlagSetting{
+		Type:  reflect.Int,
+		Name:  CONN_UP_LIMIT,
+		Usage: "upload bytes per second of each connection, 0 is unlimited",
+	},
+	FlagSetting{
+		Type:  reflect.Int,
+		Name:  CONN_DOWN_LIMIT,
+		Usage: "download bytes per second of each connection, 0 is unlimited",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  GEOIP_FILE,
+		Usage: "MaxMind mmdb or v2ray geoip.dat for geoip rules, reloaded when changed",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  GEOSITE_FILE,
+		Usage: "v2ray geosite.dat for geosite rules, reloaded when changed",
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    SNIFF_TIMEOUT,
+		Usage:   "max time to wait first payload of tcp for protocol sniffing, 0 disable sniffing",
+		Default: 300,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    RULE_REFRESH,
+		Usage:   "interval to reload audit rules from api, 0 disable refresh",
+		Default: 300000,
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  ACCESS_LOG,
+		Usage: "file to append json lines of finished tcp sessions and udp nat entries, empty disable it example: access.log",
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    ACCESS_LOG_MAX_SIZE,
+		Usage:   "max megabytes of access log before rotated, 0 disable rotation",
+		Default: 100,
+	},
+	FlagSetting{
+		Type:    reflect.Int,
+		Name:    ACCESS_LOG_MAX_AGE,
+		Usage:   "days to keep rotated access logs, 0 keep them forever",
+		Default: 30,
+	},
+	FlagSetting{
+		Type:  reflect.Int,
+		Name:  METRICS_PORT,
+		Usage: "port to expose /metrics without secret, 0 only expose it on push port",
+	},
+	FlagSetting{
+		Type:  reflect.String,
+		Name:  STANDALONE_FILE,
+		Usage: "run without panel, read node, users and rule from json or yaml file example: standalone.yaml",
+	},
+	FlagSetting{
+		Type:    reflect.String,
+		Name:    REPORT_FILE,
+		Usage:   "file to append traffic and online reports in standalone mode",
+		Default: "report.log",
 	},
 }
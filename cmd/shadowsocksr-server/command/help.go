@@ -49,6 +49,8 @@ func init() {
 				rootCmd.Flags().Int(item.Name, item.Default.(int), item.Usage)
 			case reflect.Bool:
 				rootCmd.Flags().Bool(item.Name, item.Default.(bool), item.Usage)
+			case reflect.Float64:
+				rootCmd.Flags().Float64(item.Name, item.Default.(float64), item.Usage)
 			}
 		} else {
 			switch item.Type {
@@ -58,6 +60,8 @@ func init() {
 				rootCmd.Flags().Int(item.Name, 0, item.Usage)
 			case reflect.Bool:
 				rootCmd.Flags().Bool(item.Name, false, item.Usage)
+			case reflect.Float64:
+				rootCmd.Flags().Float64(item.Name, 0, item.Usage)
 			}
 		}
 		_ = viper.BindPFlag(item.Name, rootCmd.Flags().Lookup(item.Name))
@@ -86,8 +90,9 @@ func Execute(fn func()) {
 }
 
 func checkRequired() bool {
+	standalone := viper.GetString(STANDALONE_FILE) != ""
 	for _, item := range flagConfigs {
-		if item.Required {
+		if item.Required && !(standalone && item.PanelOnly) {
 			switch item.Type {
 			case reflect.String:
 				if viper.GetString(item.Name) == "" {
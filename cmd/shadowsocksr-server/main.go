@@ -5,22 +5,20 @@ import (
 	"github.com/ProxyPanel/VNet-SSR/api/client"
 	"github.com/ProxyPanel/VNet-SSR/api/server"
 	"github.com/ProxyPanel/VNet-SSR/cmd/shadowsocksr-server/command"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
-	"github.com/ProxyPanel/VNet-SSR/common/obfs"
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/service"
 	"github.com/ProxyPanel/VNet-SSR/utils/addrx"
+	"github.com/ProxyPanel/VNet-SSR/utils/bloomx"
 	"github.com/ProxyPanel/VNet-SSR/utils/osx"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"time"
 )
 
 func main() {
 	logrus.SetLevel(logrus.InfoLevel)
-	ip, err := addrx.GetPublicIp()
-	if err != nil {
-		panic(err)
-	}
 	command.Execute(func() {
 		if err := core.GetApp().Init(); err != nil {
 			panic(err)
@@ -29,11 +27,30 @@ func main() {
 		core.GetApp().SetNodeId(viper.GetInt(command.NODE_ID))
 		core.GetApp().SetKey(viper.GetString(command.KEY))
 		core.GetApp().SetHost(viper.GetString(command.HOST))
-		core.GetApp().SetPublicIP(ip)
-		if core.GetApp().GetPublicIP() == "" {
-			panic("get public ip error,please try align")
+
+		panelClient, err := client.NewPanelClient(viper.GetString(command.PANEL_TYPE))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		client.SetPanelClient(panelClient)
+
+		var fileProvider *client.FileProvider
+		if standaloneFile := viper.GetString(command.STANDALONE_FILE); standaloneFile != "" {
+			fileProvider, err = client.NewFileProvider(standaloneFile, viper.GetString(command.REPORT_FILE))
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			client.SetPanelClient(fileProvider)
+			log.Info("run in standalone mode with %s", standaloneFile)
+		} else {
+			// public ip is only logged, so the node still starts when the lookup fails
+			if ip, err := addrx.GetPublicIp(); err != nil {
+				log.Warn("get public ip error %s", err)
+			} else {
+				core.GetApp().SetPublicIP(ip)
+				log.Info("get public ip %s", ip)
+			}
 		}
-		log.Info("get public ip %s", core.GetApp().GetPublicIP())
 
 		nodeInfo, err := client.GetNodeInfo()
 		if err != nil {
@@ -44,20 +61,112 @@ func main() {
 			"nodeInfo": fmt.Sprintf("%+v", nodeInfo),
 		}).Info("get node info success")
 
-		core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData(nodeInfo.Protocol))
-		if nodeInfo.ClientLimit != 0 {
-			log.Info("set client limit with %v", nodeInfo.ClientLimit)
-			core.GetApp().GetObfsProtocolService().SetMaxClient(nodeInfo.ClientLimit)
-		} else {
-			log.Info("ignore client limit, because client_limit is zero, use default limit is 64")
+		service.SetObfsProtocolService(nil, nodeInfo)
+
+		replayFilter := newReplayFilter()
+
+		service.GetSSRManager().SyncInterval = time.Duration(viper.GetInt(command.USER_SYNC_INTERVAL)) * time.Millisecond
+		service.GetSSRManager().GraceTimeout = time.Duration(viper.GetInt(command.RELOAD_GRACE_TIMEOUT)) * time.Millisecond
+		service.GetSSRManager().IPWindow = time.Duration(viper.GetInt(command.IP_LIMIT_WINDOW)) * time.Millisecond
+		service.GetSSRManager().ReportInterval = time.Duration(viper.GetInt(command.REPORT_INTERVAL)) * time.Millisecond
+		service.GetSSRManager().ReportThreshold = viper.GetInt64(command.REPORT_THRESHOLD)
+		service.GetSSRManager().SniffTimeout = time.Duration(viper.GetInt(command.SNIFF_TIMEOUT)) * time.Millisecond
+		service.GetLimitInstance().SetNode(viper.GetInt(command.NODE_UP_LIMIT), viper.GetInt(command.NODE_DOWN_LIMIT))
+		service.GetLimitInstance().SetConn(viper.GetInt(command.CONN_UP_LIMIT), viper.GetInt(command.CONN_DOWN_LIMIT))
+		if err := service.GetRuleService().LoadGeo(viper.GetString(command.GEOIP_FILE), viper.GetString(command.GEOSITE_FILE)); err != nil {
+			logrus.Fatal(err)
+		}
+		if err := service.GetRuleService().WatchGeo(); err != nil {
+			logrus.Error(err)
+		}
+		if err := service.GetSSRManager().OpenJournal(viper.GetString(command.TRAFFIC_JOURNAL)); err != nil {
+			logrus.Fatal(err)
+		}
+		if err := service.GetSSRManager().OpenAccessLog(viper.GetString(command.ACCESS_LOG),
+			int64(viper.GetInt(command.ACCESS_LOG_MAX_SIZE))*1024*1024,
+			time.Duration(viper.GetInt(command.ACCESS_LOG_MAX_AGE))*24*time.Hour); err != nil {
+			logrus.Fatal(err)
 		}
 
 		if err := service.Start(); err != nil {
 			panic(err)
 			return
 		}
+		if err := service.GetRuleService().StartRefresh(time.Duration(viper.GetInt(command.RULE_REFRESH)) * time.Millisecond); err != nil {
+			logrus.Error(err)
+		}
 
-		server.StartServer(nodeInfo.PushPort, nodeInfo.Secret)
+		if fileProvider != nil {
+			if err := fileProvider.Watch(reloadStandalone); err != nil {
+				logrus.Error(err)
+			}
+		}
+
+		if fileProvider == nil || nodeInfo.PushPort != 0 {
+			server.StartServer(nodeInfo.PushPort, nodeInfo.Secret)
+		}
+		if metricsPort := viper.GetInt(command.METRICS_PORT); metricsPort != 0 {
+			server.StartMetricsServer(metricsPort)
+		}
 		osx.WaitSignal()
+		saveReplayFilter(replayFilter)
+		if err := service.GetSSRManager().CloseJournal(); err != nil {
+			logrus.Error(err)
+		}
+		if err := service.GetSSRManager().CloseAccessLog(); err != nil {
+			logrus.Error(err)
+		}
 	})
 }
+
+// reloadStandalone apply the node info and users after standalone file changed
+func reloadStandalone() {
+	nodeInfo, err := client.GetNodeInfo()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	if err := service.ReloadNode(nodeInfo); err != nil {
+		logrus.Errorf("reload standalone service error %s", err)
+	}
+	if err := service.GetSSRManager().SyncUsers(); err != nil {
+		logrus.Errorf("reload standalone users error %s", err)
+	}
+}
+
+// newReplayFilter create the iv replay filter and restore it from replay_file
+func newReplayFilter() *bloomx.RotatingFilter {
+	capacity := viper.GetInt(command.REPLAY_CAPACITY)
+	if capacity <= 0 {
+		log.Info("iv replay filter is disabled")
+		return nil
+	}
+	replayFilter := bloomx.NewRotatingFilter(capacity, viper.GetFloat64(command.REPLAY_FP_RATE))
+	if file := viper.GetString(command.REPLAY_FILE); file != "" {
+		if err := replayFilter.Load(file); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"file": file,
+				"err":  err,
+			}).Warn("load iv replay filter error, start with empty one")
+		}
+	}
+	ciphers.SetReplayFilter(replayFilter)
+	return replayFilter
+}
+
+func saveReplayFilter(replayFilter *bloomx.RotatingFilter) {
+	if replayFilter == nil {
+		return
+	}
+	log.Info("iv replay filter rejected %v requests", ciphers.ReplayCount())
+	file := viper.GetString(command.REPLAY_FILE)
+	if file == "" {
+		return
+	}
+	if err := replayFilter.Save(file); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"file": file,
+			"err":  err,
+		}).Error("save iv replay filter error")
+	}
+}
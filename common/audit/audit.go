@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// close reasons of session
+const (
+	// ReasonEOF the session is closed by client or destination
+	ReasonEOF = "eof"
+	// ReasonTimeout the udp nat entry is idle
+	ReasonTimeout = "timeout"
+	// ReasonReject the destination is rejected by audit rules
+	ReasonReject = "reject"
+	// ReasonDialFail the destination can not be connected
+	ReasonDialFail = "dial_fail"
+	// ReasonClosed the session is closed by node, such as user deleted or node reloaded
+	ReasonClosed = "closed"
+	// ReasonError the session is broken by other error
+	ReasonError = "error"
+)
+
+// rotateTimeFormat is the suffix of rotated file, it sorts in time order
+const rotateTimeFormat = "20060102-150405.000000000"
+
+// Record is the access record of a finished tcp session or udp nat entry
+type Record struct {
+	Uid int `json:"uid"`
+	// Port is the port of user
+	Port      int       `json:"port"`
+	Network   string    `json:"network"`
+	Client    string    `json:"client"`
+	Target    string    `json:"target"`
+	SniffHost string    `json:"sniff_host,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// Up is the bytes from client to destination, Down is the bytes from destination to client
+	Up     int64  `json:"up"`
+	Down   int64  `json:"down"`
+	Reason string `json:"reason"`
+}
+
+// Logger append records as json lines, the file is rotated when it exceeds maxSize,
+// rotated files older than maxAge are removed. zero maxSize or maxAge disable them
+type Logger struct {
+	sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	file    *os.File
+	size    int64
+	closed  bool
+}
+
+func Open(path string, maxSize int64, maxAge time.Duration) (*Logger, error) {
+	l := &Logger{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	l.cleanup()
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func (l *Logger) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	l.Lock()
+	defer l.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	// the file is missing when reopen failed in last rotation
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	var rotateErr error
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if rotateErr = l.rotate(); l.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return err
+}
+
+// rotate rename the current file with time suffix and open a new one. caller must hold lock.
+// path is reopened in append mode when rename fails, so records keep going to the current file
+func (l *Logger) rotate() error {
+	closeErr := l.file.Close()
+	l.file = nil
+	renameErr := os.Rename(l.path, l.path+"."+time.Now().Format(rotateTimeFormat))
+	if err := l.open(); err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	go l.cleanup()
+	return nil
+}
+
+// rotated return the rotated files of path in time order
+func rotated(path string) ([]string, error) {
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	result := files[:0]
+	for _, file := range files {
+		if _, err := time.Parse(rotateTimeFormat, strings.TrimPrefix(file, path+".")); err == nil {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// cleanup remove the rotated files older than maxAge
+func (l *Logger) cleanup() {
+	if l.maxAge <= 0 {
+		return
+	}
+	files, err := rotated(l.path)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > l.maxAge {
+			_ = os.Remove(file)
+		}
+	}
+}
+
+func (l *Logger) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoggerRotateAndQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	// each record is about 200 bytes, so every file keep a few records
+	logger, err := Open(path, 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		err := logger.Write(&Record{
+			Uid:     i%2 + 1,
+			Port:    10000 + i%2,
+			Network: "tcp",
+			Client:  "1.1.1.1:5000",
+			Target:  "8.8.8.8:443",
+			Start:   start.Add(time.Duration(i) * time.Minute),
+			End:     start.Add(time.Duration(i)*time.Minute + time.Second),
+			Up:      100,
+			Down:    200,
+			Reason:  ReasonEOF,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := rotated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("file is not rotated")
+	}
+	for _, file := range append(files, path) {
+		if info, err := os.Stat(file); err != nil || info.Size() > 1024 {
+			t.Fatalf("file %s exceed max size: %v", file, err)
+		}
+	}
+
+	count := func(filter Filter) int {
+		n := 0
+		if err := Query(path, filter, func(record *Record) error {
+			n++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(Filter{}); n != 20 {
+		t.Fatalf("all records = %v, want 20", n)
+	}
+	if n := count(Filter{Uid: 1}); n != 10 {
+		t.Fatalf("records of uid 1 = %v, want 10", n)
+	}
+	if n := count(Filter{IP: "8.8.8.8"}); n != 20 {
+		t.Fatalf("records of destination ip = %v, want 20", n)
+	}
+	if n := count(Filter{IP: "1.1.1.2"}); n != 0 {
+		t.Fatalf("records of other ip = %v, want 0", n)
+	}
+	if n := count(Filter{To: start.Add(4 * time.Minute)}); n != 5 {
+		t.Fatalf("records before 4 minute = %v, want 5", n)
+	}
+
+	// rotated files older than max age are removed on open
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(files[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+	logger, err = Open(path, 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Fatalf("old file is not removed: %v", err)
+	}
+}
+
+func TestLoggerRotateFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	logger, err := Open(path, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	record := &Record{Uid: 1, Port: 10000, Network: "tcp", Target: "8.8.8.8:443", Reason: ReasonEOF}
+	if err := logger.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	// rename fails when the file is removed, the path is reopened and the record is still written
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Write(record); err == nil {
+		t.Fatal("Write() want rotation error")
+	}
+	if err := logger.Write(record); err != nil {
+		t.Fatalf("Write() after failed rotation = %v", err)
+	}
+	n := 0
+	if err := Query(path, Filter{}, func(record *Record) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("records after failed rotation = %v, want 2", n)
+	}
+}
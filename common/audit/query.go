@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/addrx"
+)
+
+// Filter select records, zero fields match all
+type Filter struct {
+	Uid int
+	// IP match the ip of client or destination
+	IP string
+	// From and To select the records whose session overlap them
+	From time.Time
+	To   time.Time
+}
+
+func (f *Filter) Match(record *Record) bool {
+	if f.Uid != 0 && record.Uid != f.Uid {
+		return false
+	}
+	if f.IP != "" && addrx.SplitHostFromAddr(record.Client) != f.IP && addrx.SplitHostFromAddr(record.Target) != f.IP {
+		return false
+	}
+	if !f.From.IsZero() && record.End.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && record.Start.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Query call fn with the records match filter in the rotated files and the file at path,
+// broken lines are skipped
+func Query(path string, filter Filter, fn func(record *Record) error) error {
+	files, err := rotated(path)
+	if err != nil {
+		return err
+	}
+	files = append(files, path)
+	for _, file := range files {
+		// records of file are written before its last modification
+		if info, err := os.Stat(file); err == nil && !filter.From.IsZero() && info.ModTime().Before(filter.From) {
+			continue
+		}
+		if err := queryFile(file, filter, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryFile(path string, filter Filter, fn func(record *Record) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			continue
+		}
+		if !filter.Match(record) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,135 @@
+// Package aead2022 implements the shadowsocks 2022 edition ciphers (SIP022)
+package aead2022
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"lukechampine.com/blake3"
+)
+
+const (
+	HeaderTypeClient = 0
+	HeaderTypeServer = 1
+
+	// MaxPayloadSize is the max length of a tcp chunk
+	MaxPayloadSize = 0xFFFF
+	// MaxPaddingLength is the max length of the padding in request header
+	MaxPaddingLength = 900
+	// TimestampTolerance is the max difference between header timestamp and local time
+	TimestampTolerance = 30 * time.Second
+	// SessionIDSize is the length of udp session id
+	SessionIDSize = 8
+
+	sessionSubkeyContext = "shadowsocks 2022 session subkey"
+)
+
+var (
+	ErrBadTimestamp = errors.New("aead 2022 timestamp is out of tolerance")
+	ErrSaltReplay   = errors.New("aead 2022 salt is replayed")
+	ErrBadHeader    = errors.New("aead 2022 header type error")
+	ErrPacketReplay = errors.New("aead 2022 packet id is replayed")
+)
+
+type IAEAD2022Cipher interface {
+	KeySize() int
+	SaltSize() int
+	NonceSize() int
+	// NewAEAD return the tcp session cipher derived by psk and salt
+	NewAEAD(psk []byte, salt []byte) (cipher.AEAD, error)
+	// SealPacket encrypt the udp packet body with session id and packet id
+	SealPacket(psk, sessionID []byte, packetID uint64, body []byte) ([]byte, error)
+	// OpenPacket decrypt the udp packet, return session id, packet id and body
+	OpenPacket(psk, packet []byte) (sessionID []byte, packetID uint64, body []byte, err error)
+}
+
+var aead2022Ciphers = make(map[string]IAEAD2022Cipher)
+
+func registerAEAD2022Ciphers(method string, c IAEAD2022Cipher) {
+	aead2022Ciphers[method] = c
+}
+
+func GetAEAD2022Ciphers() map[string]IAEAD2022Cipher {
+	return aead2022Ciphers
+}
+
+func GetAEAD2022Cipher(method string) IAEAD2022Cipher {
+	return aead2022Ciphers[method]
+}
+
+// DecodePSK decode the base64 pre-shared key, its length must be same as the key size
+func DecodePSK(password string, keySize int) ([]byte, error) {
+	psk, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return nil, errors.Wrap(err, "aead 2022 psk must be base64 encoded")
+	}
+	if len(psk) != keySize {
+		return nil, errors.Errorf("aead 2022 psk length must be %v, but got %v", keySize, len(psk))
+	}
+	return psk, nil
+}
+
+// SessionKey derive the session subkey by blake3 with psk and salt (or udp session id)
+func SessionKey(psk, salt []byte) []byte {
+	material := make([]byte, len(psk)+len(salt))
+	copy(material, psk)
+	copy(material[len(psk):], salt)
+	key := make([]byte, len(psk))
+	blake3.DeriveKey(key, sessionSubkeyContext, material)
+	return key
+}
+
+// CheckTimestamp verify the unix timestamp in header is in the tolerance
+func CheckTimestamp(timestamp uint64) error {
+	diff := time.Now().Unix() - int64(timestamp)
+	if diff < 0 {
+		diff = -diff
+	}
+	if time.Duration(diff)*time.Second > TimestampTolerance {
+		return ErrBadTimestamp
+	}
+	return nil
+}
+
+// PutTimestamp write current unix timestamp into b in big endian
+func PutTimestamp(b []byte) {
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Unix()))
+}
+
+// saltPool remember the salts seen in twice of the timestamp tolerance,
+// the older one will be reject by timestamp check
+type saltPool struct {
+	sync.Mutex
+	salts     map[string]time.Time
+	lastClean time.Time
+}
+
+var defaultSaltPool = &saltPool{salts: make(map[string]time.Time)}
+
+// CheckSalt return ErrSaltReplay if the salt has been seen before
+func CheckSalt(salt []byte) error {
+	return defaultSaltPool.check(salt)
+}
+
+func (p *saltPool) check(salt []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	if now.Sub(p.lastClean) > TimestampTolerance {
+		for k, v := range p.salts {
+			if now.Sub(v) > 2*TimestampTolerance {
+				delete(p.salts, k)
+			}
+		}
+		p.lastClean = now
+	}
+	if t, ok := p.salts[string(salt)]; ok && now.Sub(t) <= 2*TimestampTolerance {
+		return ErrSaltReplay
+	}
+	p.salts[string(salt)] = now
+	return nil
+}
@@ -0,0 +1,205 @@
+package aead2022
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodePSK(t *testing.T) {
+	psk := bytes.Repeat([]byte{1}, 16)
+	got, err := DecodePSK(base64.StdEncoding.EncodeToString(psk), 16)
+	if err != nil || !bytes.Equal(got, psk) {
+		t.Errorf("DecodePSK() = %v, %v", got, err)
+	}
+	if _, err := DecodePSK(base64.StdEncoding.EncodeToString(psk), 32); err == nil {
+		t.Error("DecodePSK() with wrong length want error")
+	}
+	if _, err := DecodePSK("killer!", 16); err == nil {
+		t.Error("DecodePSK() with plain password want error")
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	psk := bytes.Repeat([]byte{1}, 32)
+	key := SessionKey(psk, bytes.Repeat([]byte{2}, 32))
+	if len(key) != len(psk) {
+		t.Fatalf("SessionKey() length = %v", len(key))
+	}
+	if bytes.Equal(key, SessionKey(psk, bytes.Repeat([]byte{3}, 32))) {
+		t.Error("SessionKey() with different salt want different key")
+	}
+}
+
+func TestCheckSalt(t *testing.T) {
+	salt := []byte("aead 2022 test salt")
+	if err := CheckSalt(salt); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSalt(salt); err != ErrSaltReplay {
+		t.Errorf("CheckSalt() replay = %v", err)
+	}
+}
+
+func TestPacket(t *testing.T) {
+	for method, cp := range GetAEAD2022Ciphers() {
+		t.Run(method, func(t *testing.T) {
+			psk := bytes.Repeat([]byte{7}, cp.KeySize())
+			sessionID := []byte("12345678")
+			data := []byte("\x01\x7f\x00\x00\x01\x00\x35hello")
+			packet, err := cp.SealPacket(psk, sessionID, 3, PackPacketBody(HeaderTypeClient, nil, data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotSessionID, packetID, body, err := cp.OpenPacket(psk, packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gotSessionID, sessionID) || packetID != 3 {
+				t.Errorf("OpenPacket() session = %x, packet id = %v", gotSessionID, packetID)
+			}
+			if _, got, err := UnpackPacketBody(HeaderTypeClient, body); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("UnpackPacketBody() = %x, %v", got, err)
+			}
+			if _, _, err := UnpackPacketBody(HeaderTypeServer, body); err == nil {
+				t.Error("UnpackPacketBody() with wrong type want error")
+			}
+
+			packet[len(packet)-1] ^= 1
+			if _, _, _, err := cp.OpenPacket(psk, packet); err == nil {
+				t.Error("OpenPacket() with tampered packet want error")
+			}
+		})
+	}
+}
+
+// the vectors are generated independently by openssl (aes), libsodium (xchacha20-poly1305)
+// and the blake3 reference implementation
+func TestVectors(t *testing.T) {
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	psk16, psk32 := make([]byte, 16), make([]byte, 32)
+	for i := range psk32 {
+		psk32[i] = byte(i)
+	}
+	copy(psk16, psk32)
+	salt := make([]byte, 32)
+	for i := range salt {
+		salt[i] = byte(0x20 + i)
+	}
+	plaintext := []byte("shadowsocks 2022 tcp vector")
+
+	for _, tt := range []struct {
+		method, subkey, sealed string
+		psk, salt              []byte
+	}{
+		{"2022-blake3-aes-128-gcm", "8180421f8f56092ca7544a64ff852536",
+			"bdbc58a8bad9789e51fc2f2700e836f2145d72e27f2733dbb675c997b9422deab33a944d7a69a5a5465794", psk16, salt[:16]},
+		{"2022-blake3-aes-256-gcm", "374fca03e4dae7f998fd7e59c1edfcc8e3197f4db1c19ca1671be3b66a92ddda",
+			"d9269ab6769c2feb6fe9091252165a4d0088adb17c855204e1eeb2cae15af83eb78810391e97b34d333b53", psk32, salt},
+	} {
+		if got := SessionKey(tt.psk, tt.salt); !bytes.Equal(got, decode(tt.subkey)) {
+			t.Errorf("%s SessionKey() = %x", tt.method, got)
+		}
+		aead, err := GetAEAD2022Cipher(tt.method).NewAEAD(tt.psk, tt.salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := aead.Seal(nil, make([]byte, aead.NonceSize()), plaintext, nil); !bytes.Equal(got, decode(tt.sealed)) {
+			t.Errorf("%s Seal() = %x", tt.method, got)
+		}
+	}
+
+	// udp client packet of session 0102030405060708 and packet id 42
+	sessionID := decode("0102030405060708")
+	body := decode("00000000006553f100000001080808080035646e73")
+	aesPacket := decode("390693e83195b05ac85ba159331516b5d5c0504ad6aff537b8ab00ceba84f5fead7de20c25f732fa6fd3ff96ac9088534304bc9449")
+	if got, err := GetAEAD2022Cipher("2022-blake3-aes-128-gcm").SealPacket(psk16, sessionID, 42, body); err != nil || !bytes.Equal(got, aesPacket) {
+		t.Errorf("SealPacket() = %x, %v", got, err)
+	}
+	for _, tt := range []struct {
+		method string
+		psk    []byte
+		packet []byte
+	}{
+		{"2022-blake3-aes-128-gcm", psk16, aesPacket},
+		{"2022-blake3-chacha20-poly1305", psk32, decode("404142434445464748494a4b4c4d4e4f5051525354555657d53b0674d5e67e1e8ff487beaf9c65b892baadc4133c006b6a31fd44010c2b9816cc6600263fd8aaa64ba5ca60efce148e84bd4a79")},
+	} {
+		gotSessionID, packetID, gotBody, err := GetAEAD2022Cipher(tt.method).OpenPacket(tt.psk, tt.packet)
+		if err != nil || !bytes.Equal(gotSessionID, sessionID) || packetID != 42 || !bytes.Equal(gotBody, body) {
+			t.Errorf("%s OpenPacket() = %x, %v, %x, %v", tt.method, gotSessionID, packetID, gotBody, err)
+		}
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w ReplayWindow
+	for _, tt := range []struct {
+		id   uint64
+		want bool
+	}{
+		{0, true}, {0, false}, {2, true}, {1, true}, {2, false},
+		{WindowSize + 10, true}, {9, false}, {10, true}, {10, false},
+		// far jump clear the whole ring
+		{100 * WindowSize, true}, {100*WindowSize - 1, true}, {WindowSize + 11, false},
+	} {
+		if got := w.Check(tt.id); got != tt.want {
+			t.Errorf("Check(%v) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+// the vectors of identity header are generated same as TestVectors
+func TestIdentity(t *testing.T) {
+	ipsk, upsk, salt := make([]byte, 16), make([]byte, 16), make([]byte, 16)
+	for i := range ipsk {
+		ipsk[i], upsk[i], salt[i] = byte(i), byte(0x80+i), byte(0x20+i)
+	}
+	if got := IdentityHash(upsk); hex.EncodeToString(got[:]) != "faaa653d3dd205a6adc44a28a1bd4e36" {
+		t.Errorf("IdentityHash() = %x", got)
+	}
+	if got := IdentitySubkey(ipsk, salt); hex.EncodeToString(got) != "1e3587415fc15417133c20d9e4b78ec3" {
+		t.Errorf("IdentitySubkey() = %x", got)
+	}
+	header, err := SealIdentityHeader(ipsk, upsk, salt)
+	if err != nil || hex.EncodeToString(header) != "bc238e95c4739c37e6b45dc86673393b" {
+		t.Errorf("SealIdentityHeader() = %x, %v", header, err)
+	}
+
+	users := NewUsers()
+	users.Set(7, upsk)
+	users.Set(8, bytes.Repeat([]byte{1}, 16))
+	if user, err := users.OpenIdentityHeader(ipsk, salt, header); err != nil || user.ID != 7 {
+		t.Errorf("OpenIdentityHeader() = %+v, %v", user, err)
+	}
+
+	cp := GetIdentityCipher("2022-blake3-aes-128-gcm")
+	sessionID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	body, _ := hex.DecodeString("00000000006553f100000001080808080035646e73")
+	packet, err := cp.SealIdentityPacket(ipsk, upsk, sessionID, 42, body)
+	if err != nil || hex.EncodeToString(packet) != "390693e83195b05ac85ba159331516b51ab1628fc466426e5d37c477accad8c5c5a6984db57f7feeef3b95395989c705c0c41860c0b3168421aa353548250c3cd739fb2289" {
+		t.Errorf("SealIdentityPacket() = %x, %v", packet, err)
+	}
+	user, gotSessionID, packetID, gotBody, err := cp.OpenIdentityPacket(ipsk, users, packet)
+	if err != nil || user.ID != 7 || !bytes.Equal(gotSessionID, sessionID) || packetID != 42 || !bytes.Equal(gotBody, body) {
+		t.Errorf("OpenIdentityPacket() = %+v, %x, %v, %x, %v", user, gotSessionID, packetID, gotBody, err)
+	}
+
+	users.Del(7)
+	if _, err := users.OpenIdentityHeader(ipsk, salt, header); err != ErrUnknownUser {
+		t.Errorf("OpenIdentityHeader() of deleted user = %v", err)
+	}
+	users.Reset(map[int][]byte{9: upsk})
+	if user, _, _, _, err := cp.OpenIdentityPacket(ipsk, users, packet); err != nil || user.ID != 9 || users.Len() != 1 {
+		t.Errorf("OpenIdentityPacket() after reset = %+v, %v", user, err)
+	}
+	if GetIdentityCipher("2022-blake3-chacha20-poly1305") != nil {
+		t.Error("chacha20-poly1305 does not support identity header")
+	}
+}
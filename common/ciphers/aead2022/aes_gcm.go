@@ -0,0 +1,143 @@
+package aead2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerAEAD2022Ciphers("2022-blake3-aes-128-gcm", &aesGcm{16, 16, 12, 16})
+	registerAEAD2022Ciphers("2022-blake3-aes-256-gcm", &aesGcm{32, 32, 12, 16})
+}
+
+type aesGcm struct {
+	keySize   int
+	saltSize  int
+	nonceSize int
+	tagSize   int
+}
+
+func (a *aesGcm) KeySize() int {
+	return a.keySize
+}
+
+func (a *aesGcm) SaltSize() int {
+	return a.saltSize
+}
+
+func (a *aesGcm) NonceSize() int {
+	return a.nonceSize
+}
+
+func (a *aesGcm) NewAEAD(psk []byte, salt []byte) (cipher.AEAD, error) {
+	blk, err := aes.NewCipher(SessionKey(psk, salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(blk)
+}
+
+// SealPacket output the aes encrypted separate header (session id + packet id),
+// then the body sealed by session subkey with the last 12 bytes of separate header as nonce
+func (a *aesGcm) SealPacket(psk, sessionID []byte, packetID uint64, body []byte) ([]byte, error) {
+	if len(sessionID) != SessionIDSize {
+		return nil, errors.New("aead 2022 session id size error")
+	}
+	header := make([]byte, 2*SessionIDSize)
+	copy(header, sessionID)
+	binary.BigEndian.PutUint64(header[SessionIDSize:], packetID)
+	aead, err := a.NewAEAD(psk, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := aes.NewCipher(psk)
+	if err != nil {
+		return nil, err
+	}
+	packet := make([]byte, len(header), len(header)+len(body)+a.tagSize)
+	blk.Encrypt(packet, header)
+	return aead.Seal(packet, header[4:16], body, nil), nil
+}
+
+func (a *aesGcm) OpenPacket(psk, packet []byte) (sessionID []byte, packetID uint64, body []byte, err error) {
+	if len(packet) < 2*SessionIDSize+a.tagSize {
+		return nil, 0, nil, errors.New("aead 2022 packet is too short")
+	}
+	blk, err := aes.NewCipher(psk)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	header := make([]byte, 2*SessionIDSize)
+	blk.Decrypt(header, packet[:2*SessionIDSize])
+	sessionID = header[:SessionIDSize]
+	packetID = binary.BigEndian.Uint64(header[SessionIDSize:])
+	aead, err := a.NewAEAD(psk, sessionID)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	body, err = aead.Open(nil, header[4:16], packet[2*SessionIDSize:], nil)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return sessionID, packetID, body, nil
+}
+
+// SealIdentityPacket output the separate header encrypted by identity psk, then the identity
+// header (user psk hash xor plain separate header) and the body sealed by the user session subkey
+func (a *aesGcm) SealIdentityPacket(ipsk, upsk, sessionID []byte, packetID uint64, body []byte) ([]byte, error) {
+	packet, err := a.SealPacket(upsk, sessionID, packetID, body)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 2*SessionIDSize)
+	copy(header, sessionID)
+	binary.BigEndian.PutUint64(header[SessionIDSize:], packetID)
+	blk, err := aes.NewCipher(ipsk)
+	if err != nil {
+		return nil, err
+	}
+	hash := IdentityHash(upsk)
+	identityHeader := make([]byte, IdentityHeaderSize)
+	for i := range identityHeader {
+		identityHeader[i] = hash[i] ^ header[i]
+	}
+	result := make([]byte, 2*SessionIDSize+IdentityHeaderSize, len(packet)+IdentityHeaderSize)
+	blk.Encrypt(result, header)
+	blk.Encrypt(result[2*SessionIDSize:], identityHeader)
+	return append(result, packet[2*SessionIDSize:]...), nil
+}
+
+func (a *aesGcm) OpenIdentityPacket(ipsk []byte, users *Users, packet []byte) (user *User, sessionID []byte, packetID uint64, body []byte, err error) {
+	if len(packet) < 2*SessionIDSize+IdentityHeaderSize+a.tagSize {
+		return nil, nil, 0, nil, errors.New("aead 2022 packet is too short")
+	}
+	blk, err := aes.NewCipher(ipsk)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	header := make([]byte, 2*SessionIDSize)
+	blk.Decrypt(header, packet[:2*SessionIDSize])
+	var hash [IdentityHeaderSize]byte
+	blk.Decrypt(hash[:], packet[2*SessionIDSize:2*SessionIDSize+IdentityHeaderSize])
+	for i := range hash {
+		hash[i] ^= header[i]
+	}
+	user, err = users.Get(hash)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	sessionID = header[:SessionIDSize]
+	packetID = binary.BigEndian.Uint64(header[SessionIDSize:])
+	aead, err := a.NewAEAD(user.PSK, sessionID)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	body, err = aead.Open(nil, header[4:16], packet[2*SessionIDSize+IdentityHeaderSize:], nil)
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	return user, sessionID, packetID, body, nil
+}
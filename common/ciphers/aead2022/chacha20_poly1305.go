@@ -0,0 +1,76 @@
+package aead2022
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func init() {
+	registerAEAD2022Ciphers("2022-blake3-chacha20-poly1305", &chacha20Poly1305{32, 32, 12, 16})
+}
+
+type chacha20Poly1305 struct {
+	keySize   int
+	saltSize  int
+	nonceSize int
+	tagSize   int
+}
+
+func (c *chacha20Poly1305) KeySize() int {
+	return c.keySize
+}
+
+func (c *chacha20Poly1305) SaltSize() int {
+	return c.saltSize
+}
+
+func (c *chacha20Poly1305) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *chacha20Poly1305) NewAEAD(psk []byte, salt []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(SessionKey(psk, salt))
+}
+
+// SealPacket output a random 24 bytes nonce, then session id, packet id and body
+// sealed by xchacha20-poly1305 with psk
+func (c *chacha20Poly1305) SealPacket(psk, sessionID []byte, packetID uint64, body []byte) ([]byte, error) {
+	if len(sessionID) != SessionIDSize {
+		return nil, errors.New("aead 2022 session id size error")
+	}
+	aead, err := chacha20poly1305.NewX(psk)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, 2*SessionIDSize+len(body))
+	copy(plaintext, sessionID)
+	binary.BigEndian.PutUint64(plaintext[SessionIDSize:], packetID)
+	copy(plaintext[2*SessionIDSize:], body)
+	packet := make([]byte, chacha20poly1305.NonceSizeX, chacha20poly1305.NonceSizeX+len(plaintext)+c.tagSize)
+	if _, err := io.ReadFull(rand.Reader, packet); err != nil {
+		return nil, err
+	}
+	return aead.Seal(packet, packet, plaintext, nil), nil
+}
+
+func (c *chacha20Poly1305) OpenPacket(psk, packet []byte) (sessionID []byte, packetID uint64, body []byte, err error) {
+	if len(packet) < chacha20poly1305.NonceSizeX+2*SessionIDSize+c.tagSize {
+		return nil, 0, nil, errors.New("aead 2022 packet is too short")
+	}
+	aead, err := chacha20poly1305.NewX(psk)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	plaintext, err := aead.Open(nil, packet[:chacha20poly1305.NonceSizeX], packet[chacha20poly1305.NonceSizeX:], nil)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	sessionID = plaintext[:SessionIDSize]
+	packetID = binary.BigEndian.Uint64(plaintext[SessionIDSize:])
+	return sessionID, packetID, plaintext[2*SessionIDSize:], nil
+}
@@ -0,0 +1,146 @@
+package aead2022
+
+import (
+	"crypto/aes"
+	"sync"
+
+	"github.com/pkg/errors"
+	"lukechampine.com/blake3"
+)
+
+// IdentityHeaderSize is the length of the extensible identity header (SIP023)
+const IdentityHeaderSize = 16
+
+const identitySubkeyContext = "shadowsocks 2022 identity subkey"
+
+var ErrUnknownUser = errors.New("aead 2022 identity header match no user")
+
+// IIdentityCipher is the cipher support multiple users with the extensible identity header,
+// the server psk is the identity psk and each user has its own psk
+type IIdentityCipher interface {
+	// SealIdentityPacket encrypt the udp client packet of user with identity header
+	SealIdentityPacket(ipsk, upsk, sessionID []byte, packetID uint64, body []byte) ([]byte, error)
+	// OpenIdentityPacket decrypt the udp client packet and return the user of identity header
+	OpenIdentityPacket(ipsk []byte, users *Users, packet []byte) (user *User, sessionID []byte, packetID uint64, body []byte, err error)
+}
+
+// GetIdentityCipher return nil if the method does not support identity header
+func GetIdentityCipher(method string) IIdentityCipher {
+	if cp, ok := aead2022Ciphers[method].(IIdentityCipher); ok {
+		return cp
+	}
+	return nil
+}
+
+// IdentityHash is the first 16 bytes of blake3 hash of user psk
+func IdentityHash(upsk []byte) (hash [IdentityHeaderSize]byte) {
+	sum := blake3.Sum256(upsk)
+	copy(hash[:], sum[:])
+	return hash
+}
+
+// IdentitySubkey derive the key to encrypt tcp identity header by identity psk and salt
+func IdentitySubkey(ipsk, salt []byte) []byte {
+	material := make([]byte, len(ipsk)+len(salt))
+	copy(material, ipsk)
+	copy(material[len(ipsk):], salt)
+	key := make([]byte, len(ipsk))
+	blake3.DeriveKey(key, identitySubkeyContext, material)
+	return key
+}
+
+// SealIdentityHeader build the tcp identity header of user after the request salt
+func SealIdentityHeader(ipsk, upsk, salt []byte) ([]byte, error) {
+	blk, err := aes.NewCipher(IdentitySubkey(ipsk, salt))
+	if err != nil {
+		return nil, err
+	}
+	hash := IdentityHash(upsk)
+	header := make([]byte, IdentityHeaderSize)
+	blk.Encrypt(header, hash[:])
+	return header, nil
+}
+
+// OpenIdentityHeader decrypt the tcp identity header and return its user
+func (u *Users) OpenIdentityHeader(ipsk, salt, header []byte) (*User, error) {
+	if len(header) < IdentityHeaderSize {
+		return nil, errors.New("aead 2022 identity header is too short")
+	}
+	blk, err := aes.NewCipher(IdentitySubkey(ipsk, salt))
+	if err != nil {
+		return nil, err
+	}
+	var hash [IdentityHeaderSize]byte
+	blk.Decrypt(hash[:], header[:IdentityHeaderSize])
+	return u.Get(hash)
+}
+
+// User is the user identified by its psk, ID is the uid of proxy
+type User struct {
+	ID  int
+	PSK []byte
+}
+
+// Users is the users of a server keyed by identity hash, it is safe for concurrent use
+type Users struct {
+	sync.RWMutex
+	users map[[IdentityHeaderSize]byte]*User
+	ids   map[int][IdentityHeaderSize]byte
+}
+
+func NewUsers() *Users {
+	return &Users{
+		users: make(map[[IdentityHeaderSize]byte]*User),
+		ids:   make(map[int][IdentityHeaderSize]byte),
+	}
+}
+
+// Reset replace all users with the psk of ids
+func (u *Users) Reset(users map[int][]byte) {
+	u.Lock()
+	defer u.Unlock()
+	u.users = make(map[[IdentityHeaderSize]byte]*User, len(users))
+	u.ids = make(map[int][IdentityHeaderSize]byte, len(users))
+	for id, upsk := range users {
+		hash := IdentityHash(upsk)
+		u.users[hash] = &User{ID: id, PSK: upsk}
+		u.ids[id] = hash
+	}
+}
+
+// Set add the user or replace its psk
+func (u *Users) Set(id int, upsk []byte) {
+	u.Lock()
+	defer u.Unlock()
+	if hash, ok := u.ids[id]; ok {
+		delete(u.users, hash)
+	}
+	hash := IdentityHash(upsk)
+	u.users[hash] = &User{ID: id, PSK: upsk}
+	u.ids[id] = hash
+}
+
+func (u *Users) Del(id int) {
+	u.Lock()
+	defer u.Unlock()
+	if hash, ok := u.ids[id]; ok {
+		delete(u.users, hash)
+		delete(u.ids, id)
+	}
+}
+
+// Get return ErrUnknownUser if no user has the identity hash
+func (u *Users) Get(hash [IdentityHeaderSize]byte) (*User, error) {
+	u.RLock()
+	defer u.RUnlock()
+	if user, ok := u.users[hash]; ok {
+		return user, nil
+	}
+	return nil, ErrUnknownUser
+}
+
+func (u *Users) Len() int {
+	u.RLock()
+	defer u.RUnlock()
+	return len(u.users)
+}
@@ -0,0 +1,53 @@
+package aead2022
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// PackPacketBody build the udp main header before data (socks address + payload),
+// client session id is only used by server packet
+//
+//	client: type(1) timestamp(8) padding length(2) padding data
+//	server: type(1) timestamp(8) client session id(8) padding length(2) padding data
+func PackPacketBody(headerType int, clientSessionID, data []byte) []byte {
+	headerLen := 1 + 8 + 2
+	if headerType == HeaderTypeServer {
+		headerLen += SessionIDSize
+	}
+	body := make([]byte, headerLen+len(data))
+	body[0] = byte(headerType)
+	PutTimestamp(body[1:9])
+	if headerType == HeaderTypeServer {
+		copy(body[9:9+SessionIDSize], clientSessionID)
+	}
+	// no padding
+	copy(body[headerLen:], data)
+	return body
+}
+
+// UnpackPacketBody verify the udp main header and return the data after padding
+func UnpackPacketBody(headerType int, body []byte) (clientSessionID, data []byte, err error) {
+	headerLen := 1 + 8 + 2
+	if headerType == HeaderTypeServer {
+		headerLen += SessionIDSize
+	}
+	if len(body) < headerLen {
+		return nil, nil, errors.New("aead 2022 packet header is too short")
+	}
+	if int(body[0]) != headerType {
+		return nil, nil, ErrBadHeader
+	}
+	if err := CheckTimestamp(binary.BigEndian.Uint64(body[1:9])); err != nil {
+		return nil, nil, err
+	}
+	if headerType == HeaderTypeServer {
+		clientSessionID = body[9 : 9+SessionIDSize]
+	}
+	paddingLen := int(binary.BigEndian.Uint16(body[headerLen-2 : headerLen]))
+	if len(body) < headerLen+paddingLen {
+		return nil, nil, errors.New("aead 2022 packet padding is too short")
+	}
+	return clientSessionID, body[headerLen+paddingLen:], nil
+}
@@ -0,0 +1,42 @@
+package aead2022
+
+// the replay window of udp packet id is a ring of bit blocks, same as the sliding window of wireguard
+const (
+	windowBlockBits  = 64
+	windowRingBlocks = 32
+	// WindowSize is how far a packet id can be behind the largest one
+	WindowSize = (windowRingBlocks - 1) * windowBlockBits
+)
+
+// ReplayWindow reject the udp packet ids which are seen or too old, zero value is ready to use.
+// it is not safe for concurrent use
+type ReplayWindow struct {
+	last uint64
+	ring [windowRingBlocks]uint64
+}
+
+// Check return false when id is replayed or behind the window, otherwise id is recorded.
+// it must be called after the packet is authenticated, so forged packets can not move the window
+func (w *ReplayWindow) Check(id uint64) bool {
+	block := id / windowBlockBits
+	if id > w.last {
+		current := w.last / windowBlockBits
+		diff := block - current
+		if diff > windowRingBlocks {
+			diff = windowRingBlocks
+		}
+		for i := current + 1; i <= current+diff; i++ {
+			w.ring[i%windowRingBlocks] = 0
+		}
+		w.last = id
+	} else if w.last-id > WindowSize {
+		return false
+	}
+	block %= windowRingBlocks
+	bit := uint64(1) << (id % windowBlockBits)
+	if w.ring[block]&bit != 0 {
+		return false
+	}
+	w.ring[block] |= bit
+	return true
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 
 	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
 	"github.com/ProxyPanel/VNet-SSR/common/ciphers/stream"
 	"github.com/pkg/errors"
 )
@@ -39,9 +40,30 @@ type SSCipher struct {
 	AEADReadBuffer *bytes.Buffer
 	HeadSize       int
 	Method         string
+	// AEAD2022 is the shadowsocks 2022 edition, RequestSalt is set on server encoder and client decoder
+	AEAD2022       bool
+	RequestSalt    []byte
+	HeaderDone     bool
+	VariableHeader bool
 }
 
 func NewCipher(op int, method string, key, iv []byte) (*SSCipher, error) {
+	if cp := aead2022.GetAEAD2022Cipher(method); cp != nil {
+		cpInstance, err := cp.NewAEAD(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		return &SSCipher{
+			AEAD:           cpInstance,
+			AEAD2022:       true,
+			Method:         method,
+			IV:             iv,
+			OP:             op,
+			AEADReadBuffer: new(bytes.Buffer),
+			AEADWriteNonce: make([]byte, cpInstance.NonceSize()),
+			AEADReadNonce:  make([]byte, cpInstance.NonceSize()),
+		}, nil
+	}
 	if cp := stream.GetStreamCipher(method); cp != nil {
 		cpInstance, err := cp.NewStream(key, iv, op)
 		if err != nil {
@@ -93,6 +115,9 @@ func (s *SSCipher) Encrypt(src []byte) (result []byte, err error) {
 		s.Stream.XORKeyStream(dst, src)
 		return dst, nil
 	}
+	if s.AEAD2022 {
+		return s.encrypt2022(src)
+	}
 	if s.AEAD != nil {
 		dst := new(bytes.Buffer)
 		r := bytes.NewBuffer(src)
@@ -147,6 +172,10 @@ func (s *SSCipher) Decrypt(ciphertext []byte) (result []byte, err error) {
 		return buf, nil
 	}
 
+	if s.AEAD2022 {
+		return s.decrypt2022(ciphertext)
+	}
+
 	if s.AEAD != nil {
 		overHead := s.AEAD.Overhead()
 		s.AEADReadBuffer.Write(ciphertext)
@@ -216,6 +245,14 @@ type Encryptor struct {
 	IVBuf        *bytes.Buffer
 	EncodeCipher *SSCipher
 	DecodeCipher *SSCipher
+	// udpSessions is the server udp sessions of aead 2022
+	udpSessions udpSessions2022
+	// Users identify the users by identity header of aead 2022 on server, Key is the identity psk.
+	// User is the identified user of tcp request
+	Users *aead2022.Users
+	User  *aead2022.User
+	// packet is set when decrypt udp packet, which skip the replay check
+	packet bool
 }
 
 func NewEncryptor(method, key string) (result *Encryptor, err error) {
@@ -251,6 +288,18 @@ func NewEncryptor(method, key string) (result *Encryptor, err error) {
 		result.IVLen = cp.IVLen()
 	}
 
+	if cp := aead2022.GetAEAD2022Cipher(method); cp != nil {
+		result.Key, err = aead2022.DecodePSK(key, cp.KeySize())
+		if err != nil {
+			return nil, err
+		}
+		result.IVOut = make([]byte, cp.SaltSize())
+		if _, err := io.ReadFull(rand.Reader, result.IVOut); err != nil {
+			return nil, err
+		}
+		result.IVLen = cp.SaltSize()
+	}
+
 	result.EncodeCipher, err = NewCipher(OP_ENCRYPT, method, result.Key, result.IVOut)
 	result.IVBuf = new(bytes.Buffer)
 	return result, err
@@ -276,6 +325,14 @@ func NewEncryptorWithIv(method, key string, iv []byte) (result *Encryptor, err e
 		result.IVLen = cp.IVLen()
 	}
 
+	if cp := aead2022.GetAEAD2022Cipher(method); cp != nil {
+		result.Key, err = aead2022.DecodePSK(key, cp.KeySize())
+		if err != nil {
+			return nil, err
+		}
+		result.IVLen = cp.SaltSize()
+	}
+
 	result.IVOut = iv[:result.IVLen]
 	result.EncodeCipher, err = NewCipher(OP_ENCRYPT, method, result.Key, result.IVOut)
 	result.IVBuf = new(bytes.Buffer)
@@ -283,6 +340,10 @@ func NewEncryptorWithIv(method, key string, iv []byte) (result *Encryptor, err e
 }
 
 func (e *Encryptor) Encrypt(src []byte) (result []byte, err error) {
+	// server response of aead 2022 carry the request salt
+	if e.EncodeCipher.AEAD2022 && !e.IVSent && e.IVIn != nil {
+		e.EncodeCipher.RequestSalt = e.IVIn
+	}
 	result, err = e.EncodeCipher.Encrypt(src)
 	if err != nil {
 		return result, err
@@ -304,26 +365,60 @@ func (e *Encryptor) Decrypt(ciphertext []byte) (result []byte, err error) {
 		return e.DecodeCipher.Decrypt(ciphertext)
 	}
 
-	if e.IVBuf.Len() <= e.IVLen {
+	// the identity header of aead 2022 follows the request salt
+	headLen := e.IVLen
+	if e.Users != nil && !e.IVSent {
+		headLen += aead2022.IdentityHeaderSize
+	}
+	if e.IVBuf.Len() <= headLen {
 		e.IVBuf.Write(ciphertext)
 	}
 
-	if e.IVBuf.Len() > e.IVLen {
+	if e.IVBuf.Len() > headLen {
 		buf := e.IVBuf.Bytes()
 		decipherIV := buf[:e.IVLen]
 		e.IVIn = decipherIV
-		e.DecodeCipher, err = NewCipher(OP_DECRYPT, e.Method, e.Key, decipherIV)
+		key := e.Key
+		if headLen > e.IVLen {
+			if e.User, err = e.Users.OpenIdentityHeader(e.Key, decipherIV, buf[e.IVLen:headLen]); err != nil {
+				return nil, err
+			}
+			// both directions use the user psk
+			key = e.User.PSK
+			if e.EncodeCipher, err = NewCipher(OP_ENCRYPT, e.Method, key, e.IVOut); err != nil {
+				return nil, err
+			}
+		}
+		e.DecodeCipher, err = NewCipher(OP_DECRYPT, e.Method, key, decipherIV)
 		if err != nil {
 			return nil, err
 		}
-		remainBuf := buf[e.IVLen:]
+		if e.DecodeCipher.AEAD2022 {
+			if err := aead2022.CheckSalt(decipherIV); err != nil {
+				return nil, err
+			}
+			// client verify the response carry its request salt
+			if e.IVSent {
+				e.DecodeCipher.RequestSalt = e.IVOut
+			}
+		} else if !e.IVSent && !e.packet {
+			// only the tcp request iv from client is checked
+			if err := checkReplay(decipherIV); err != nil {
+				return nil, err
+			}
+		}
+		remainBuf := buf[headLen:]
 		return e.DecodeCipher.Decrypt(remainBuf)
 	} else {
 		return []byte{}, nil
 	}
 }
 
+// EncryptAll encrypt the udp packet, iv is the client session id if method is aead 2022
 func (e *Encryptor) EncryptAll(src, iv []byte) (result []byte, err error) {
+	if e.IsAEAD2022() {
+		return e.encryptPacket2022(src, iv)
+	}
 	encrypter, err := NewEncryptorWithIv(e.Method, e.KeyStr, iv)
 	if err != nil {
 		return nil, err
@@ -331,11 +426,16 @@ func (e *Encryptor) EncryptAll(src, iv []byte) (result []byte, err error) {
 	return encrypter.Encrypt(src)
 }
 
+// DecryptAll decrypt the udp packet, iv is the client session id if method is aead 2022
 func (e *Encryptor) DecryptAll(ciphertext []byte) (result, iv []byte, err error) {
+	if e.IsAEAD2022() {
+		return e.decryptPacket2022(ciphertext)
+	}
 	encrypter, err := NewEncryptor(e.Method, e.KeyStr)
 	if err != nil {
 		return nil, nil, err
 	}
+	encrypter.packet = true
 	data, err := encrypter.Decrypt(ciphertext)
 	if err != nil {
 		return nil, nil, err
@@ -361,3 +461,8 @@ func (e *Encryptor) MustNewIV() []byte {
 	}
 	return iv
 }
+
+// IsAEAD2022 report whether the method is shadowsocks 2022 edition
+func (e *Encryptor) IsAEAD2022() bool {
+	return aead2022.GetAEAD2022Cipher(e.Method) != nil
+}
@@ -0,0 +1,288 @@
+package ciphers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
+	"github.com/ProxyPanel/VNet-SSR/utils/randomx"
+	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
+	"github.com/pkg/errors"
+)
+
+// encrypt2022 output the fixed length header and the first chunk at first time,
+// client request header carry the socks address with padding, and server response
+// header carry the request salt. after that, the data is split into length and payload chunks
+func (s *SSCipher) encrypt2022(src []byte) ([]byte, error) {
+	dst := new(bytes.Buffer)
+	if !s.HeaderDone {
+		if len(src) == 0 {
+			return []byte{}, nil
+		}
+		var fixedHeader, first []byte
+		if s.RequestSalt == nil {
+			addr, err := socksproxy.SplitAddr(src)
+			if err != nil {
+				return nil, errors.Wrap(err, "aead 2022 request must begin with socks address")
+			}
+			payload := src[len(addr.Raw):]
+			paddingLen := 0
+			if len(payload) == 0 {
+				paddingLen = randomx.RandIntRange(1, aead2022.MaxPaddingLength)
+			}
+			headerLen := len(addr.Raw) + 2 + paddingLen
+			if len(payload) > aead2022.MaxPayloadSize-headerLen {
+				payload = payload[:aead2022.MaxPayloadSize-headerLen]
+			}
+			first = make([]byte, headerLen+len(payload))
+			copy(first, addr.Raw)
+			binary.BigEndian.PutUint16(first[len(addr.Raw):], uint16(paddingLen))
+			if _, err := io.ReadFull(rand.Reader, first[len(addr.Raw)+2:headerLen]); err != nil {
+				return nil, err
+			}
+			copy(first[headerLen:], payload)
+			src = src[len(addr.Raw)+len(payload):]
+
+			fixedHeader = make([]byte, 1+8+2)
+			fixedHeader[0] = aead2022.HeaderTypeClient
+		} else {
+			first = src
+			if len(first) > aead2022.MaxPayloadSize {
+				first = first[:aead2022.MaxPayloadSize]
+			}
+			src = src[len(first):]
+
+			fixedHeader = make([]byte, 1+8+len(s.RequestSalt)+2)
+			fixedHeader[0] = aead2022.HeaderTypeServer
+			copy(fixedHeader[9:], s.RequestSalt)
+		}
+		aead2022.PutTimestamp(fixedHeader[1:9])
+		binary.BigEndian.PutUint16(fixedHeader[len(fixedHeader)-2:], uint16(len(first)))
+		dst.Write(s.AEAD.Seal(nil, s.AEADWriteNonce, fixedHeader, nil))
+		increment(s.AEADWriteNonce)
+		dst.Write(s.AEAD.Seal(nil, s.AEADWriteNonce, first, nil))
+		increment(s.AEADWriteNonce)
+		s.HeaderDone = true
+	}
+
+	for len(src) > 0 {
+		payload := src
+		if len(payload) > aead2022.MaxPayloadSize {
+			payload = payload[:aead2022.MaxPayloadSize]
+		}
+		src = src[len(payload):]
+		size := make([]byte, 2)
+		binary.BigEndian.PutUint16(size, uint16(len(payload)))
+		dst.Write(s.AEAD.Seal(nil, s.AEADWriteNonce, size, nil))
+		increment(s.AEADWriteNonce)
+		dst.Write(s.AEAD.Seal(nil, s.AEADWriteNonce, payload, nil))
+		increment(s.AEADWriteNonce)
+	}
+	return dst.Bytes(), nil
+}
+
+// decrypt2022 verify the fixed length header at first time, the first chunk of client
+// request is the variable length header, its padding is removed so the result is
+// socks address followed by payload, same as other ciphers
+func (s *SSCipher) decrypt2022(ciphertext []byte) ([]byte, error) {
+	overHead := s.AEAD.Overhead()
+	s.AEADReadBuffer.Write(ciphertext)
+	dst := new(bytes.Buffer)
+	for {
+		if !s.HeaderDone {
+			fixedLen := 1 + 8 + len(s.RequestSalt) + 2 + overHead
+			if s.AEADReadBuffer.Len() < fixedLen {
+				return nil, errors.New("head buf is too short")
+			}
+			fixedHeader, err := s.AEAD.Open(nil, s.AEADReadNonce, s.AEADReadBuffer.Next(fixedLen), nil)
+			if err != nil {
+				return nil, err
+			}
+			increment(s.AEADReadNonce)
+			if s.RequestSalt == nil && fixedHeader[0] != aead2022.HeaderTypeClient ||
+				s.RequestSalt != nil && fixedHeader[0] != aead2022.HeaderTypeServer {
+				return nil, aead2022.ErrBadHeader
+			}
+			if err := aead2022.CheckTimestamp(binary.BigEndian.Uint64(fixedHeader[1:9])); err != nil {
+				return nil, err
+			}
+			if s.RequestSalt != nil && !bytes.Equal(fixedHeader[9:9+len(s.RequestSalt)], s.RequestSalt) {
+				return nil, errors.New("aead 2022 request salt mismatch")
+			}
+			s.HeadSize = int(binary.BigEndian.Uint16(fixedHeader[len(fixedHeader)-2:]))
+			s.VariableHeader = s.RequestSalt == nil
+			s.HeaderDone = true
+		}
+
+		if s.HeadSize == 0 {
+			if s.AEADReadBuffer.Len() == 0 {
+				break
+			}
+			if s.AEADReadBuffer.Len() < 2+overHead {
+				if dst.Len() > 0 {
+					return dst.Bytes(), nil
+				}
+				return nil, errors.New("head buf is too short")
+			}
+			size, err := s.AEAD.Open(nil, s.AEADReadNonce, s.AEADReadBuffer.Next(2+overHead), nil)
+			if err != nil {
+				return nil, err
+			}
+			increment(s.AEADReadNonce)
+			s.HeadSize = int(binary.BigEndian.Uint16(size))
+		}
+
+		if s.AEADReadBuffer.Len() < s.HeadSize+overHead {
+			if dst.Len() > 0 {
+				return dst.Bytes(), nil
+			}
+			return nil, errors.New("buf is too short")
+		}
+		result, err := s.AEAD.Open(nil, s.AEADReadNonce, s.AEADReadBuffer.Next(s.HeadSize+overHead), nil)
+		if err != nil {
+			return nil, err
+		}
+		increment(s.AEADReadNonce)
+		if s.VariableHeader {
+			addr, err := socksproxy.SplitAddr(result)
+			if err != nil {
+				return nil, errors.Wrap(err, "aead 2022 variable header address error")
+			}
+			rest := result[len(addr.Raw):]
+			if len(rest) < 2 || len(rest) < 2+int(binary.BigEndian.Uint16(rest)) {
+				return nil, errors.New("aead 2022 variable header padding error")
+			}
+			dst.Write(addr.Raw)
+			result = rest[2+int(binary.BigEndian.Uint16(rest)):]
+			s.VariableHeader = false
+		}
+		dst.Write(result)
+		s.HeadSize = 0
+	}
+	return dst.Bytes(), nil
+}
+
+// udpSessionTimeout is the idle time to remove the server session, packets of a removed
+// session are older than the timestamp tolerance, so they can not be replayed to a new one
+const udpSessionTimeout = 2 * aead2022.TimestampTolerance
+
+// udpSession2022 is the server session of a client session
+type udpSession2022 struct {
+	sync.Mutex
+	id       []byte
+	packetID uint64
+	window   aead2022.ReplayWindow
+	lastSeen time.Time
+	// user is identified by the identity header, nil if the server has no users
+	user *aead2022.User
+}
+
+// udpSessions2022 is the server sessions of a listener keyed by client session id
+type udpSessions2022 struct {
+	sync.Mutex
+	sessions  map[string]*udpSession2022
+	lastClean time.Time
+}
+
+// get return the server session of client session, create it if create is true
+func (s *udpSessions2022) get(clientSessionID []byte, create bool) (*udpSession2022, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	if session, ok := s.sessions[string(clientSessionID)]; ok {
+		session.lastSeen = now
+		return session, nil
+	}
+	if !create {
+		return nil, errors.New("aead 2022 udp session not found")
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]*udpSession2022)
+	}
+	if now.Sub(s.lastClean) > udpSessionTimeout {
+		for key, session := range s.sessions {
+			if now.Sub(session.lastSeen) > udpSessionTimeout {
+				delete(s.sessions, key)
+			}
+		}
+		s.lastClean = now
+	}
+	session := &udpSession2022{id: make([]byte, aead2022.SessionIDSize), lastSeen: now}
+	if _, err := io.ReadFull(rand.Reader, session.id); err != nil {
+		return nil, err
+	}
+	s.sessions[string(clientSessionID)] = session
+	return session, nil
+}
+
+// encryptPacket2022 seal the udp data as server packet to the client session
+func (e *Encryptor) encryptPacket2022(src, clientSessionID []byte) ([]byte, error) {
+	session, err := e.udpSessions.get(clientSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	session.Lock()
+	packetID := session.packetID
+	session.packetID++
+	session.Unlock()
+	psk := e.Key
+	if session.user != nil {
+		psk = session.user.PSK
+	}
+	cp := aead2022.GetAEAD2022Cipher(e.Method)
+	body := aead2022.PackPacketBody(aead2022.HeaderTypeServer, clientSessionID, src)
+	return cp.SealPacket(psk, session.id, packetID, body)
+}
+
+// decryptPacket2022 open the udp client packet, the client session id is returned as iv.
+// each client session has its own server session and replay window of packet id
+func (e *Encryptor) decryptPacket2022(ciphertext []byte) (result, sessionID []byte, err error) {
+	var user *aead2022.User
+	var packetID uint64
+	var body []byte
+	if e.Users != nil {
+		cp := aead2022.GetIdentityCipher(e.Method)
+		if cp == nil {
+			return nil, nil, errors.Errorf("%s does not support identity header", e.Method)
+		}
+		user, sessionID, packetID, body, err = cp.OpenIdentityPacket(e.Key, e.Users, ciphertext)
+	} else {
+		sessionID, packetID, body, err = aead2022.GetAEAD2022Cipher(e.Method).OpenPacket(e.Key, ciphertext)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	_, result, err = aead2022.UnpackPacketBody(aead2022.HeaderTypeClient, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := e.udpSessions.get(sessionID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.Lock()
+	defer session.Unlock()
+	if session.user != nil && session.user.ID != user.ID {
+		return nil, nil, errors.New("aead 2022 udp session belongs to other user")
+	}
+	if !session.window.Check(packetID) {
+		return nil, nil, aead2022.ErrPacketReplay
+	}
+	session.user = user
+	return result, sessionID, nil
+}
+
+// SessionUser return the user identified by the udp client session, nil if it is unknown
+func (e *Encryptor) SessionUser(clientSessionID []byte) *aead2022.User {
+	session, err := e.udpSessions.get(clientSessionID, false)
+	if err != nil {
+		return nil
+	}
+	session.Lock()
+	defer session.Unlock()
+	return session.user
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/utils/bloomx"
 	"github.com/ProxyPanel/VNet-SSR/utils/bytesx"
+	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
 	"strings"
 	"testing"
 )
@@ -272,3 +276,307 @@ func ExampleNewCBCDecrypter() {
 }
 
 
+
+func TestEncryptorAEAD2022(t *testing.T) {
+	for _, method := range []string{"2022-blake3-aes-128-gcm", "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305"} {
+		t.Run(method, func(t *testing.T) {
+			keySize := aead2022.GetAEAD2022Cipher(method).KeySize()
+			psk := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{9}, keySize))
+			if _, err := NewEncryptor(method, "killer"); err == nil {
+				t.Fatal("NewEncryptor() with plain password want error")
+			}
+			client, err := NewEncryptor(method, psk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server, err := NewEncryptor(method, psk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			addr := []byte{socksproxy.AtypIPv4, 127, 0, 0, 1, 0, 80}
+			request, err := client.Encrypt(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload := bytes.Repeat([]byte("a"), 0x10000+10)
+			more, err := client.Encrypt(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// feed byte by byte across the fixed header
+			var got []byte
+			for _, b := range request[:40] {
+				result, err := server.Decrypt([]byte{b})
+				if err != nil && !strings.Contains(err.Error(), "buf is too short") {
+					t.Fatal(err)
+				}
+				got = append(got, result...)
+			}
+			result, err := server.Decrypt(bytesx.ContactSlice(request[40:], more))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, result...)
+			if !bytes.Equal(got, bytesx.ContactSlice(addr, payload)) {
+				t.Fatalf("server decrypt length %v, want %v", len(got), len(addr)+len(payload))
+			}
+
+			response, err := server.Encrypt([]byte("response"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = client.Decrypt(response)
+			if err != nil || string(got) != "response" {
+				t.Fatalf("client decrypt = %q, %v", got, err)
+			}
+
+			replay, _ := NewEncryptor(method, psk)
+			if _, err := replay.Decrypt(request); err != aead2022.ErrSaltReplay {
+				t.Errorf("replay request error = %v", err)
+			}
+		})
+	}
+}
+
+func TestEncryptorAEAD2022Packet(t *testing.T) {
+	method := "2022-blake3-aes-128-gcm"
+	psk := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{9}, 16))
+	server, err := NewEncryptor(method, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := aead2022.GetAEAD2022Cipher(method)
+	clientSessionID := []byte("session1")
+	data := []byte{socksproxy.AtypIPv4, 8, 8, 8, 8, 0, 53, 1, 2, 3}
+	packet, err := cp.SealPacket(server.Key, clientSessionID, 0, aead2022.PackPacketBody(aead2022.HeaderTypeClient, nil, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, iv, err := server.DecryptAll(packet)
+	if err != nil || !bytes.Equal(got, data) || !bytes.Equal(iv, clientSessionID) {
+		t.Fatalf("DecryptAll() = %x, %x, %v", got, iv, err)
+	}
+	if _, _, err := server.DecryptAll(packet); err != aead2022.ErrPacketReplay {
+		t.Errorf("DecryptAll() replay error = %v", err)
+	}
+	// packets out of order in the window are accepted once
+	for _, tt := range []struct {
+		packetID uint64
+		err      error
+	}{{5, nil}, {3, nil}, {3, aead2022.ErrPacketReplay}} {
+		packet, err := cp.SealPacket(server.Key, clientSessionID, tt.packetID, aead2022.PackPacketBody(aead2022.HeaderTypeClient, nil, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := server.DecryptAll(packet); err != tt.err {
+			t.Errorf("DecryptAll() packet %v error = %v, want %v", tt.packetID, err, tt.err)
+		}
+	}
+
+	response, err := server.EncryptAll(data, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, packetID, body, err := cp.OpenPacket(server.Key, response)
+	if err != nil || packetID != 0 {
+		t.Fatalf("OpenPacket() = %x, %v, %v", sessionID, packetID, err)
+	}
+	gotClientSessionID, got, err := aead2022.UnpackPacketBody(aead2022.HeaderTypeServer, body)
+	if err != nil || !bytes.Equal(got, data) || !bytes.Equal(gotClientSessionID, clientSessionID) {
+		t.Errorf("UnpackPacketBody() = %x, %x, %v", gotClientSessionID, got, err)
+	}
+
+	// the other client session has its own server session and packet id
+	otherSessionID := []byte("session2")
+	packet, err = cp.SealPacket(server.Key, otherSessionID, 0, aead2022.PackPacketBody(aead2022.HeaderTypeClient, nil, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.DecryptAll(packet); err != nil {
+		t.Fatalf("DecryptAll() other session error = %v", err)
+	}
+	response, err = server.EncryptAll(data, otherSessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherServerSessionID, packetID, _, err := cp.OpenPacket(server.Key, response)
+	if err != nil || packetID != 0 || bytes.Equal(otherServerSessionID, sessionID) {
+		t.Errorf("OpenPacket() other session = %x, %v, %v", otherServerSessionID, packetID, err)
+	}
+	if _, err := server.EncryptAll(data, []byte("session3")); err == nil {
+		t.Error("EncryptAll() to unknown session should fail")
+	}
+}
+
+func TestEncryptorAEAD2022Identity(t *testing.T) {
+	method := "2022-blake3-aes-128-gcm"
+	ipsk, upsk := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 16)
+	users := aead2022.NewUsers()
+	users.Set(7, upsk)
+	server, err := NewEncryptor(method, base64.StdEncoding.EncodeToString(ipsk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Users = users
+
+	// client session use user psk, the identity header is inserted after salt
+	client, err := NewEncryptor(method, base64.StdEncoding.EncodeToString(upsk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := []byte{socksproxy.AtypIPv4, 127, 0, 0, 1, 0, 80, 'h', 'i'}
+	request, err := client.Encrypt(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := aead2022.SealIdentityHeader(ipsk, upsk, client.IVOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := server.Decrypt(bytesx.ContactSlice(client.IVOut, header, request[len(client.IVOut):]))
+	if err != nil || !bytes.Equal(got, addr) || server.User == nil || server.User.ID != 7 {
+		t.Fatalf("server decrypt = %x, %+v, %v", got, server.User, err)
+	}
+	response, err := server.Encrypt([]byte("response"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = client.Decrypt(response); err != nil || string(got) != "response" {
+		t.Fatalf("client decrypt = %q, %v", got, err)
+	}
+	// request of unknown user is rejected
+	other, _ := NewEncryptor(method, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 16)))
+	request, _ = other.Encrypt(addr)
+	header, _ = aead2022.SealIdentityHeader(ipsk, bytes.Repeat([]byte{3}, 16), other.IVOut)
+	server, _ = NewEncryptor(method, base64.StdEncoding.EncodeToString(ipsk))
+	server.Users = users
+	if _, err := server.Decrypt(bytesx.ContactSlice(other.IVOut, header, request[len(other.IVOut):])); err != aead2022.ErrUnknownUser {
+		t.Errorf("unknown user error = %v", err)
+	}
+
+	// udp response use user psk without identity header
+	cp := aead2022.GetIdentityCipher(method)
+	clientSessionID := []byte("session1")
+	packet, err := cp.SealIdentityPacket(ipsk, upsk, clientSessionID, 0, aead2022.PackPacketBody(aead2022.HeaderTypeClient, nil, addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, iv, err := server.DecryptAll(packet)
+	if err != nil || !bytes.Equal(got, addr) {
+		t.Fatalf("DecryptAll() = %x, %v", got, err)
+	}
+	if user := server.SessionUser(iv); user == nil || user.ID != 7 {
+		t.Fatalf("SessionUser() = %+v", user)
+	}
+	response, err = server.EncryptAll(addr, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := aead2022.GetAEAD2022Cipher(method).OpenPacket(upsk, response); err != nil {
+		t.Errorf("OpenPacket() with user psk error = %v", err)
+	}
+}
+
+// the vectors are generated by openssl enc and libsodium, the plain text is
+// "shadowsocksr legacy cipher vector"
+func TestNewCipher_Vectors(t *testing.T) {
+	plaintext := []byte("shadowsocksr legacy cipher vector")
+	tests := []struct {
+		method     string
+		key        string
+		iv         string
+		ciphertext string
+	}{
+		{"aes-128-cfb8", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "2d74ebd6d137512ff7b36bb06bd6635c0562de6f3d26e1e642badf3942a6448260"},
+		{"aes-192-cfb8", "000102030405060708090a0b0c0d0e0f1011121314151617", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "8d73555a09d53f44f8917ed19670797898f1906182013d720b928cdeb93085f39b"},
+		{"aes-256-cfb8", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "afbc9508c72f71a835bfba25a54baf0e6565749b4d895fb2db89277576bdd66bc0"},
+		{"aes-128-cfb1", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "36ebb170495d159bfdb3536169a6c22eec9c1ee4fc2e33ac43a283688a227aaf10"},
+		{"aes-192-cfb1", "000102030405060708090a0b0c0d0e0f1011121314151617", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "fc5eb90c7b5d7c49a8459d01bed37822ed5230de93fe23b6952752722ca08eb1d6"},
+		{"aes-256-cfb1", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "f42e6e182b2ad7368ceaebe9d493cbd4211e06bc092e347536e9bad00e3e3fd166"},
+		{"camellia-128-cfb", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "e6b263daa66d3308c168fae456a71fe5ce5fb1682726c4453318f6266683d09fad"},
+		{"camellia-192-cfb", "000102030405060708090a0b0c0d0e0f1011121314151617", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "96f300873aa0f3c2713b998e97841731f0b72dc7f0902d0f8d61bbc99340f0f89d"},
+		{"camellia-256-cfb", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "8b0cc635fc5aa13c589c36dfd6dc03f2998d6343fdd196bc2b95710b1d8ac955a1"},
+		{"idea-cfb", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7", "abf09ad7f1e6845ccdaef1fa4bf5e7abbe3c41535d029494e315ea4cb2f60ee175"},
+		{"seed-cfb", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeaf", "6e5963085cf924fe5042874f103a2a8d154fb69d735a8753c47840cd0d228af426"},
+		{"rc2-cfb", "000102030405060708090a0b0c0d0e0f", "a0a1a2a3a4a5a6a7", "bc8731300c2be4d9b1431f55d38ad3c29b68149b6dd12d92c610259b5cbccd57dd"},
+		{"salsa20-ctr", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7", "66a9009a9cfb891cf51c7963ff973e96a65c51347cd81739110ecf949f7c0282a3"},
+		{"chacha20-ietf", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7a8a9aaab", "84d29680a36c8dc1c08efb2cb9a645f83369a7875af00a5d1af78b18716305f82b"},
+		{"xchacha20-ietf-poly1305", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf", "305d6f15fa107d3e49792406ab2604f7b3e23b4c5abd9edc59bb36f152a6af6b3ef0e265c47753eff5429e7dff19791877a4a57115945939e22e25ec5412cd8ce21a3a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			key, iv := bytesx.MustHexDecode(tt.key), bytesx.MustHexDecode(tt.iv)
+			encipher, err := NewCipher(OP_ENCRYPT, tt.method, key, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []byte
+			if encipher.Stream != nil {
+				// stream cipher must keep its state between calls
+				for _, part := range [][]byte{plaintext[:7], plaintext[7:]} {
+					out, err := encipher.Encrypt(part)
+					if err != nil {
+						t.Fatal(err)
+					}
+					result = append(result, out...)
+				}
+			} else if result, err = encipher.Encrypt(plaintext); err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(result) != tt.ciphertext {
+				t.Fatalf("Encrypt() = %x, want %s", result, tt.ciphertext)
+			}
+
+			decipher, err := NewCipher(OP_DECRYPT, tt.method, key, iv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err = decipher.Decrypt(bytesx.MustHexDecode(tt.ciphertext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, plaintext) {
+				t.Fatalf("Decrypt() = %q, want %q", result, plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptorReplay(t *testing.T) {
+	SetReplayFilter(bloomx.NewRotatingFilter(1000, 0.000001))
+	defer SetReplayFilter(nil)
+
+	client, err := NewEncryptor("aes-256-cfb", "killer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := client.Encrypt([]byte("first packet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := ReplayCount()
+	for i := 0; i < 2; i++ {
+		server, err := NewEncryptor("aes-256-cfb", "killer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = server.Decrypt(request)
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && err != ErrReplay {
+			t.Fatalf("Decrypt() replayed request error = %v, want %v", err, ErrReplay)
+		}
+	}
+	if ReplayCount() != count+1 {
+		t.Fatalf("ReplayCount() = %v, want %v", ReplayCount(), count+1)
+	}
+
+	// the iv of udp packet is not checked
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.DecryptAll(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
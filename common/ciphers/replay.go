@@ -0,0 +1,47 @@
+package ciphers
+
+import (
+	"sync/atomic"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/bloomx"
+	"github.com/pkg/errors"
+)
+
+// ErrReplay is returned by Encryptor.Decrypt when the iv or salt of a request has been seen
+var ErrReplay = errors.New("iv or salt is replayed")
+
+var (
+	replayFilter atomic.Value
+	replayCount  uint64
+)
+
+// SetReplayFilter enable the iv replay check of stream, aead and block ciphers,
+// nil disable it. aead 2022 has its own salt check by timestamp
+func SetReplayFilter(filter *bloomx.RotatingFilter) {
+	replayFilter.Store(&filter)
+}
+
+// GetReplayFilter return the replay filter in use, nil if disabled
+func GetReplayFilter() *bloomx.RotatingFilter {
+	if filter, ok := replayFilter.Load().(**bloomx.RotatingFilter); ok {
+		return *filter
+	}
+	return nil
+}
+
+// ReplayCount return the number of rejected replay requests
+func ReplayCount() uint64 {
+	return atomic.LoadUint64(&replayCount)
+}
+
+func checkReplay(iv []byte) error {
+	filter := GetReplayFilter()
+	if filter == nil || len(iv) == 0 {
+		return nil
+	}
+	if filter.TestAndAdd(iv) {
+		atomic.AddUint64(&replayCount, 1)
+		return ErrReplay
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+func init() {
+	registerStreamCiphers("aes-128-cfb8", &aes_cfb8{16, 16})
+	registerStreamCiphers("aes-192-cfb8", &aes_cfb8{24, 16})
+	registerStreamCiphers("aes-256-cfb8", &aes_cfb8{32, 16})
+	registerStreamCiphers("aes-128-cfb1", &aes_cfb1{16, 16})
+	registerStreamCiphers("aes-192-cfb1", &aes_cfb1{24, 16})
+	registerStreamCiphers("aes-256-cfb1", &aes_cfb1{32, 16})
+}
+
+type aes_cfb8 struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *aes_cfb8) KeyLen() int {
+	return a.keyLen
+}
+func (a *aes_cfb8) IVLen() int {
+	return a.ivLen
+}
+func (a *aes_cfb8) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return newCFB8(block, iv, decryptOrEncrypt != 0), nil
+}
+
+type aes_cfb1 struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *aes_cfb1) KeyLen() int {
+	return a.keyLen
+}
+func (a *aes_cfb1) IVLen() int {
+	return a.ivLen
+}
+func (a *aes_cfb1) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return newCFB1(block, iv, decryptOrEncrypt != 0), nil
+}
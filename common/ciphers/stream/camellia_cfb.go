@@ -0,0 +1,36 @@
+package stream
+
+import (
+	"crypto/cipher"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/cryptox/camellia"
+)
+
+func init() {
+	registerStreamCiphers("camellia-128-cfb", &camellia_cfb{16, 16})
+	registerStreamCiphers("camellia-192-cfb", &camellia_cfb{24, 16})
+	registerStreamCiphers("camellia-256-cfb", &camellia_cfb{32, 16})
+}
+
+type camellia_cfb struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *camellia_cfb) KeyLen() int {
+	return a.keyLen
+}
+func (a *camellia_cfb) IVLen() int {
+	return a.ivLen
+}
+func (a *camellia_cfb) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := camellia.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if decryptOrEncrypt == 0 {
+		return cipher.NewCFBEncrypter(block, iv), nil
+	} else {
+		return cipher.NewCFBDecrypter(block, iv), nil
+	}
+}
@@ -0,0 +1,77 @@
+package stream
+
+import "crypto/cipher"
+
+// cfb8 is the cipher feedback mode with 8 bits segment
+type cfb8 struct {
+	b       cipher.Block
+	next    []byte
+	out     []byte
+	decrypt bool
+}
+
+func newCFB8(block cipher.Block, iv []byte, decrypt bool) cipher.Stream {
+	next := make([]byte, block.BlockSize())
+	copy(next, iv)
+	return &cfb8{
+		b:       block,
+		next:    next,
+		out:     make([]byte, block.BlockSize()),
+		decrypt: decrypt,
+	}
+}
+
+func (x *cfb8) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		x.b.Encrypt(x.out, x.next)
+		c := src[i]
+		dst[i] = src[i] ^ x.out[0]
+		if !x.decrypt {
+			c = dst[i]
+		}
+		copy(x.next, x.next[1:])
+		x.next[len(x.next)-1] = c
+	}
+}
+
+// cfb1 is the cipher feedback mode with 1 bit segment
+type cfb1 struct {
+	b       cipher.Block
+	next    []byte
+	out     []byte
+	decrypt bool
+}
+
+func newCFB1(block cipher.Block, iv []byte, decrypt bool) cipher.Stream {
+	next := make([]byte, block.BlockSize())
+	copy(next, iv)
+	return &cfb1{
+		b:       block,
+		next:    next,
+		out:     make([]byte, block.BlockSize()),
+		decrypt: decrypt,
+	}
+}
+
+func (x *cfb1) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		in := src[i]
+		var out byte
+		for bit := 7; bit >= 0; bit-- {
+			x.b.Encrypt(x.out, x.next)
+			inBit := in >> uint(bit) & 1
+			outBit := inBit ^ x.out[0]>>7
+			out |= outBit << uint(bit)
+			c := outBit
+			if x.decrypt {
+				c = inBit
+			}
+			// shift the register left by 1 bit and append the cipher bit
+			for j := 0; j < len(x.next)-1; j++ {
+				x.next[j] = x.next[j]<<1 | x.next[j+1]>>7
+			}
+			x.next[len(x.next)-1] = x.next[len(x.next)-1]<<1 | c
+		}
+		dst[i] = out
+	}
+}
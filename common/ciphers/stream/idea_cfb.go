@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"crypto/cipher"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/cryptox/idea"
+)
+
+func init() {
+	registerStreamCiphers("idea-cfb", &idea_cfb{16, 8})
+}
+
+type idea_cfb struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *idea_cfb) KeyLen() int {
+	return a.keyLen
+}
+func (a *idea_cfb) IVLen() int {
+	return a.ivLen
+}
+func (a *idea_cfb) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := idea.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if decryptOrEncrypt == 0 {
+		return cipher.NewCFBEncrypter(block, iv), nil
+	} else {
+		return cipher.NewCFBDecrypter(block, iv), nil
+	}
+}
@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"crypto/cipher"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/cryptox/rc2"
+)
+
+func init() {
+	registerStreamCiphers("rc2-cfb", &rc2_cfb{16, 8})
+}
+
+type rc2_cfb struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *rc2_cfb) KeyLen() int {
+	return a.keyLen
+}
+func (a *rc2_cfb) IVLen() int {
+	return a.ivLen
+}
+func (a *rc2_cfb) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := rc2.New(key, 128)
+	if err != nil {
+		return nil, err
+	}
+	if decryptOrEncrypt == 0 {
+		return cipher.NewCFBEncrypter(block, iv), nil
+	} else {
+		return cipher.NewCFBDecrypter(block, iv), nil
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 func init() {
 	registerStreamCiphers("salsa20", &salsa20{32, 8})
+	registerStreamCiphers("salsa20-ctr", &salsa20{32, 8})
 }
 
 type salsa20 struct {
@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"crypto/cipher"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/cryptox/seed"
+)
+
+func init() {
+	registerStreamCiphers("seed-cfb", &seed_cfb{16, 16})
+}
+
+type seed_cfb struct {
+	keyLen int
+	ivLen  int
+}
+
+func (a *seed_cfb) KeyLen() int {
+	return a.keyLen
+}
+func (a *seed_cfb) IVLen() int {
+	return a.ivLen
+}
+func (a *seed_cfb) NewStream(key, iv []byte, decryptOrEncrypt int) (cipher.Stream, error) {
+	block, err := seed.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if decryptOrEncrypt == 0 {
+		return cipher.NewCFBEncrypter(block, iv), nil
+	} else {
+		return cipher.NewCFBDecrypter(block, iv), nil
+	}
+}
@@ -1,5 +1,7 @@
 package common
 
+import "github.com/ProxyPanel/VNet-SSR/common/audit"
+
 type TrafficReport interface{
 	Upload(uid int,n int64)
 	Download(uid int,n int64)
@@ -8,4 +10,11 @@ type TrafficReport interface{
 
 type OnlineReport interface{
 	Online(uid int,ip string)
-}
\ No newline at end of file
+}
+
+// AccessLog record the finished tcp sessions and udp nat entries, proxy fill the uid of record
+// by PortToUid when session starts, so it is kept after user is removed
+type AccessLog interface {
+	PortToUid(port int) int
+	Access(record *audit.Record)
+}
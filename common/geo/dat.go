@@ -0,0 +1,243 @@
+package geo
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ProxyPanel/VNet-SSR/common/matcher"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DomainType is the match type of geosite domain
+type DomainType int
+
+// geosite domain types, same as v2ray
+const (
+	// DomainPlain match domain contains the value
+	DomainPlain DomainType = iota
+	// DomainRegex match domain with regex value
+	DomainRegex
+	// DomainRoot match the domain and its subdomains
+	DomainRoot
+	// DomainFull match the same domain
+	DomainFull
+)
+
+// Domain is a domain of geosite list
+type Domain struct {
+	Type  DomainType
+	Value string
+	// Attrs are the attribute keys of domain, such as cn or ads
+	Attrs []string
+}
+
+var errDat = errors.New("dat file is broken")
+
+// rangeFields call fn with each field of protobuf message, value is the bytes of length
+// delimited field or the varint
+func rangeFields(b []byte, fn func(num protowire.Number, value []byte, varint uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errDat
+		}
+		b = b[n:]
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errDat
+		}
+		b = b[n:]
+		if err := fn(num, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntries index the entries of GeoIPList or GeoSiteList by lower country code,
+// both are messages of repeated entry = 1 which start with country_code = 1
+func indexEntries(buf []byte) (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	err := rangeFields(buf, func(num protowire.Number, entry []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		return rangeFields(entry, func(num protowire.Number, value []byte, _ uint64) error {
+			if num == 1 {
+				entries[strings.ToLower(string(value))] = entry
+			}
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// datIP is the v2ray geoip.dat, cidrs of a code are compiled when it is used first
+type datIP struct {
+	entries map[string][]byte
+	sync.RWMutex
+	trees map[string]*datIPTree
+}
+
+type datIPTree struct {
+	*matcher.CIDRTree
+	reverse bool
+}
+
+func parseDatIP(buf []byte) (*datIP, error) {
+	entries, err := indexEntries(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &datIP{entries: entries, trees: make(map[string]*datIPTree)}, nil
+}
+
+func (db *datIP) tree(code string) (*datIPTree, error) {
+	db.RLock()
+	tree, ok := db.trees[code]
+	db.RUnlock()
+	if ok {
+		return tree, nil
+	}
+	db.Lock()
+	defer db.Unlock()
+	if tree, ok := db.trees[code]; ok {
+		return tree, nil
+	}
+	entry, ok := db.entries[code]
+	if !ok {
+		return nil, errors.Errorf("geoip %s not found", code)
+	}
+	tree = &datIPTree{CIDRTree: matcher.NewCIDRTree()}
+	err := rangeFields(entry, func(num protowire.Number, value []byte, varint uint64) error {
+		switch num {
+		case 2:
+			return addDatCIDR(tree.CIDRTree, value)
+		case 3:
+			tree.reverse = varint != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.trees[code] = tree
+	return tree, nil
+}
+
+// addDatCIDR add CIDR message of ip = 1 and prefix = 2
+func addDatCIDR(tree *matcher.CIDRTree, cidr []byte) error {
+	var ip net.IP
+	var prefix uint64
+	err := rangeFields(cidr, func(num protowire.Number, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			ip = net.IP(value)
+		case 2:
+			prefix = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bits := len(ip) * 8
+	if (bits != 32 && bits != 128) || int(prefix) > bits {
+		return errDat
+	}
+	tree.Insert(&net.IPNet{IP: ip, Mask: net.CIDRMask(int(prefix), bits)}, 0)
+	return nil
+}
+
+func (db *datIP) Contains(code string, ip net.IP) bool {
+	tree, err := db.tree(strings.ToLower(code))
+	if err != nil {
+		return false
+	}
+	_, ok := tree.Lookup(ip)
+	return ok != tree.reverse
+}
+
+// SiteDB is the v2ray geosite.dat
+type SiteDB struct {
+	entries map[string][]byte
+}
+
+func parseSiteDB(buf []byte) (*SiteDB, error) {
+	entries, err := indexEntries(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &SiteDB{entries: entries}, nil
+}
+
+// Domains return the domains of code, code@attr only return the domains with attribute attr
+func (db *SiteDB) Domains(code string) ([]Domain, error) {
+	code = strings.ToLower(code)
+	attr := ""
+	if i := strings.IndexByte(code, '@'); i != -1 {
+		code, attr = code[:i], code[i+1:]
+	}
+	entry, ok := db.entries[code]
+	if !ok {
+		return nil, errors.Errorf("geosite %s not found", code)
+	}
+	var domains []Domain
+	err := rangeFields(entry, func(num protowire.Number, value []byte, _ uint64) error {
+		if num != 2 {
+			return nil
+		}
+		domain, err := parseDatDomain(value)
+		if err != nil {
+			return err
+		}
+		if attr == "" || domain.hasAttr(attr) {
+			domains = append(domains, domain)
+		}
+		return nil
+	})
+	return domains, err
+}
+
+// parseDatDomain parse Domain message of type = 1, value = 2 and repeated attribute = 3
+func parseDatDomain(b []byte) (Domain, error) {
+	var domain Domain
+	err := rangeFields(b, func(num protowire.Number, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			domain.Type = DomainType(varint)
+		case 2:
+			domain.Value = string(value)
+		case 3:
+			// attribute key = 1
+			return rangeFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				if num == 1 {
+					domain.Attrs = append(domain.Attrs, strings.ToLower(string(value)))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return domain, err
+}
+
+func (d Domain) hasAttr(attr string) bool {
+	for _, item := range d.Attrs {
+		if item == attr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+// Package geo read the geoip database of MaxMind mmdb or v2ray geoip.dat, and the v2ray geosite.dat
+package geo
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// IPDB is a geoip database
+type IPDB interface {
+	// Contains report whether ip is in the list of country code
+	Contains(code string, ip net.IP) bool
+}
+
+// OpenIPDB open mmdb or geoip.dat at path, the format is detected by content
+func OpenIPDB(path string) (IPDB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read geoip file error")
+	}
+	if isMMDB(buf) {
+		db, err := parseMMDB(buf)
+		return db, errors.Wrap(err, "parse mmdb error")
+	}
+	db, err := parseDatIP(buf)
+	return db, errors.Wrap(err, "parse geoip.dat error")
+}
+
+// OpenSiteDB open geosite.dat at path
+func OpenSiteDB(path string) (*SiteDB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read geosite file error")
+	}
+	db, err := parseSiteDB(buf)
+	return db, errors.Wrap(err, "parse geosite.dat error")
+}
@@ -0,0 +1,173 @@
+package geo
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mmdb data types and the zero bytes between search tree and data section
+const (
+	mmdbPointer       = 1
+	mmdbString        = 2
+	mmdbUint16        = 5
+	mmdbMap           = 7
+	mmdbDataSeparator = 16
+)
+
+// mmdbValue encode value of mmdb data section, only string, uint and map are supported
+func mmdbValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return append([]byte{mmdbString<<5 | byte(len(v))}, v...)
+	case uint16:
+		return []byte{mmdbUint16<<5 | 2, byte(v >> 8), byte(v)}
+	case map[string]interface{}:
+		b := []byte{mmdbMap<<5 | byte(len(v))}
+		for key, item := range v {
+			b = append(b, mmdbValue(key)...)
+			b = append(b, mmdbValue(item)...)
+		}
+		return b
+	}
+	panic("unsupported value")
+}
+
+// testMMDB build an ipv4 db with record size 24, 1.0.0.0/8 is au and 2.0.0.0/7 is a pointer to au
+func testMMDB() []byte {
+	const nodeCount = 8
+	record := func(v uint) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }
+	data := mmdbValue(map[string]interface{}{"country": map[string]interface{}{"iso_code": "AU"}})
+	pointer := []byte{mmdbPointer << 5, 0}
+	var tree []byte
+	// 1 is 00000001 and 2 is 00000010
+	for i := 0; i < 6; i++ {
+		tree = append(tree, record(uint(i+1))...)
+		tree = append(tree, record(nodeCount)...)
+	}
+	tree = append(tree, record(7)...)
+	tree = append(tree, record(nodeCount+mmdbDataSeparator+uint(len(data)))...)
+	tree = append(tree, record(nodeCount)...)
+	tree = append(tree, record(nodeCount+mmdbDataSeparator)...)
+	buf := append(tree, make([]byte, mmdbDataSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, pointer...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, mmdbValue(map[string]interface{}{
+		"node_count":  uint16(nodeCount),
+		"record_size": uint16(24),
+		"ip_version":  uint16(4),
+	})...)
+	return buf
+}
+
+func TestMMDB(t *testing.T) {
+	db, err := parseMMDB(testMMDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]string{
+		"1.2.3.4":     "au",
+		"2.2.3.4":     "au",
+		"3.2.3.4":     "au",
+		"4.2.3.4":     "",
+		"2001:db8::1": "",
+	} {
+		if country := db.Country(net.ParseIP(ip)); country != want {
+			t.Fatalf("country of %v = %v, want %v", ip, country, want)
+		}
+	}
+	if !db.Contains("AU", net.ParseIP("1.1.1.1")) {
+		t.Fatal("1.1.1.1 is not in au")
+	}
+}
+
+func message(fields ...[]byte) []byte {
+	var b []byte
+	for _, field := range fields {
+		b = append(b, field...)
+	}
+	return b
+}
+
+func bytesField(num protowire.Number, value []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(nil, num, protowire.BytesType), value)
+}
+
+func varintField(num protowire.Number, value uint64) []byte {
+	return protowire.AppendVarint(protowire.AppendTag(nil, num, protowire.VarintType), value)
+}
+
+func TestDatIP(t *testing.T) {
+	cidr := func(cidr string) []byte {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return bytesField(2, message(bytesField(1, ip), varintField(2, uint64(ones))))
+	}
+	buf := message(
+		bytesField(1, message(bytesField(1, []byte("CN")), cidr("1.0.1.0/24"), cidr("2400:3200::/32"))),
+		bytesField(1, message(bytesField(1, []byte("NOT-CN")), cidr("1.0.1.0/24"), varintField(3, 1))),
+	)
+	db, err := parseDatIP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Contains("cn", net.ParseIP("1.0.1.2")) || !db.Contains("CN", net.ParseIP("2400:3200::1")) {
+		t.Fatal("ip of cn is not matched")
+	}
+	if db.Contains("cn", net.ParseIP("8.8.8.8")) || db.Contains("us", net.ParseIP("8.8.8.8")) {
+		t.Fatal("ip out of list is matched")
+	}
+	if db.Contains("not-cn", net.ParseIP("1.0.1.2")) || !db.Contains("not-cn", net.ParseIP("8.8.8.8")) {
+		t.Fatal("reverse match is not supported")
+	}
+}
+
+func TestOpenSiteDB(t *testing.T) {
+	domain := func(typ DomainType, value string, attrs ...string) []byte {
+		fields := [][]byte{varintField(1, uint64(typ)), bytesField(2, []byte(value))}
+		for _, attr := range attrs {
+			fields = append(fields, bytesField(3, message(bytesField(1, []byte(attr)), varintField(2, 1))))
+		}
+		return bytesField(2, message(fields...))
+	}
+	buf := message(bytesField(1, message(
+		bytesField(1, []byte("CATEGORY-ADS")),
+		domain(DomainRoot, "ads.com"),
+		domain(DomainFull, "ad.cn", "cn"),
+		domain(DomainPlain, "adserver"),
+		domain(DomainRegex, "^ad[0-9]+\\."),
+	)))
+	dir, err := ioutil.TempDir("", "geo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "geosite.dat")
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenSiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains, err := db.Domains("category-ads")
+	if err != nil || len(domains) != 4 || domains[0].Type != DomainRoot || domains[3].Value != "^ad[0-9]+\\." {
+		t.Fatalf("domains = %+v, %v", domains, err)
+	}
+	domains, err = db.Domains("category-ads@cn")
+	if err != nil || len(domains) != 1 || domains[0].Value != "ad.cn" {
+		t.Fatalf("domains with attribute = %+v, %v", domains, err)
+	}
+	if _, err := db.Domains("unknown"); err == nil {
+		t.Fatal("unknown code return no error")
+	}
+}
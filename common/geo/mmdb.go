@@ -0,0 +1,68 @@
+package geo
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdbMetadataMarker is the start of metadata section of MaxMind db
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbRecord is the part of record read from mmdb, registered_country is used when country is missing
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// mmdb is a MaxMind format db, only the country of record is read
+type mmdb struct {
+	reader *maxminddb.Reader
+	// countries cache the country of data offset
+	countries sync.Map
+}
+
+func isMMDB(buf []byte) bool {
+	return bytes.LastIndex(buf, mmdbMetadataMarker) != -1
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	reader, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdb{reader: reader}, nil
+}
+
+// Country return the lower iso code of country of ip, empty when ip is not found
+func (db *mmdb) Country(ip net.IP) string {
+	offset, err := db.reader.LookupOffset(ip)
+	if err != nil || offset == maxminddb.NotFound {
+		return ""
+	}
+	if country, ok := db.countries.Load(offset); ok {
+		return country.(string)
+	}
+	var record mmdbRecord
+	if err := db.reader.Decode(offset, &record); err != nil {
+		return ""
+	}
+	country := record.Country.ISOCode
+	if country == "" {
+		country = record.RegisteredCountry.ISOCode
+	}
+	country = strings.ToLower(country)
+	db.countries.Store(offset, country)
+	return country
+}
+
+func (db *mmdb) Contains(code string, ip net.IP) bool {
+	return db.Country(ip) == strings.ToLower(code)
+}
@@ -0,0 +1,84 @@
+package matcher
+
+import (
+	"net"
+)
+
+// CIDRTree is a binary radix tree of ip prefixes, ipv4 is stored as ipv4-mapped ipv6,
+// Lookup return the value of the longest prefix contains ip
+type CIDRTree struct {
+	root *cidrNode
+	size int
+}
+
+type cidrNode struct {
+	children [2]*cidrNode
+	value    int
+	// leaf is true when a prefix ends at this node
+	leaf bool
+}
+
+func NewCIDRTree() *CIDRTree {
+	return &CIDRTree{root: new(cidrNode)}
+}
+
+// ParseCIDR parse cidr or single ip to ip network
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	if ip := net.ParseIP(cidr); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
+
+// Insert add prefix with value, the value of an existing prefix is kept
+func (t *CIDRTree) Insert(ipNet *net.IPNet, value int) {
+	ones, bits := ipNet.Mask.Size()
+	ip := ipNet.IP.To16()
+	if ip == nil {
+		return
+	}
+	if bits == 32 {
+		ones += 96
+	}
+	node := t.root
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> uint(7-i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = new(cidrNode)
+		}
+		node = node.children[bit]
+	}
+	if !node.leaf {
+		node.leaf = true
+		node.value = value
+		t.size++
+	}
+}
+
+// Lookup return the value of the longest prefix which contains ip
+func (t *CIDRTree) Lookup(ip net.IP) (value int, ok bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return 0, false
+	}
+	node := t.root
+	for i := 0; node != nil; i++ {
+		if node.leaf {
+			value, ok = node.value, true
+		}
+		if i == 128 {
+			break
+		}
+		node = node.children[ip[i/8]>>uint(7-i%8)&1]
+	}
+	return value, ok
+}
+
+// Len return the count of prefixes
+func (t *CIDRTree) Len() int {
+	return t.size
+}
@@ -0,0 +1,78 @@
+package matcher
+
+import "strings"
+
+// DomainTrie is a trie of domain labels from the top level, a suffix matches the domain
+// itself and its subdomains, so example.com matches a.example.com but not badexample.com
+type DomainTrie struct {
+	root *domainNode
+	size int
+}
+
+type domainNode struct {
+	children map[string]*domainNode
+	value    int
+	// leaf is true when a suffix ends at this node
+	leaf bool
+}
+
+func NewDomainTrie() *DomainTrie {
+	return &DomainTrie{root: new(domainNode)}
+}
+
+// Insert add suffix with value, the value of an existing suffix is kept
+func (t *DomainTrie) Insert(suffix string, value int) {
+	suffix = normalizeDomain(suffix)
+	if suffix == "" {
+		return
+	}
+	node := t.root
+	labels := strings.Split(suffix, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if node.children == nil {
+			node.children = make(map[string]*domainNode)
+		}
+		child := node.children[labels[i]]
+		if child == nil {
+			child = new(domainNode)
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+	if !node.leaf {
+		node.leaf = true
+		node.value = value
+		t.size++
+	}
+}
+
+// Lookup return the value of the longest suffix which matches domain
+func (t *DomainTrie) Lookup(domain string) (value int, ok bool) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return 0, false
+	}
+	node := t.root
+	for end := len(domain); node != nil; {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+		node = node.children[domain[start:end]]
+		if node != nil && node.leaf {
+			value, ok = node.value, true
+		}
+		if start == 0 {
+			break
+		}
+		end = start - 1
+	}
+	return value, ok
+}
+
+// Len return the count of suffixes
+func (t *DomainTrie) Len() int {
+	return t.size
+}
+
+// normalizeDomain lower the domain and trim the dots of fqdn
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.Trim(domain, "."))
+}
@@ -0,0 +1,64 @@
+package matcher
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCIDRTree(t *testing.T) {
+	tree := NewCIDRTree()
+	for i, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.168.1.1", "2001:db8::/32", "10.0.0.0/8"} {
+		ipNet, err := ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Insert(ipNet, i)
+	}
+	if tree.Len() != 4 {
+		t.Fatalf("len = %v, want 4", tree.Len())
+	}
+	for ip, want := range map[string]int{
+		"10.2.3.4":        0,
+		"10.1.2.3":        1,
+		"192.168.1.1":     2,
+		"2001:db8::1":     3,
+		"::ffff:10.2.0.1": 0,
+		"192.168.1.2":     -1,
+		"2001:db9::1":     -1,
+		"11.0.0.1":        -1,
+	} {
+		value, ok := tree.Lookup(net.ParseIP(ip))
+		if want == -1 && ok || want != -1 && (!ok || value != want) {
+			t.Fatalf("lookup %v = %v %v, want %v", ip, value, ok, want)
+		}
+	}
+	// ::/0 contains everything
+	ipNet, _ := ParseCIDR("::/0")
+	tree.Insert(ipNet, 9)
+	if value, ok := tree.Lookup(net.ParseIP("8.8.8.8")); !ok || value != 9 {
+		t.Fatalf("lookup default route = %v %v", value, ok)
+	}
+}
+
+func TestDomainTrie(t *testing.T) {
+	trie := NewDomainTrie()
+	trie.Insert("example.com", 1)
+	trie.Insert("a.example.com.", 2)
+	trie.Insert("cn", 3)
+	for domain, want := range map[string]int{
+		"example.com":       1,
+		"www.Example.com":   1,
+		"x.a.example.com":   2,
+		"a.example.com":     2,
+		"baidu.cn":          3,
+		"badexample.com":    -1,
+		"com":               -1,
+		"example.com.cn.io": -1,
+		"":                  -1,
+	} {
+		value, ok := trie.Lookup(domain)
+		if want == -1 && ok || want != -1 && (!ok || value != want) {
+			t.Fatalf("lookup %v = %v %v, want %v", domain, value, ok, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package metrics hold the prometheus collectors of the node
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// handshake failure reasons
+const (
+	ReasonObfsDecode     = "obfs_decode"
+	ReasonProtocolAuth   = "protocol_auth"
+	ReasonDecrypt        = "decrypt"
+	ReasonReplay         = "replay"
+	ReasonAddress        = "address"
+	ReasonFirewallReject = "firewall_reject"
+	ReasonUserBlocked    = "user_blocked"
+	ReasonUserDisabled   = "user_disabled"
+	ReasonIPLimit        = "ip_limit"
+)
+
+var (
+	userUpload = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vnet_user_upload_bytes_total",
+		Help: "Upload bytes of user.",
+	}, []string{"uid"})
+	userDownload = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vnet_user_download_bytes_total",
+		Help: "Download bytes of user.",
+	}, []string{"uid"})
+	tcpConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vnet_tcp_connections",
+		Help: "Active tcp connections of port.",
+	}, []string{"port"})
+	udpNATEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vnet_udp_nat_entries",
+		Help: "Udp nat entries of port.",
+	}, []string{"port"})
+	handshakeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vnet_handshake_failures_total",
+		Help: "Failed handshakes by reason.",
+	}, []string{"reason"})
+	limiterWait = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vnet_limiter_wait_seconds_total",
+		Help: "Time spent waiting on the speed limiter.",
+	}, []string{"direction"})
+	ruleTriggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vnet_rule_triggers_total",
+		Help: "Rejected targets by rule id.",
+	}, []string{"rule_id"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		userUpload,
+		userDownload,
+		tcpConnections,
+		udpNATEntries,
+		handshakeFailures,
+		limiterWait,
+		ruleTriggers,
+	)
+}
+
+// Handler return the http handler expose metrics in prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func AddUpload(uid int, n int64) {
+	userUpload.WithLabelValues(strconv.Itoa(uid)).Add(float64(n))
+}
+
+func AddDownload(uid int, n int64) {
+	userDownload.WithLabelValues(strconv.Itoa(uid)).Add(float64(n))
+}
+
+func IncTCPConnection(port int) {
+	tcpConnections.WithLabelValues(strconv.Itoa(port)).Inc()
+}
+
+func DecTCPConnection(port int) {
+	tcpConnections.WithLabelValues(strconv.Itoa(port)).Dec()
+}
+
+func IncUDPNATEntry(port int) {
+	udpNATEntries.WithLabelValues(strconv.Itoa(port)).Inc()
+}
+
+func DecUDPNATEntry(port int) {
+	udpNATEntries.WithLabelValues(strconv.Itoa(port)).Dec()
+}
+
+// HandshakeFail count the failed handshake, reason is one of Reason constants
+func HandshakeFail(reason string) {
+	handshakeFailures.WithLabelValues(reason).Inc()
+}
+
+// LimiterWait count the time blocked by limiter, direction is up or down
+func LimiterWait(direction string, d time.Duration) {
+	limiterWait.WithLabelValues(direction).Add(d.Seconds())
+}
+
+func RuleTrigger(ruleID int) {
+	ruleTriggers.WithLabelValues(strconv.Itoa(ruleID)).Inc()
+}
@@ -0,0 +1,148 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers"
+	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/pkg/errors"
+)
+
+// ShadowsocksRClientDecorate is the client side of ShadowsocksRDecorate,
+// data write to it is encode by protocol, encryptor and obfs then send to server
+type ShadowsocksRClientDecorate struct {
+	*Request
+	obfs          obfs.Plain
+	protocol      obfs.Plain
+	encryptor     *ciphers.Encryptor
+	Host          string
+	Port          int
+	ObfsParam     string
+	ProtocolParam string
+	Overhead      int
+	recvBuf       *bytes.Buffer
+}
+
+func NewShadowsocksRClientDecorate(request *Request, obfsMethod, cryptMethod, key, protocolMethod, obfsParam, protocolParam, host string, port int) (ssrd *ShadowsocksRClientDecorate, err error) {
+	ssrd = &ShadowsocksRClientDecorate{
+		Request:       request,
+		ObfsParam:     obfsParam,
+		ProtocolParam: protocolParam,
+		Host:          host,
+		Port:          port,
+		recvBuf:       new(bytes.Buffer),
+	}
+
+	ssrd.obfs, err = obfs.GetObfs(obfsMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	ssrd.protocol, err = obfs.GetObfs(protocolMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	ssrd.encryptor, err = ciphers.NewEncryptor(cryptMethod, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ssrd.Overhead = ssrd.obfs.GetOverhead(true) + ssrd.protocol.GetOverhead(true)
+	ssrd.obfs.SetServerInfo(ssrd.getServerInfo(true))
+	ssrd.protocol.SetServerInfo(ssrd.getServerInfo(false))
+	return ssrd, nil
+}
+
+func (ssrd *ShadowsocksRClientDecorate) Read(buf []byte) (n int, err error) {
+	if ssrd.recvBuf.Len() > 0 {
+		return ssrd.recvBuf.Read(buf)
+	}
+
+	bufTmp := make([]byte, 4*1024)
+	n, err = ssrd.Conn.Read(bufTmp)
+	if err != nil {
+		return 0, err
+	}
+
+	data, needSendBack, err := ssrd.obfs.ClientDecode(bufTmp[:n])
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate obfs decode error.", ssrd.RequestID))
+	}
+	if needSendBack {
+		result, err := ssrd.obfs.ClientEncode([]byte{})
+		if err != nil {
+			return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate obfs encode error.", ssrd.RequestID))
+		}
+		if _, err = ssrd.Conn.Write(result); err != nil {
+			return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate obfs sendback error.", ssrd.RequestID))
+		}
+	}
+
+	data, err = ssrd.encryptor.Decrypt(data)
+	if err != nil && strings.Contains(err.Error(), "buf is too short") {
+		return ssrd.Read(buf)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate encryptor decrypt error.", ssrd.RequestID))
+	}
+	if len(ssrd.protocol.GetServerInfo().GetRecvIv()) == 0 && len(ssrd.encryptor.IVIn) != 0 {
+		ssrd.protocol.GetServerInfo().SetRecvIv(ssrd.encryptor.IVIn)
+	}
+
+	data, err = ssrd.protocol.ClientPostDecrypt(data)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate protocol post decrypt error.", ssrd.RequestID))
+	}
+	if len(data) == 0 {
+		return ssrd.Read(buf)
+	}
+	ssrd.recvBuf.Write(data)
+	return ssrd.recvBuf.Read(buf)
+}
+
+func (ssrd *ShadowsocksRClientDecorate) Write(buf []byte) (n int, err error) {
+	data, err := ssrd.protocol.ClientPreEncrypt(buf)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate protocol pre encrypt error.", ssrd.RequestID))
+	}
+	data, err = ssrd.encryptor.Encrypt(data)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate encryptor encrypt error.", ssrd.RequestID))
+	}
+	data, err = ssrd.obfs.ClientEncode(data)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRClientDecorate obfs encode error.", ssrd.RequestID))
+	}
+	if len(data) > 0 {
+		if _, err = ssrd.Conn.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
+
+func (ssrd *ShadowsocksRClientDecorate) getServerInfo(isObfs bool) obfs.ServerInfo {
+	serverInfo := obfs.NewServerInfo()
+	serverInfo.SetHost(ssrd.Host)
+	serverInfo.SetPort(ssrd.Port)
+	if isObfs {
+		serverInfo.SetObfsParam(ssrd.ObfsParam)
+		serverInfo.SetProtocolParam("")
+	} else {
+		serverInfo.SetObfsParam("")
+		serverInfo.SetProtocolParam(ssrd.ProtocolParam)
+	}
+	serverInfo.SetIv(ssrd.encryptor.IVOut)
+	serverInfo.SetRecvIv([]byte{})
+	serverInfo.SetKeyStr(ssrd.encryptor.KeyStr)
+	serverInfo.SetKey(ssrd.encryptor.Key)
+	serverInfo.SetHeadLen(obfs.DEFAULT_HEAD_LEN)
+	serverInfo.SetTCPMss(obfs.TCP_MSS)
+	serverInfo.SetBufferSize(obfs.BUF_SIZE - ssrd.Overhead)
+	serverInfo.SetOverhead(ssrd.Overhead)
+	serverInfo.SetUsers(map[string]string{})
+	return serverInfo
+}
@@ -2,10 +2,14 @@ package network
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/ProxyPanel/VNet-SSR/common"
+	"github.com/ProxyPanel/VNet-SSR/common/cache"
 	"github.com/ProxyPanel/VNet-SSR/common/ciphers"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
 	"github.com/ProxyPanel/VNet-SSR/common/obfs"
 	"github.com/ProxyPanel/VNet-SSR/utils/addrx"
 	"github.com/ProxyPanel/VNet-SSR/utils/binaryx"
@@ -15,12 +19,27 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// MAX_HANDSHAKE_DATA_SIZE origin data over this size will not keep for redirect
+const MAX_HANDSHAKE_DATA_SIZE = 64 * 1024
+
+// UDP_CLIENT_TIMEOUT is how long the state of an idle udp client is kept, it is longer than
+// the nat entry timeout of udp proxy, so the state lives as long as the nat entry
+const UDP_CLIENT_TIMEOUT = 60 * time.Second
+
+// ILimiter limit the traffic of user, waits return when ctx is done
 type ILimiter interface {
-	Wait(int, int) error
-	DownLimit(int, int) error
-	UpLimit(int, int) error
+	DownLimit(ctx context.Context, uid, n int) error
+	UpLimit(ctx context.Context, uid, n int) error
+}
+
+// IConnLimiter is the limiter which also limit each connection
+type IConnLimiter interface {
+	ILimiter
+	// NewConn return the limiter of one connection
+	NewConn() ILimiter
 }
 
 func NewShadowsocksRDecorate(request *Request, obfsMethod, cryptMethod, key, protocolMethod, obfsParam, protocolParam, host string, port int, isLocal bool, single int, users map[string]string) (ssrd *ShadowsocksRDecorate, err error) {
@@ -35,6 +54,11 @@ func NewShadowsocksRDecorate(request *Request, obfsMethod, cryptMethod, key, pro
 		Users:         users,
 		single:        single,
 		recvBuf:       new(bytes.Buffer),
+		handshakeData: new(bytes.Buffer),
+	}
+	ssrd.ctx, ssrd.cancel = context.WithCancel(context.Background())
+	if request.PacketConn != nil {
+		ssrd.originUDPClients = cache.NewLruCache(UDP_CLIENT_TIMEOUT)
 	}
 
 	// init obfs protocol encrypto component
@@ -52,6 +76,9 @@ func NewShadowsocksRDecorate(request *Request, obfsMethod, cryptMethod, key, pro
 	if err != nil {
 		return nil, err
 	}
+	if request.PacketConn != nil && ssrd.encryptor.IsAEAD2022() {
+		ssrd.udpSessions = cache.NewLruCache(UDP_CLIENT_TIMEOUT)
+	}
 
 	ssrd.Overhead = ssrd.obfs.GetOverhead(isLocal) + ssrd.protocol.GetOverhead(isLocal)
 
@@ -82,19 +109,47 @@ type ShadowsocksRDecorate struct {
 	upload        int64
 	download      int64
 	single        int
+	// originUDPClients udp client address which fallback to plain shadowsocks,
+	// idle addresses expire after UDP_CLIENT_TIMEOUT
+	originUDPClients *cache.LRU
+	// udpSessions udp client address to its aead 2022 session id, idle addresses
+	// expire after UDP_CLIENT_TIMEOUT like the server sessions of encryptor
+	udpSessions *cache.LRU
+	// handshakeData origin data received before the target address parsed,
+	// nil after FinishHandshake or too large
+	handshakeData *bytes.Buffer
+	// failReason is the metrics reason of the last read error
+	failReason string
+	// ctx is cancelled when connection is closed, so limiter waits return
+	ctx    context.Context
+	cancel context.CancelFunc
 	common.TrafficReport
 	ILimiter
 	*sync.Mutex
 }
 
 func (ssrd *ShadowsocksRDecorate) SetLimter(limiter ILimiter) {
+	if connLimiter, ok := limiter.(IConnLimiter); ok {
+		limiter = connLimiter.NewConn()
+	}
 	ssrd.ILimiter = limiter
 }
 
+// Close cancel the waiting of limiter and close the connection
+func (ssrd *ShadowsocksRDecorate) Close() error {
+	ssrd.cancel()
+	return ssrd.Request.Close()
+}
+
+// Closed return whether the connection is closed by Close
+func (ssrd *ShadowsocksRDecorate) Closed() bool {
+	return ssrd.ctx.Err() != nil
+}
+
 func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 	defer func() {
 		if ssrd.ILimiter != nil {
-			if err := ssrd.ILimiter.UpLimit(ssrd.UID, n); err != nil {
+			if err := ssrd.ILimiter.UpLimit(ssrd.ctx, ssrd.UID, n); err != nil && ssrd.ctx.Err() == nil {
 				logrus.Error(err)
 			}
 		}
@@ -113,6 +168,13 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 	atomic.AddInt64(&ssrd.upload, int64(n))
 
 	data := bufTmp[:n]
+	if ssrd.handshakeData != nil {
+		if ssrd.handshakeData.Len()+n > MAX_HANDSHAKE_DATA_SIZE {
+			ssrd.handshakeData = nil
+		} else {
+			ssrd.handshakeData.Write(data)
+		}
+	}
 	unobfsData, needDecrypt, needSendBack, err := ssrd.obfs.ServerDecode(data)
 	if logrus.GetLevel() == logrus.DebugLevel {
 		logrus.WithFields(logrus.Fields{
@@ -130,6 +192,7 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 				"err": err,
 			}).Debugf("ShadowsocksRDecorate obfs decrypt error.")
 		}
+		ssrd.failReason = metrics.ReasonObfsDecode
 		return 0, errors.New(fmt.Sprintf("[%s] shadowsocksr obfs decrypt error.", ssrd.RequestID))
 	}
 
@@ -143,7 +206,10 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 			return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRDecorate obfs sendback error.", ssrd.RequestID))
 		}
 		atomic.AddInt64(&ssrd.download, int64(n))
-		return ssrd.Read(buf)
+		// tls1.2_ticket_fastauth client may send data with the handshake
+		if !needDecrypt {
+			return ssrd.Read(buf)
+		}
 	}
 
 	if needDecrypt {
@@ -163,8 +229,16 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 		}
 
 		if err != nil {
+			ssrd.failReason = metrics.ReasonDecrypt
+			if errors.Cause(err) == ciphers.ErrReplay {
+				ssrd.failReason = metrics.ReasonReplay
+			}
 			return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRDecorate obfs decrypt error.", ssrd.RequestID))
 		}
+		// user of aead 2022 is identified by the identity header
+		if user := ssrd.encryptor.User; user != nil && ssrd.UID != user.ID {
+			ssrd.UpdateUser(binaryx.LEUint32ToBytes(uint32(user.ID)))
+		}
 		data = cleartext
 	} else {
 		data = unobfsData
@@ -179,6 +253,7 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 		}).Debug("ShadowsocksRDecorate protocol ServerPostDecrypt")
 	}
 	if err != nil {
+		ssrd.failReason = metrics.ReasonProtocolAuth
 		return 0, errors.Wrap(err, fmt.Sprintf("[%s] ShadowsocksRDecorate protocol post decrypt error.", ssrd.RequestID))
 	}
 	if sendback {
@@ -236,7 +311,7 @@ func (ssrd *ShadowsocksRDecorate) Read(buf []byte) (n int, err error) {
 func (ssrd *ShadowsocksRDecorate) Write(buf []byte) (n int, err error) {
 	defer func() {
 		if ssrd.ILimiter != nil {
-			if err := ssrd.ILimiter.DownLimit(ssrd.UID, n); err != nil {
+			if err := ssrd.ILimiter.DownLimit(ssrd.ctx, ssrd.UID, n); err != nil && ssrd.ctx.Err() == nil {
 				logrus.Error(err)
 			}
 		}
@@ -289,10 +364,23 @@ func (ssrd *ShadowsocksRDecorate) ReadFrom() (data, uid []byte, addr net.Addr, e
 		return nil, nil, nil, err
 	}
 	ssrd.protocol.GetServerInfo().SetIv(iv)
+	if ssrd.encryptor.IsAEAD2022() {
+		ssrd.udpSessions.Put(addr.String(), iv)
+	}
 	result, uidPack, err := ssrd.protocol.ServerUDPPostDecrypt(data)
+	if (err != nil || len(result) == 0) && strings.HasSuffix(ssrd.protocol.GetMethod(), obfs.COMPATIBLE_SUFFIX) {
+		// auth fail, take it as plain shadowsocks packet
+		result, uidPack, err = data, "", nil
+		ssrd.originUDPClients.Put(addr.String(), true)
+	} else {
+		ssrd.originUDPClients.Delete(addr.String())
+	}
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if user := ssrd.encryptor.SessionUser(iv); user != nil {
+		uidPack = string(binaryx.LEUint32ToBytes(uint32(user.ID)))
+	}
 	// update upload traffic
 	if ssrd.single == 1 && ssrd.TrafficReport != nil {
 		ssrd.TrafficReport.Upload(int(binaryx.LEBytesToUInt32([]byte(uidPack))), int64(n))
@@ -306,11 +394,21 @@ func (ssrd *ShadowsocksRDecorate) ReadFrom() (data, uid []byte, addr net.Addr, e
 }
 
 func (ssrd *ShadowsocksRDecorate) WriteTo(p, uid []byte, addr net.Addr) error {
-	data, err := ssrd.protocol.ServerUDPPreEncrypt(p, uid)
-	if err != nil {
-		return err
+	var err error
+	data := p
+	if ssrd.originUDPClients.Get(addr.String()) == nil {
+		data, err = ssrd.protocol.ServerUDPPreEncrypt(p, uid)
+		if err != nil {
+			return err
+		}
 	}
-	data, err = ssrd.encryptor.EncryptAll(data, ssrd.encryptor.MustNewIV())
+	iv := ssrd.encryptor.MustNewIV()
+	if ssrd.udpSessions != nil {
+		if sessionID := ssrd.udpSessions.Get(addr.String()); sessionID != nil {
+			iv = sessionID.([]byte)
+		}
+	}
+	data, err = ssrd.encryptor.EncryptAll(data, iv)
 	if err != nil {
 		return err
 	}
@@ -321,6 +419,28 @@ func (ssrd *ShadowsocksRDecorate) WriteTo(p, uid []byte, addr net.Addr) error {
 	return err
 }
 
+// HandshakeData return the origin data received before handshake finished
+func (ssrd *ShadowsocksRDecorate) HandshakeData() []byte {
+	if ssrd.handshakeData == nil {
+		return nil
+	}
+	return ssrd.handshakeData.Bytes()
+}
+
+// FinishHandshake stop keeping origin data after target address parsed
+func (ssrd *ShadowsocksRDecorate) FinishHandshake() {
+	ssrd.handshakeData = nil
+}
+
+// FailReason return the metrics reason of the read error, the target address
+// is invalid if it is empty
+func (ssrd *ShadowsocksRDecorate) FailReason() string {
+	if ssrd.failReason == "" {
+		return metrics.ReasonAddress
+	}
+	return ssrd.failReason
+}
+
 func (ssrd *ShadowsocksRDecorate) getServerInfo(isObfs bool) obfs.ServerInfo {
 	serverInfo := obfs.NewServerInfo()
 	serverInfo.SetHost(ssrd.Host)
@@ -350,6 +470,12 @@ func (ssrd *ShadowsocksRDecorate) getServerInfo(isObfs bool) obfs.ServerInfo {
 	return serverInfo
 }
 
+// SetIdentityUsers identify the users of aead 2022 by identity header in single port mode,
+// the password of decorate is the identity psk
+func (ssrd *ShadowsocksRDecorate) SetIdentityUsers(users *aead2022.Users) {
+	ssrd.encryptor.Users = users
+}
+
 func (ssrd *ShadowsocksRDecorate) UpdateUser(uid []byte) {
 	if ssrd.single == 1 {
 		uidInt := binaryx.LEBytesToUInt32(uid)
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
+	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
+)
+
+func TestShadowsocksRDecorate_UDPCompatible(t *testing.T) {
+	core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData("auth_aes128_md5"))
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	ssrd, err := NewShadowsocksRDecorate(NewRequestWithUDP(server), "plain", "aes-128-cfb", "killer",
+		"auth_aes128_md5_compatible", "", "", "127.0.0.1", 0, false, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	encryptor, err := ciphers.NewEncryptor("aes-128-cfb", "killer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// plain shadowsocks packet falls back and the reply is not wrapped by protocol
+	request := append(socksproxy.ParseAddr("127.0.0.1:53").Raw, "query"...)
+	packet, err := encryptor.EncryptAll(request, encryptor.MustNewIV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.WriteTo(packet, server.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	data, uid, addr, err := ssrd.ReadFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, request) {
+		t.Fatalf("ReadFrom() = %q, want %q", data, request)
+	}
+	if ssrd.originUDPClients.Get(addr.String()) == nil {
+		t.Fatal("client is not kept as plain shadowsocks")
+	}
+	if err := ssrd.WriteTo([]byte("answer"), uid, addr); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, _, err := encryptor.DecryptAll(buf[:n])
+	if err != nil || string(reply) != "answer" {
+		t.Fatalf("reply = %q, %v", reply, err)
+	}
+}
+
+func TestShadowsocksRDecorate_UDPAEAD2022(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	method := "2022-blake3-aes-128-gcm"
+	psk := bytes.Repeat([]byte{9}, 16)
+	ssrd, err := NewShadowsocksRDecorate(NewRequestWithUDP(server), "plain", method, base64.StdEncoding.EncodeToString(psk),
+		"origin", "", "", "127.0.0.1", 0, false, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// reply is sealed to the client session of the address
+	cp := aead2022.GetAEAD2022Cipher(method)
+	clientSessionID := []byte("session1")
+	request := append(socksproxy.ParseAddr("127.0.0.1:53").Raw, "query"...)
+	packet, err := cp.SealPacket(psk, clientSessionID, 0, aead2022.PackPacketBody(aead2022.HeaderTypeClient, nil, request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.WriteTo(packet, server.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	data, uid, addr, err := ssrd.ReadFrom()
+	if err != nil || !bytes.Equal(data, request) {
+		t.Fatalf("ReadFrom() = %q, %v", data, err)
+	}
+	if sessionID := ssrd.udpSessions.Get(addr.String()); sessionID == nil || !bytes.Equal(sessionID.([]byte), clientSessionID) {
+		t.Fatalf("session of client = %v", sessionID)
+	}
+	if err := ssrd.WriteTo([]byte("answer"), uid, addr); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, body, err := cp.OpenPacket(psk, buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, reply, err := aead2022.UnpackPacketBody(aead2022.HeaderTypeServer, body)
+	if err != nil || !bytes.Equal(sessionID, clientSessionID) || string(reply) != "answer" {
+		t.Fatalf("reply = %q to session %q, %v", reply, sessionID, err)
+	}
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"strings"
+
+	"github.com/ProxyPanel/VNet-SSR/utils/sniffx"
+)
+
+type redirectItem struct {
+	Match  string
+	Target string
+}
+
+// Redirect choose the decoy backend for the connection which handshake failed,
+// the format is same as "redirect" of python ssr, items split by ",":
+//
+//	127.0.0.1:80                    all failed connection redirect to 127.0.0.1:80
+//	www.bing.com#127.0.0.1:443      tls sni or http host match www.bing.com
+//	*.bing.com#127.0.0.1:443        match bing.com and its sub domain
+//	*#127.0.0.1:80                  same as without match
+//
+// the first matched item is used, port 80 is used if the target has no port
+type Redirect struct {
+	items []redirectItem
+}
+
+func NewRedirect(config string) *Redirect {
+	redirect := &Redirect{}
+	for _, item := range strings.Split(config, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		match, target := "*", item
+		if pos := strings.LastIndex(item, "#"); pos >= 0 {
+			match, target = strings.ToLower(item[:pos]), item[pos+1:]
+		}
+		if target == "" {
+			continue
+		}
+		if !strings.Contains(target, ":") || strings.HasSuffix(target, "]") {
+			target = target + ":80"
+		}
+		redirect.items = append(redirect.items, redirectItem{Match: match, Target: target})
+	}
+	return redirect
+}
+
+func (r *Redirect) IsEmpty() bool {
+	return r == nil || len(r.items) == 0
+}
+
+// Target return the decoy backend address by the sni or host of the origin data
+func (r *Redirect) Target(data []byte) (string, bool) {
+	if r.IsEmpty() {
+		return "", false
+	}
+	host, ok := sniffx.TLSServerName(data)
+	if !ok {
+		host, _ = sniffx.HTTPHost(data)
+	}
+	host = strings.ToLower(host)
+	for _, item := range r.items {
+		if matchRedirectHost(item.Match, host) {
+			return item.Target, true
+		}
+	}
+	return "", false
+}
+
+func matchRedirectHost(match, host string) bool {
+	if match == "*" {
+		return true
+	}
+	if host == "" {
+		return false
+	}
+	if strings.HasPrefix(match, "*.") {
+		return host == match[2:] || strings.HasSuffix(host, match[1:])
+	}
+	return host == match
+}
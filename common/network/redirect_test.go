@@ -0,0 +1,27 @@
+package network
+
+import "testing"
+
+func TestRedirect_Target(t *testing.T) {
+	redirect := NewRedirect("www.bing.com#127.0.0.1:443, *.example.com#127.0.0.1:8443,127.0.0.1")
+	tests := map[string]string{
+		"GET / HTTP/1.1\r\nHost: www.bing.com\r\n\r\n":    "127.0.0.1:443",
+		"GET / HTTP/1.1\r\nHost: example.com:80\r\n\r\n":  "127.0.0.1:8443",
+		"GET / HTTP/1.1\r\nHost: a.example.com\r\n\r\n":   "127.0.0.1:8443",
+		"GET / HTTP/1.1\r\nHost: badexample.com\r\n\r\n":  "127.0.0.1:80",
+		"\x16\x03\x01\x00\x05random data from the prober": "127.0.0.1:80",
+	}
+	for data, want := range tests {
+		if target, ok := redirect.Target([]byte(data)); !ok || target != want {
+			t.Errorf("Target(%q) = %v, %v, want %v", data, target, ok, want)
+		}
+	}
+
+	redirect = NewRedirect("www.bing.com#127.0.0.1:443")
+	if _, ok := redirect.Target([]byte("GET / HTTP/1.1\r\nHost: www.google.com\r\n\r\n")); ok {
+		t.Error("Target() not match want false")
+	}
+	if !NewRedirect("").IsEmpty() {
+		t.Error("NewRedirect(\"\") want empty")
+	}
+}
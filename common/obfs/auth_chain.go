@@ -8,6 +8,7 @@ import (
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/utils/langx"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +30,11 @@ const (
 
 func init() {
 	registerMethod("auth_chain_a", NewAuthChainA)
+	registerMethod("auth_chain_b", NewAuthChainB)
+	registerMethod("auth_chain_c", NewAuthChainC)
+	registerMethod("auth_chain_d", NewAuthChainD)
+	registerMethod("auth_chain_e", NewAuthChainE)
+	registerMethod("auth_chain_f", NewAuthChainF)
 }
 
 type XorShift128Plus struct {
@@ -94,16 +100,23 @@ type AuthChainA struct {
 	RandomClient   *XorShift128Plus
 	RandomServer   *XorShift128Plus
 	Encryptor      *ciphers.Encryptor
+	// rndDataLenFunc is the padding length algorithm, the later auth_chain
+	// versions only differ from auth_chain_a here
+	rndDataLenFunc func(bufSize int, lastHash []byte, random *XorShift128Plus) int
 }
 
 func NewAuthChainA(method string) (Plain, error) {
+	return newAuthChainA(method, "auth_chain_a")
+}
+
+func newAuthChainA(method, salt string) (*AuthChainA, error) {
 	authBase, err := NewAuthBase(method)
 	if err != nil {
 		return nil, err
 	}
 	authBase.RawTrans = false
 	authBase.Overhead = 4
-	authBase.NoCompatibleMethod = "auth_chain_a"
+	authBase.NoCompatibleMethod = salt
 	return &AuthChainA{
 		AuthBase:       authBase,
 		RecvBuf:        []byte{},
@@ -113,7 +126,7 @@ func NewAuthChainA(method string) (Plain, error) {
 		ClientID:       0,
 		ConnectionID:   0,
 		MaxTimeDif:     60 * 60 * 24,
-		Salt:           []byte("auth_chain_a"),
+		Salt:           []byte(salt),
 		PackID:         1,
 		RecvID:         1,
 		UserIDNum:      0,
@@ -515,6 +528,9 @@ func (a *AuthChainA) ServerUDPPreEncrypt(buf, uid []byte) ([]byte, error) {
 }
 
 func (a *AuthChainA) ServerUDPPostDecrypt(buf []byte) ([]byte, string, error) {
+	if len(buf) < 8 {
+		return []byte{}, "", nil
+	}
 	macKey := a.GetServerInfo().GetKey()
 	md5Data := hmacmd5(macKey, buf[len(buf)-8:len(buf)-5])
 	uid := binaryx.LEBytesToUInt32(buf[len(buf)-5:len(buf)-1]) ^ binaryx.LEBytesToUInt32(md5Data[:4])
@@ -530,7 +546,7 @@ func (a *AuthChainA) ServerUDPPostDecrypt(buf []byte) ([]byte, string, error) {
 			userKey = a.GetServerInfo().GetRecvIv()
 		}
 	}
-	if bytes.Equal(hmacmd5(userKey, buf[:len(buf)])[:1], buf[len(buf)-1:]) {
+	if !bytes.Equal(hmacmd5(userKey, buf[:len(buf)-1])[:1], buf[len(buf)-1:]) {
 		return []byte{}, "", nil
 	}
 	randLen := a.udpRndDataLen(md5Data, a.RandomServer)
@@ -571,6 +587,9 @@ func (a *AuthChainA) trapezoidRandomInt(maxVal, d float64) int {
 }
 
 func (a *AuthChainA) rndDataLen(bufSize int, lastHash []byte, random *XorShift128Plus) int {
+	if a.rndDataLenFunc != nil {
+		return a.rndDataLenFunc(bufSize, lastHash, random)
+	}
 	if bufSize > 1440 {
 		return 0
 	}
@@ -706,3 +725,289 @@ func (a *AuthChainA) packAuthData(authData, buf []byte) (result []byte, err erro
 	}
 	return bytesx.ContactSlice(data, packClientData), nil
 }
+
+// xorShiftDataSize draws one packet size candidate the way every auth_chain
+// version after auth_chain_a builds its data size lists
+func xorShiftDataSize(random *XorShift128Plus) int {
+	return int(random.Next() % 2340 % 2040 % 1440)
+}
+
+/*----------------------------------AuthChainB----------------------------------*/
+type AuthChainB struct {
+	*AuthChainA
+	DataSizeList  []int
+	DataSizeList2 []int
+}
+
+func NewAuthChainB(method string) (Plain, error) {
+	authChainA, err := newAuthChainA(method, "auth_chain_b")
+	if err != nil {
+		return nil, err
+	}
+	b := &AuthChainB{
+		AuthChainA:    authChainA,
+		DataSizeList:  []int{},
+		DataSizeList2: []int{},
+	}
+	b.rndDataLenFunc = b.rndDataLen
+	return b, nil
+}
+
+func (b *AuthChainB) SetServerInfo(s ServerInfo) {
+	b.AuthChainA.SetServerInfo(s)
+	b.initDataSize(s.GetKey())
+}
+
+func (b *AuthChainB) initDataSize(key []byte) {
+	random := NewXorShift128Plus()
+	random.InitFromBin(key)
+	listLen := int(random.Next()%8 + 4)
+	b.DataSizeList = make([]int, 0, listLen)
+	for i := 0; i < listLen; i++ {
+		b.DataSizeList = append(b.DataSizeList, xorShiftDataSize(random))
+	}
+	sort.Ints(b.DataSizeList)
+	listLen = int(random.Next()%16 + 8)
+	b.DataSizeList2 = make([]int, 0, listLen)
+	for i := 0; i < listLen; i++ {
+		b.DataSizeList2 = append(b.DataSizeList2, xorShiftDataSize(random))
+	}
+	sort.Ints(b.DataSizeList2)
+}
+
+func (b *AuthChainB) rndDataLen(bufSize int, lastHash []byte, random *XorShift128Plus) int {
+	if bufSize >= 1440 {
+		return 0
+	}
+	overhead := b.GetServerInfo().GetOverhead()
+	random.InitFromBinLen(lastHash, bufSize)
+	pos := sort.SearchInts(b.DataSizeList, bufSize+overhead)
+	finalPos := pos + int(random.Next()%uint64(len(b.DataSizeList)))
+	if finalPos < len(b.DataSizeList) {
+		return b.DataSizeList[finalPos] - bufSize - overhead
+	}
+
+	pos = sort.SearchInts(b.DataSizeList2, bufSize+overhead)
+	finalPos = pos + int(random.Next()%uint64(len(b.DataSizeList2)))
+	if finalPos < len(b.DataSizeList2) {
+		return b.DataSizeList2[finalPos] - bufSize - overhead
+	}
+	if finalPos < pos+len(b.DataSizeList2)-1 {
+		return 0
+	}
+
+	if bufSize > 1300 {
+		return int(random.Next() % 31)
+	}
+	if bufSize > 900 {
+		return int(random.Next() % 127)
+	}
+	if bufSize > 400 {
+		return int(random.Next() % 521)
+	}
+	return int(random.Next() % 1021)
+}
+
+/*----------------------------------AuthChainC----------------------------------*/
+type AuthChainC struct {
+	*AuthChainA
+	DataSizeList0 []int
+}
+
+func NewAuthChainC(method string) (Plain, error) {
+	c, err := newAuthChainC(method, "auth_chain_c")
+	if err != nil {
+		return nil, err
+	}
+	c.rndDataLenFunc = c.rndDataLen
+	return c, nil
+}
+
+func newAuthChainC(method, salt string) (*AuthChainC, error) {
+	authChainA, err := newAuthChainA(method, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthChainC{
+		AuthChainA:    authChainA,
+		DataSizeList0: []int{},
+	}, nil
+}
+
+func (c *AuthChainC) SetServerInfo(s ServerInfo) {
+	c.AuthChainA.SetServerInfo(s)
+	c.initDataSize(s.GetKey())
+}
+
+// initDataSize fill DataSizeList0 with 12 ~ 35 sizes and return the random
+// generator so that auth_chain_d can keep drawing from the same sequence
+func (c *AuthChainC) initDataSize(key []byte) *XorShift128Plus {
+	random := NewXorShift128Plus()
+	random.InitFromBin(key)
+	listLen := int(random.Next()%(8+16) + (4 + 8))
+	c.DataSizeList0 = make([]int, 0, listLen)
+	for i := 0; i < listLen; i++ {
+		c.DataSizeList0 = append(c.DataSizeList0, xorShiftDataSize(random))
+	}
+	sort.Ints(c.DataSizeList0)
+	return random
+}
+
+func (c *AuthChainC) rndDataLen(bufSize int, lastHash []byte, random *XorShift128Plus) int {
+	otherDataSize := bufSize + c.GetServerInfo().GetOverhead()
+	// random must be initialized before any use to keep server and client synchronized
+	random.InitFromBinLen(lastHash, bufSize)
+	if otherDataSize >= c.DataSizeList0[len(c.DataSizeList0)-1] {
+		if otherDataSize >= 1440 {
+			return 0
+		}
+		if otherDataSize > 1300 {
+			return int(random.Next() % 31)
+		}
+		if otherDataSize > 900 {
+			return int(random.Next() % 127)
+		}
+		if otherDataSize > 400 {
+			return int(random.Next() % 521)
+		}
+		return int(random.Next() % 1021)
+	}
+
+	pos := sort.SearchInts(c.DataSizeList0, otherDataSize)
+	finalPos := pos + int(random.Next()%uint64(len(c.DataSizeList0)-pos))
+	return c.DataSizeList0[finalPos] - otherDataSize
+}
+
+/*----------------------------------AuthChainD----------------------------------*/
+type AuthChainD struct {
+	*AuthChainC
+}
+
+func NewAuthChainD(method string) (Plain, error) {
+	d, err := newAuthChainD(method, "auth_chain_d")
+	if err != nil {
+		return nil, err
+	}
+	d.rndDataLenFunc = d.rndDataLen
+	return d, nil
+}
+
+func newAuthChainD(method, salt string) (*AuthChainD, error) {
+	authChainC, err := newAuthChainC(method, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthChainD{AuthChainC: authChainC}, nil
+}
+
+func (d *AuthChainD) SetServerInfo(s ServerInfo) {
+	d.AuthChainA.SetServerInfo(s)
+	d.initDataSize(s.GetKey())
+}
+
+func (d *AuthChainD) initDataSize(key []byte) {
+	random := d.AuthChainC.initDataSize(key)
+	oldLen := len(d.DataSizeList0)
+	d.checkAndPatchDataSize(random)
+	if oldLen != len(d.DataSizeList0) {
+		sort.Ints(d.DataSizeList0)
+	}
+}
+
+// checkAndPatchDataSize append sizes while the biggest one can't hold a 1300 bytes
+// packet, but the list is restricted to 64 items
+func (d *AuthChainD) checkAndPatchDataSize(random *XorShift128Plus) {
+	for d.DataSizeList0[len(d.DataSizeList0)-1] < 1300 && len(d.DataSizeList0) < 64 {
+		d.DataSizeList0 = append(d.DataSizeList0, xorShiftDataSize(random))
+	}
+}
+
+func (d *AuthChainD) rndDataLen(bufSize int, lastHash []byte, random *XorShift128Plus) int {
+	otherDataSize := bufSize + d.GetServerInfo().GetOverhead()
+	if otherDataSize >= d.DataSizeList0[len(d.DataSizeList0)-1] {
+		return 0
+	}
+
+	random.InitFromBinLen(lastHash, bufSize)
+	pos := sort.SearchInts(d.DataSizeList0, otherDataSize)
+	finalPos := pos + int(random.Next()%uint64(len(d.DataSizeList0)-pos))
+	return d.DataSizeList0[finalPos] - otherDataSize
+}
+
+/*----------------------------------AuthChainE----------------------------------*/
+type AuthChainE struct {
+	*AuthChainD
+}
+
+func NewAuthChainE(method string) (Plain, error) {
+	e, err := newAuthChainE(method, "auth_chain_e")
+	if err != nil {
+		return nil, err
+	}
+	e.rndDataLenFunc = e.rndDataLen
+	return e, nil
+}
+
+func newAuthChainE(method, salt string) (*AuthChainE, error) {
+	authChainD, err := newAuthChainD(method, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthChainE{AuthChainD: authChainD}, nil
+}
+
+func (e *AuthChainE) rndDataLen(bufSize int, lastHash []byte, random *XorShift128Plus) int {
+	random.InitFromBinLen(lastHash, bufSize)
+	otherDataSize := bufSize + e.GetServerInfo().GetOverhead()
+	if otherDataSize >= e.DataSizeList0[len(e.DataSizeList0)-1] {
+		return 0
+	}
+	// always use the smallest size that can hold the packet
+	pos := sort.SearchInts(e.DataSizeList0, otherDataSize)
+	return e.DataSizeList0[pos] - otherDataSize
+}
+
+/*----------------------------------AuthChainF----------------------------------*/
+type AuthChainF struct {
+	*AuthChainE
+	KeyChangeInterval    int
+	KeyChangeDatetimeKey int64
+}
+
+func NewAuthChainF(method string) (Plain, error) {
+	authChainE, err := newAuthChainE(method, "auth_chain_f")
+	if err != nil {
+		return nil, err
+	}
+	f := &AuthChainF{
+		AuthChainE:        authChainE,
+		KeyChangeInterval: 60 * 60 * 24,
+	}
+	f.rndDataLenFunc = f.rndDataLen
+	return f, nil
+}
+
+func (f *AuthChainF) SetServerInfo(s ServerInfo) {
+	f.AuthChainA.SetServerInfo(s)
+	items := strings.Split(s.GetProtocolParam(), "#")
+	if len(items) > 1 {
+		if interval, err := strconv.Atoi(items[1]); err == nil && interval > 0 {
+			f.KeyChangeInterval = interval
+		}
+	}
+	f.KeyChangeDatetimeKey = time.Now().Unix() / int64(f.KeyChangeInterval)
+	f.initDataSize(s.GetKey())
+}
+
+// initDataSize xor the key with the current key change period before building
+// the size list, so the packet size distribution changes every interval
+func (f *AuthChainF) initDataSize(key []byte) {
+	// shorter keys are zero padded by InitFromBin anyway
+	newKey := make([]byte, int(math.Max(16, float64(len(key)))))
+	copy(newKey, key)
+	datetimeKey := binaryx.BEUInt64ToBytes(uint64(f.KeyChangeDatetimeKey))
+	for i := 0; i < 8; i++ {
+		newKey[i] ^= datetimeKey[i]
+	}
+	f.AuthChainD.initDataSize(newKey)
+}
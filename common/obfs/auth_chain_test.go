@@ -5,11 +5,19 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/utils/binaryx"
 	"net"
+	"reflect"
+	"strings"
 	"testing"
 )
 
+func init() {
+	// protocols share the client id table through core, tests need one too
+	core.GetApp().SetObfsProtocolService(NewObfsAuthChainData("test"))
+}
+
 func ExampleAuthChain() {
 	a,_ := NewAuthBase("acda")
 	fmt.Println(a.GetMethod())
@@ -134,7 +142,11 @@ func UpdateUser(uid []byte) {
 }
 
 func GetAuth() Plain {
-	authChainA,_ := NewAuthChainA("auth_chain_a")
+	return getAuthChain("auth_chain_a")
+}
+
+func getAuthChain(method string) Plain {
+	authChainA, _ := GetObfs(method)
 	serverInfo := NewServerInfo()
 	serverInfo.GetUsers()[string(binaryx.LEUint32ToBytes(1024))] = "killer"
 	serverInfo.SetClient(net.ParseIP("127.0.0.1"))
@@ -152,3 +164,146 @@ func GetAuth() Plain {
 	authChainA.SetServerInfo(serverInfo)
 	return authChainA
 }
+
+// expected values are generated by init_data_size and rnd_data_len of the python
+// shadowsocksr auth_chain.py with key b36d331451a61eb2d76860e00c347396, overhead 9
+// and last hash hmac_md5("killer", "abcd")
+var authChainRndBufSizes = []int{0, 1, 30, 100, 500, 1000, 1350, 1439, 1500}
+
+func TestAuthChainDataSize(t *testing.T) {
+	key := MustHexDecode("b36d331451a61eb2d76860e00c347396")
+	lastHash := hmacmd5([]byte("killer"), []byte("abcd"))
+	serverInfo := NewServerInfo()
+	serverInfo.SetKey(key)
+	serverInfo.SetOverhead(9)
+
+	listCDE := []int{46, 96, 112, 168, 222, 241, 289, 321, 327, 332, 334, 393, 515, 622, 730, 948, 1057, 1059, 1101, 1136, 1180, 1242, 1271, 1371}
+	tests := []struct {
+		name  string
+		lists func(p Plain) [][]int
+		want  [][]int
+		rnd   []int
+	}{
+		{
+			name: "auth_chain_b",
+			lists: func(p Plain) [][]int {
+				return [][]int{p.(*AuthChainB).DataSizeList, p.(*AuthChainB).DataSizeList2}
+			},
+			want: [][]int{
+				{46, 241, 289, 334, 622, 730, 1057, 1271},
+				{96, 112, 168, 222, 321, 327, 332, 393, 492, 515, 579, 948, 1059, 1136, 1180, 1242, 1371},
+			},
+			rnd: []int{721, 720, 250, 1162, 439, 0, 0, 0, 0},
+		},
+		{
+			name:  "auth_chain_c",
+			lists: func(p Plain) [][]int { return [][]int{p.(*AuthChainC).DataSizeList0} },
+			want:  [][]int{listCDE},
+			rnd:   []int{232, 1232, 295, 992, 548, 127, 12, 0, 0},
+		},
+		{
+			name:  "auth_chain_d",
+			lists: func(p Plain) [][]int { return [][]int{p.(*AuthChainD).DataSizeList0} },
+			want:  [][]int{listCDE},
+			rnd:   []int{232, 1232, 295, 992, 548, 127, 12, 0, 0},
+		},
+		{
+			name:  "auth_chain_e",
+			lists: func(p Plain) [][]int { return [][]int{p.(*AuthChainE).DataSizeList0} },
+			want:  [][]int{listCDE},
+			rnd:   []int{37, 36, 7, 3, 6, 48, 12, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := GetObfs(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.SetServerInfo(serverInfo)
+			if got := tt.lists(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("data size list = %v, want %v", got, tt.want)
+			}
+			a := reflect.ValueOf(p).Elem().FieldByName("AuthChainA").Interface().(*AuthChainA)
+			for i, size := range authChainRndBufSizes {
+				if got := a.rndDataLen(size, lastHash, NewXorShift128Plus()); got != tt.rnd[i] {
+					t.Errorf("rndDataLen(%v) = %v, want %v", size, got, tt.rnd[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthChainFDataSize(t *testing.T) {
+	p, _ := NewAuthChainF("auth_chain_f")
+	f := p.(*AuthChainF)
+	serverInfo := NewServerInfo()
+	serverInfo.SetOverhead(9)
+	f.AuthChainA.SetServerInfo(serverInfo)
+	f.KeyChangeDatetimeKey = 1600000000 / 86400
+	f.initDataSize(MustHexDecode("b36d331451a61eb2d76860e00c347396"))
+
+	want := []int{27, 38, 105, 112, 117, 117, 131, 134, 141, 181, 188, 212, 225, 240, 252, 264, 272, 273, 292, 294, 300, 362, 385, 397, 856, 942, 958, 977, 1073, 1131, 1365, 1410}
+	if !reflect.DeepEqual(f.DataSizeList0, want) {
+		t.Fatalf("data size list = %v, want %v", f.DataSizeList0, want)
+	}
+	wantRnd := []int{18, 17, 66, 3, 347, 64, 6, 0, 0}
+	lastHash := hmacmd5([]byte("killer"), []byte("abcd"))
+	for i, size := range authChainRndBufSizes {
+		if got := f.rndDataLen(size, lastHash, NewXorShift128Plus()); got != wantRnd[i] {
+			t.Errorf("rndDataLen(%v) = %v, want %v", size, got, wantRnd[i])
+		}
+	}
+}
+
+func TestAuthChainDuplex(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("hello"),
+		[]byte(strings.Repeat("a", 1000)),
+		[]byte(strings.Repeat("b", 5000)),
+	}
+	for _, method := range []string{"auth_chain_a", "auth_chain_b", "auth_chain_c", "auth_chain_d", "auth_chain_e", "auth_chain_f"} {
+		t.Run(method, func(t *testing.T) {
+			client := getAuthChain(method)
+			server := getAuthChain(method)
+			for _, payload := range payloads {
+				ciphertext, err := client.ClientPreEncrypt(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cleartext, _, err := server.ServerPostDecrypt(ciphertext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(cleartext, payload) {
+					t.Fatalf("server decrypt %d bytes, want %d bytes", len(cleartext), len(payload))
+				}
+
+				ciphertext, err = server.ServerPreEncrypt(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cleartext, err = client.ClientPostDecrypt(ciphertext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(cleartext, payload) {
+					t.Fatalf("client decrypt %d bytes, want %d bytes", len(cleartext), len(payload))
+				}
+			}
+
+			client, server = getAuthChain(method), getAuthChain(method)
+			ciphertext, err := client.ClientUDPPreEncrypt([]byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cleartext, uid, err := server.ServerUDPPostDecrypt(ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(cleartext) != "hello" || binaryx.LEBytesToUInt32([]byte(uid)) != 1024 {
+				t.Fatalf("udp decrypt %q from uid %v", cleartext, binaryx.LEBytesToUInt32([]byte(uid)))
+			}
+		})
+	}
+}
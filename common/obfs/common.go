@@ -191,6 +191,9 @@ func (c *ClientQueue) Insert(connectionID int) bool {
 
 /* ---------------------------- ObfsAuthChainData ---------------------------- */
 
+// DefaultMaxClient is the client limit of each user when node has no client_limit
+const DefaultMaxClient = 64
+
 type ObfsAuthChainData struct {
 	Name          string
 	UserID        map[string]*cache.LRU
@@ -207,7 +210,7 @@ func NewObfsAuthChainData(name string) *ObfsAuthChainData {
 		LocalClientId: []byte{},
 		ConnectionID:  0,
 	}
-	result.SetMaxClient(64)
+	result.SetMaxClient(DefaultMaxClient)
 	return result
 }
 
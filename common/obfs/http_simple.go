@@ -15,6 +15,7 @@ import (
 
 func init() {
 	registerMethod("http_simple", NewHttpSimple)
+	registerMethod("http_post", NewHttpPost)
 }
 
 var USER_AGENT = []string{
@@ -42,7 +43,7 @@ func strMatchBegin(str1, str2 string) bool {
 }
 
 type HttpSimple struct {
-	Plain
+	*AuthBase
 	hasSentHeader bool
 	hasRecvHeader bool
 	host          string
@@ -51,12 +52,18 @@ type HttpSimple struct {
 }
 
 func NewHttpSimple(method string) (Plain, error) {
-	newPlain, err := NewPlain(method)
+	return newHttpSimple(method, "http_simple")
+}
+
+func newHttpSimple(method, noCompatibleMethod string) (*HttpSimple, error) {
+	authBase, err := NewAuthBase(method)
 	if err != nil {
 		return nil, err
 	}
+	authBase.NoCompatibleMethod = noCompatibleMethod
+	authBase.Overhead = 0
 	return &HttpSimple{
-		Plain: newPlain,
+		AuthBase: authBase,
 	}, nil
 }
 
@@ -122,7 +129,7 @@ func (h *HttpSimple) getHostFromHttpHeader(buf []byte) string {
 func (h *HttpSimple) notMatchReturn(buf []byte) ([]byte, bool, bool, error) {
 	h.hasSentHeader = true
 	h.hasRecvHeader = true
-	if h.GetMethod() == "http_simple" {
+	if h.GetMethod() == h.NoCompatibleMethod {
 		return bytes.Repeat([]byte("E"), 2048), false, false, nil
 	}
 	return buf, true, false, nil
@@ -135,6 +142,12 @@ func (h *HttpSimple) errorReturn(buf []byte) ([]byte, bool, bool, error) {
 }
 
 func (h *HttpSimple) ClientEncode(buf []byte) ([]byte, error) {
+	return h.clientEncode(buf, "GET", "")
+}
+
+// clientEncode build the first request with the given http method,
+// extraHeader is insert before DNT when no custom header body configured
+func (h *HttpSimple) clientEncode(buf []byte, httpMethod string, extraHeader string) ([]byte, error) {
 	if h.hasSentHeader {
 		return buf, nil
 	}
@@ -167,7 +180,7 @@ func (h *HttpSimple) ClientEncode(buf []byte) ([]byte, error) {
 	}
 	hostArr := strings.Split(hosts, ",")
 	host := randomx.RandomStringsChoice(hostArr)
-	httpHead := bytesx.ContactSlice([]byte("GET /"), h.encodeHead(headData), []byte(" HTTP/1.1\r\n"))
+	httpHead := bytesx.ContactSlice([]byte(httpMethod+" /"), h.encodeHead(headData), []byte(" HTTP/1.1\r\n"))
 	httpHead = bytesx.ContactSlice(httpHead, []byte("Host: "), []byte(host), port, []byte("\r\n"))
 	if len(body) > 0 {
 		httpHead = bytesx.ContactSlice(httpHead, body, []byte("\r\n\r\n"))
@@ -175,7 +188,8 @@ func (h *HttpSimple) ClientEncode(buf []byte) ([]byte, error) {
 		httpHead = bytesx.ContactSlice(httpHead, []byte("User-Agent: "),
 			[]byte(randomx.RandomStringsChoice(USER_AGENT)),
 			[]byte("\r\n"))
-		httpHead = bytesx.ContactSlice(httpHead, []byte("Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\nAccept-Language: en-US,en;q=0.8\r\nAccept-Encoding: gzip, deflate\r\nDNT: 1\r\nConnection: keep-alive\r\n\r\n"))
+		httpHead = bytesx.ContactSlice(httpHead, []byte("Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\nAccept-Language: en-US,en;q=0.8\r\nAccept-Encoding: gzip, deflate\r\n"))
+		httpHead = bytesx.ContactSlice(httpHead, []byte(extraHeader), []byte("DNT: 1\r\nConnection: keep-alive\r\n\r\n"))
 	}
 	h.hasSentHeader = true
 	return bytesx.ContactSlice(httpHead, buf), nil
@@ -266,3 +280,34 @@ func (h *HttpSimple) ServerDecode(buf []byte) ([]byte, bool, bool, error) {
 		return []byte{}, true, false, nil
 	}
 }
+
+/*---HttpPost---*/
+
+const boundaryChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// HttpPost same as http_simple,but client send a POST request with a multipart body
+type HttpPost struct {
+	*HttpSimple
+}
+
+func NewHttpPost(method string) (Plain, error) {
+	httpSimple, err := newHttpSimple(method, "http_post")
+	if err != nil {
+		return nil, err
+	}
+	return &HttpPost{
+		HttpSimple: httpSimple,
+	}, nil
+}
+
+func (h *HttpPost) boundary() string {
+	result := make([]byte, 32)
+	for i := range result {
+		result[i] = boundaryChars[randomx.RandIntRange(0, len(boundaryChars)-1)]
+	}
+	return string(result)
+}
+
+func (h *HttpPost) ClientEncode(buf []byte) ([]byte, error) {
+	return h.clientEncode(buf, "POST", "Content-Type: multipart/form-data; boundary="+h.boundary()+"\r\n")
+}
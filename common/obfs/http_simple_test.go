@@ -1,14 +1,57 @@
 package obfs
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"strings"
+	"testing"
 )
 
 func ExampleClientEncode(){
-	h := NewHttpSimple("http_simple").(*HttpSimple)
+	p, _ := NewHttpSimple("http_simple")
+	h := p.(*HttpSimple)
 	data := h.encodeHead([]byte("helloa"))
 	fmt.Printf(hex.EncodeToString(data))
 	//Output:
 	//253638253635253663253663253666
 }
+
+func TestHttpPost(t *testing.T) {
+	newObfs := func(method string) Plain {
+		p, err := GetObfs(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverInfo := NewServerInfo()
+		serverInfo.SetHost("www.example.com")
+		serverInfo.SetPort(80)
+		p.SetServerInfo(serverInfo)
+		return p
+	}
+	client, server := newObfs("http_post"), newObfs("http_post")
+	payload := []byte("0123456789abcdef")
+	result, err := client.ClientEncode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(result), "POST /") || !strings.Contains(string(result), "Content-Type: multipart/form-data; boundary=") {
+		t.Fatalf("ClientEncode() = %q", result)
+	}
+	data, needDecrypt, _, err := server.ServerDecode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) || !needDecrypt {
+		t.Fatalf("ServerDecode() = %x, want %x", data, payload)
+	}
+
+	data, needDecrypt, _, _ = newObfs("http_post").ServerDecode([]byte("\x16\x03\x01\x02\x00abcdefgh"))
+	if len(data) != 2048 || needDecrypt {
+		t.Errorf("http_post not match return %d bytes", len(data))
+	}
+	data, needDecrypt, _, _ = newObfs("http_post_compatible").ServerDecode([]byte("\x16\x03\x01\x02\x00abcdefgh"))
+	if string(data) != "\x16\x03\x01\x02\x00abcdefgh" || !needDecrypt {
+		t.Errorf("http_post_compatible not match return %q", data)
+	}
+}
@@ -1,5 +1,15 @@
 package obfs
 
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// COMPATIBLE_SUFFIX method with this suffix fallback to origin when client handshake not match,
+// so plain shadowsocks client can still connect
+const COMPATIBLE_SUFFIX = "_compatible"
+
 type PlainFactory func(string) (Plain,error)
 
 // Plain interface
@@ -35,6 +45,15 @@ func registerMethod(method string, factory PlainFactory) {
 	method_supported[method] = factory
 }
 
+// GetObfs create obfs or protocol by method, "xxx_compatible" use the factory of "xxx",
+// the full method name is passed to factory to decide whether fallback is allowed
 func GetObfs(method string) (Plain,error){
-	return method_supported[method](method)
+	factory, ok := method_supported[method]
+	if !ok && strings.HasSuffix(method, COMPATIBLE_SUFFIX) {
+		factory, ok = method_supported[strings.TrimSuffix(method, COMPATIBLE_SUFFIX)]
+	}
+	if !ok {
+		return nil, errors.Errorf("obfs or protocol %s is not supported", method)
+	}
+	return factory(method)
 }
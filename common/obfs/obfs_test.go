@@ -1,7 +1,9 @@
 package obfs
 
 import (
+	"bytes"
 	"fmt"
+	"testing"
 	"time"
 )
 
@@ -10,8 +12,53 @@ func ExampleTime() {
 	//Output:
 }
 
-
-func ExampleGetObfs(){
+func ExampleGetObfs() {
 	GetObfs("obfs")
 	//Output:
-}
\ No newline at end of file
+}
+
+func TestGetObfs(t *testing.T) {
+	for _, method := range []string{"plain", "http_simple_compatible", "tls1.2_ticket_auth_compatible", "auth_aes128_md5_compatible", "auth_chain_a_compatible"} {
+		p, err := GetObfs(method)
+		if err != nil {
+			t.Fatalf("GetObfs(%s) error: %v", method, err)
+		}
+		if p.GetMethod() != method {
+			t.Errorf("GetObfs(%s).GetMethod() = %s", method, p.GetMethod())
+		}
+	}
+	for _, method := range []string{"obfs", "_compatible", "plain_compatible_compatible"} {
+		if _, err := GetObfs(method); err == nil {
+			t.Errorf("GetObfs(%s) want error", method)
+		}
+	}
+}
+
+func TestCompatibleNotMatchReturn(t *testing.T) {
+	buf := []byte("plain shadowsocks data")
+	for method, want := range map[string][]byte{
+		"auth_chain_a":                bytes.Repeat([]byte("E"), 2048),
+		"auth_chain_a_compatible":     buf,
+		"auth_aes128_sha1":            bytes.Repeat([]byte("E"), 2048),
+		"auth_aes128_sha1_compatible": buf,
+	} {
+		p, err := GetObfs(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverInfo := NewServerInfo()
+		serverInfo.SetKey([]byte("key"))
+		serverInfo.SetRecvIv([]byte("iv"))
+		p.SetServerInfo(serverInfo)
+		result, _, err := p.ServerPostDecrypt(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, want) {
+			t.Errorf("%s ServerPostDecrypt() = %q", method, result)
+		}
+		if p.GetOverhead(false) != 0 {
+			t.Errorf("%s overhead after fallback = %d", method, p.GetOverhead(false))
+		}
+	}
+}
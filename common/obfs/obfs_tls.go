@@ -14,7 +14,6 @@ import (
 
 	"github.com/ProxyPanel/VNet-SSR/common/cache"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
-	"github.com/ProxyPanel/VNet-SSR/utils/arrayx"
 	"github.com/ProxyPanel/VNet-SSR/utils/randomx"
 	"github.com/ProxyPanel/VNet-SSR/utils/stringx"
 )
@@ -29,6 +28,7 @@ var (
 
 func init() {
 	registerMethod("tls1.2_ticket_auth", NewObfsTLS)
+	registerMethod("tls1.2_ticket_fastauth", NewObfsTLS)
 }
 
 type ObfsAuthData struct {
@@ -49,7 +49,7 @@ func NewObfsAuthData() *ObfsAuthData {
 }
 
 type ObfsTLS struct {
-	Plain
+	*AuthBase
 	*ObfsAuthData
 	HandshakeStatus int
 	SendBuffer      []byte
@@ -57,28 +57,27 @@ type ObfsTLS struct {
 	ClientID        []byte
 	MaxTimeDiff     int
 	TLSVersion      []byte
-	Overhead        int
+	// FastAuth client send finished with client hello, skip waiting for server hello
+	FastAuth bool
 }
 
 func NewObfsTLS(method string) (Plain, error) {
-	newPlain, err := NewPlain(method)
+	authBase, err := NewAuthBase(method)
 	if err != nil {
 		return nil, err
 	}
+	authBase.NoCompatibleMethod = strings.TrimSuffix(method, COMPATIBLE_SUFFIX)
+	authBase.Overhead = DEFAULT_OVERHEAD
 	return &ObfsTLS{
-		Plain:           newPlain,
+		AuthBase:        authBase,
 		HandshakeStatus: 0,
 		MaxTimeDiff:     DEFAULT_MAX_TIME_DIFF,
 		TLSVersion:      DEFAULT_VERSION,
-		Overhead:        DEFAULT_OVERHEAD,
 		ObfsAuthData:    NewObfsAuthData(),
+		FastAuth:        authBase.NoCompatibleMethod == "tls1.2_ticket_fastauth",
 	}, nil
 }
 
-func (otls *ObfsTLS) GetOverhead(direction bool) int {
-	return otls.Overhead
-}
-
 func (otls *ObfsTLS) GetServerInfo() ServerInfo {
 	return otls.Plain.GetServerInfo()
 }
@@ -149,7 +148,7 @@ func (otls *ObfsTLS) ClientEncode(buf []byte) ([]byte, error) {
 		}
 		binary.Write(ext, binary.BigEndian, conbineToBytes(
 			[]byte{0x00, 0x23},
-			len(otls.ObfsAuthData.TicketBuf[host]),
+			uint16(len(otls.ObfsAuthData.TicketBuf[host])),
 			otls.ObfsAuthData.TicketBuf[host]))
 
 		binary.Write(ext, binary.BigEndian, MustHexDecode("000d001600140601060305010503040104030301030302010203"))
@@ -165,20 +164,30 @@ func (otls *ObfsTLS) ClientEncode(buf []byte) ([]byte, error) {
 
 		result := conbineToBytes([]byte{0x01, 0x00}, uint16(data.Len()), data.Bytes())
 		result = conbineToBytes([]byte{0x16, 0x03, 0x01}, uint16(len(result)), result)
+		if otls.FastAuth {
+			// status 9: data can be sent, but server hello is not received yet
+			otls.HandshakeStatus = 9
+			result = conbineToBytes(result, otls.clientFinished())
+		}
 		return result, nil
 	} else if otls.HandshakeStatus == 1 && len(buf) == 0 {
-		data := conbineToBytes(byte(0x14), otls.TLSVersion, []byte{0x00, 0x01, 0x01}) //ChangeCipherSpec
-		data = conbineToBytes(data, byte(0x16), otls.TLSVersion, []byte{0x00, 0x20}, randomx.RandomBytes(22))
-		data = conbineToBytes(data, hmacsha1(conbineToBytes(otls.GetServerInfo().GetKey(), otls.ObfsAuthData.ClientID), data)[:10])
-		ret := conbineToBytes(data, otls.SendBuffer)
-		otls.SendBuffer = []byte{}
 		otls.HandshakeStatus = 8
-		return ret, nil
+		return otls.clientFinished(), nil
 	}
 
 	return []byte{}, nil
 }
 
+// clientFinished return ChangeCipherSpec and Finished message with the pending data
+func (otls *ObfsTLS) clientFinished() []byte {
+	data := conbineToBytes(byte(0x14), otls.TLSVersion, []byte{0x00, 0x01, 0x01}) //ChangeCipherSpec
+	data = conbineToBytes(data, byte(0x16), otls.TLSVersion, []byte{0x00, 0x20}, randomx.RandomBytes(22))
+	data = conbineToBytes(data, hmacsha1(conbineToBytes(otls.GetServerInfo().GetKey(), otls.ObfsAuthData.ClientID), data)[:10])
+	ret := conbineToBytes(data, otls.SendBuffer)
+	otls.SendBuffer = []byte{}
+	return ret
+}
+
 //ClientDecode buffer_to_recv, is_need_to_encode_and_send_back
 func (otls *ObfsTLS) ClientDecode(buf []byte) ([]byte, bool, error) {
 	if otls.HandshakeStatus == -1 {
@@ -202,19 +211,66 @@ func (otls *ObfsTLS) ClientDecode(buf []byte) ([]byte, bool, error) {
 		}
 		return ret.Bytes(), false, nil
 	}
+	if otls.HandshakeStatus == 9 {
+		// fastauth: server hello may arrive with appdata, split it by tls record
+		otls.RecvBuffer = conbineToBytes(otls.RecvBuffer, buf)
+		handshakeLen, err := serverHandshakeLen(otls.RecvBuffer)
+		if err != nil {
+			return nil, false, err
+		}
+		if handshakeLen == 0 {
+			return []byte{}, false, nil
+		}
+		if err := otls.verifyServerHello(otls.RecvBuffer[:handshakeLen]); err != nil {
+			return nil, false, err
+		}
+		otls.RecvBuffer = otls.RecvBuffer[handshakeLen:]
+		otls.HandshakeStatus = 8
+		return otls.ClientDecode([]byte{})
+	}
+
+	if err := otls.verifyServerHello(buf); err != nil {
+		return nil, false, err
+	}
+	return []byte{}, true, nil
+}
 
+func (otls *ObfsTLS) verifyServerHello(buf []byte) error {
 	if len(buf) < 11+32+1+32 {
-		return nil, false, errors.New("client_decode data error")
+		return errors.New("client_decode data error")
 	}
 
 	verify := buf[11:33]
 	if !bytes.Equal(hmacsha1(conbineToBytes(otls.GetServerInfo().GetKey(), otls.ObfsAuthData.ClientID), verify)[:10], buf[33:43]) {
-		return nil, false, errors.New("client_decode data error")
+		return errors.New("client_decode data error")
 	}
 	if !bytes.Equal(hmacsha1(conbineToBytes(otls.GetServerInfo().GetKey(), otls.ObfsAuthData.ClientID), buf[:len(buf)-10])[:10], buf[len(buf)-10:]) {
-		return nil, false, errors.New("client_decode data error")
+		return errors.New("client_decode data error")
 	}
-	return []byte{}, true, nil
+	return nil
+}
+
+// serverHandshakeLen return the length of server handshake messages end with Finished,
+// return 0 if the handshake is not complete yet
+func serverHandshakeLen(buf []byte) (int, error) {
+	offset := 0
+	changeCipherSpec := false
+	for len(buf)-offset >= 5 {
+		contentType := buf[offset]
+		size := int(binary.BigEndian.Uint16(buf[offset+3 : offset+5]))
+		if contentType != 0x16 && contentType != 0x14 {
+			return 0, errors.New("client_decode handshake error")
+		}
+		if len(buf)-offset < size+5 {
+			return 0, nil
+		}
+		offset += size + 5
+		if changeCipherSpec {
+			return offset, nil
+		}
+		changeCipherSpec = contentType == 0x14
+	}
+	return 0, nil
 }
 
 func (otls *ObfsTLS) ServerEncode(buf []byte) ([]byte, error) {
@@ -248,7 +304,7 @@ func (otls *ObfsTLS) ServerEncode(buf []byte) ([]byte, error) {
 	data = conbineToBytes(byte(0x16), otls.TLSVersion, uint16(len(data)), data)
 	if int(randomx.Float64Range(0, 8)) < 1 {
 		ticket := randomx.RandomBytes(int((randomx.Uint16()%164)*2) + 64)
-		ticket = conbineToBytes(uint16(len(ticket)+4), []byte{0x04, 0x00}, len(ticket), ticket)
+		ticket = conbineToBytes(uint16(len(ticket)+4), []byte{0x04, 0x00}, uint16(len(ticket)), ticket)
 		data = conbineToBytes(data, byte(0x16), otls.TLSVersion, ticket) // New session ticket
 	}
 	data = conbineToBytes(data, byte(0x14), otls.TLSVersion, []byte{0x00, 0x01, 0x01}) // ChangeCipherSpec
@@ -428,7 +484,7 @@ func (otls *ObfsTLS) DecodeErrorReturn(buf []byte) ([]byte, bool, bool, error) {
 		otls.GetServerInfo().SetOverhead(otls.GetServerInfo().GetOverhead() - otls.Overhead)
 	}
 	otls.Overhead = 0
-	if arrayx.FindStringInArray(otls.Plain.GetMethod(), []string{"tls1.2_ticket_auth", "tls1.2_ticket_fastauth"}) {
+	if otls.GetMethod() == otls.NoCompatibleMethod {
 		return bytes.Repeat([]byte{byte('E')}, 2048), false, false, nil
 	}
 
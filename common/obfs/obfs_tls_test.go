@@ -3,6 +3,7 @@ package obfs
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"reflect"
@@ -24,9 +25,11 @@ func TestObfsTLS_packAuthData(t *testing.T) {
 		{
 			name: "test",
 			otls: &ObfsTLS{
-				Plain: &plain{
-					ServerInfo: &serverInfo{
-						Key: []byte{0x01, 0x02, 0x03, 0x04},
+				AuthBase: &AuthBase{
+					Plain: &plain{
+						ServerInfo: &serverInfo{
+							Key: []byte{0x01, 0x02, 0x03, 0x04},
+						},
 					},
 				},
 			},
@@ -94,9 +97,11 @@ func TestObfsTLS_sni(t *testing.T) {
 		{
 			name: "test1",
 			otls: &ObfsTLS{
-				Plain: &plain{
-					ServerInfo: &serverInfo{
-						Key: []byte{0x01, 0x02, 0x03, 0x04},
+				AuthBase: &AuthBase{
+					Plain: &plain{
+						ServerInfo: &serverInfo{
+							Key: []byte{0x01, 0x02, 0x03, 0x04},
+						},
 					},
 				},
 			},
@@ -117,9 +122,11 @@ func TestObfsTLS_sni(t *testing.T) {
 
 func BenchmarkObfsTLS_sni(b *testing.B) {
 	otls := &ObfsTLS{
-		Plain: &plain{
-			ServerInfo: &serverInfo{
-				Key: []byte{0x01, 0x02, 0x03, 0x04},
+		AuthBase: &AuthBase{
+			Plain: &plain{
+				ServerInfo: &serverInfo{
+					Key: []byte{0x01, 0x02, 0x03, 0x04},
+				},
 			},
 		},
 	}
@@ -138,38 +145,40 @@ func TestObfsTLS_ClientEncode(t *testing.T) {
 		name    string
 		otls    *ObfsTLS
 		args    args
-		want    []byte
+		wantSNI string
 		wantErr bool
 	}{
-		// TODO: Add test cases.
 		{
-			name: "test",
+			name: "obfs param",
 			otls: &ObfsTLS{
-				Plain: &plain{
-					ServerInfo: &serverInfo{
-						Key:           []byte{0x01, 0x02, 0x03, 0x04},
-						ProtocolParam: "",
-						Host:          "0.0.0.0",
-						Port:          3306,
-						HeadLen:       30,
-						TCPMss:        1460,
-						BufferSize:    65535,
+				AuthBase: &AuthBase{
+					Plain: &plain{
+						ServerInfo: &serverInfo{
+							Key:        []byte{0x01, 0x02, 0x03, 0x04},
+							Host:       "0.0.0.0",
+							ObfsParam:  "example.com",
+							Port:       3306,
+							HeadLen:    30,
+							TCPMss:     1460,
+							BufferSize: 65535,
+						},
 					},
 				},
+				TLSVersion:   DEFAULT_VERSION,
 				ObfsAuthData: NewObfsAuthData(),
 			},
 			args: args{
 				[]byte{0x01, 0x02, 0x03, 0x04},
 			},
-			want: []byte{
-				0x16, 0x3, 0x1, 0x2, 0x3a, 0x1, 0x0, 0x2, 0x36, 0x3, 0x3, 0x5c, 0x79, 0xf9, 0x5f, 0xc1, 0xe9, 0xd, 0xb8, 0x58, 0xd0, 0xfc, 0xd4, 0x9f, 0xcf, 0x3e, 0x6c, 0x45, 0x2d, 0x58, 0x1e, 0xb8, 0x8d, 0xea, 0xf4, 0x75, 0x85, 0xac, 0x58, 0x4e, 0x5, 0xd5, 0x64, 0x20, 0x2b, 0xbd, 0x4f, 0xc1, 0x5a, 0xc8, 0x4a, 0x1c, 0x5, 0xa1, 0x83, 0x35, 0xee, 0x7d, 0x9d, 0xbf, 0x4c, 0xa9, 0x51, 0xa2, 0xc6, 0x16, 0x72, 0xdb, 0x17, 0x36, 0xf0, 0x9f, 0x5c, 0x1, 0xac, 0xb6, 0x0, 0x1c, 0xc0, 0x2b, 0xc0, 0x2f, 0xcc, 0xa9, 0xcc, 0xa8, 0xcc, 0x14, 0xcc, 0x13, 0xc0, 0xa, 0xc0, 0x14, 0xc0, 0x9, 0xc0,
-				0x13, 0x0, 0x9c, 0x0, 0x35, 0x0, 0x2f, 0x0, 0xa, 0x1, 0x0, 0x1, 0xd1, 0xff, 0x1, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x5, 0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x17, 0x0, 0x0, 0x0, 0x23, 0x1, 0x80,
-				0x0, 0x4, 0x4, 0x34, 0x91, 0x6c, 0x6a, 0xf1, 0x7b, 0x6c, 0x47, 0x8e, 0x33, 0xc7, 0x8d, 0xff, 0xce, 0x95, 0x98, 0xc9, 0xc1, 0x6f, 0xc7, 0x1b, 0xc4, 0x1, 0xa7, 0xb7, 0x33, 0x22, 0x7c, 0xc2, 0x88, 0x13, 0x2f, 0xc9, 0x35, 0xe8, 0x74, 0x78, 0xe9, 0x57, 0x27, 0x73, 0xae, 0xcd, 0xd6, 0xd9, 0xc8, 0x5, 0x53, 0xf9, 0x57, 0xe, 0xf0, 0x27, 0x56, 0x8b, 0x5, 0x27, 0x4a, 0xd2, 0x16, 0x33, 0x71, 0xb6, 0xb7, 0x75, 0xc0, 0x8d, 0xe5, 0x1, 0x61, 0xec, 0x36, 0x89, 0xd3, 0xe5, 0x81, 0x23, 0x1b, 0x3f, 0xde, 0x1d, 0x3e, 0x1a, 0xd1, 0x69, 0x20, 0x23, 0x7d, 0x7d, 0xf6, 0xa5, 0xd6, 0x4e, 0x99, 0x36, 0x79, 0xb9, 0xdd, 0xa7, 0x51, 0x87, 0x9a, 0x74, 0xb8, 0x8c, 0xc0, 0xe3, 0x69, 0x5, 0x29, 0xfb, 0xb6, 0xad, 0xed, 0x83, 0x79, 0xcf, 0x58, 0xb8, 0x8e, 0x14, 0xe1, 0xd1, 0x7c, 0x6c, 0x90, 0x24, 0x5f, 0xd4, 0xa2, 0x9b, 0xea, 0x3a, 0x1d, 0xf, 0x48, 0xb8, 0x29, 0xd3, 0x8d, 0x98, 0x7b, 0x9d, 0xd8, 0x48, 0x3a, 0xb1, 0xdb, 0xf3, 0xc4, 0x27, 0x48, 0xf6, 0x28, 0xf4, 0xdb, 0x41,
-				0x21, 0xd1, 0x81, 0x28, 0x3e, 0xf, 0xee, 0x94, 0x1a, 0x24, 0xd7, 0x7c, 0x3a, 0xdb, 0x2b, 0xd, 0xf5, 0x7b, 0x7e, 0x1b, 0x8a, 0x1d, 0x5f, 0x6d, 0x8d, 0x78, 0x76, 0x85, 0x65, 0xd9, 0x7, 0x49, 0x5e, 0xf2, 0x78, 0x18, 0x70, 0x35, 0x64, 0xb9, 0xdc, 0x82, 0x4c, 0xe2, 0xa0, 0x81, 0x93, 0xd1,
-				0xe0, 0xd5, 0xfe, 0xf0, 0x41, 0xdc, 0x36, 0xed, 0x10, 0xa5, 0x72, 0x8b, 0xb, 0x9e, 0x31, 0x9, 0x72, 0x30, 0xb4, 0x14, 0x54, 0xc7, 0x5a, 0x20, 0x35, 0x8a, 0xe6, 0x98, 0x62, 0x5f, 0x31, 0x5f,
-				0x76, 0xc1, 0xea, 0x1c, 0xad, 0x73, 0xce, 0x68, 0x4f, 0xff, 0x31, 0x9d, 0x97, 0x64, 0xda, 0xd1, 0x6f, 0x6e, 0x83, 0xc0, 0xfe, 0x3e, 0xac, 0x61, 0x33, 0x35, 0xca, 0x5, 0xb8, 0x14, 0xa2, 0x34, 0x1f, 0x6c, 0x2b, 0xfa, 0x51, 0x2e, 0x9f, 0x8d, 0x3e, 0xfd, 0x5c, 0xfb, 0x67, 0x11, 0x6a, 0x27, 0xdc, 0x92, 0x34, 0x14, 0x64, 0xcb, 0x4b, 0xa5, 0xa4, 0x9c, 0xd3, 0x87, 0x24, 0x55, 0x4b, 0xba, 0x49, 0x3e, 0xf0, 0x27, 0x72, 0x74, 0x83, 0x2, 0xb9, 0xbd, 0x34, 0x65, 0x25, 0xe8, 0x5d, 0xeb, 0x96, 0x0, 0xab, 0x18, 0x85, 0xe7, 0x5d, 0x53, 0x8, 0x61, 0x39, 0x9a, 0xd7, 0x70, 0x93, 0xcd, 0x95, 0xd2, 0x23, 0x58, 0x8, 0x12, 0xef, 0x1b, 0x16, 0xd2, 0x73, 0xb2, 0xe0, 0x3f, 0x23, 0x5b, 0xcb, 0x10, 0x34, 0x64, 0x38, 0xf0, 0x67, 0x9b, 0xcf, 0xa7, 0xae, 0xb, 0x97, 0xcb, 0x8f, 0xd9, 0x16, 0xd6, 0xad, 0x3, 0xb2, 0xe7, 0x6d, 0x84, 0x6d, 0x76, 0x40, 0x75, 0x8e, 0x29, 0xe8, 0xba, 0x0, 0xd, 0x0, 0x16, 0x0, 0x14, 0x6, 0x1, 0x6, 0x3, 0x5, 0x1, 0x5, 0x3, 0x4, 0x1, 0x4, 0x3, 0x3, 0x1, 0x3, 0x3, 0x2, 0x1, 0x2, 0x3, 0x0, 0x5, 0x0, 0x5, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x12, 0x0, 0x0, 0x75, 0x50, 0x0, 0x0, 0x0, 0xb, 0x0, 0x2, 0x1, 0x0, 0x0, 0xa, 0x0, 0x6, 0x0, 0x4, 0x0, 0x17, 0x0, 0x18,
+			wantSNI: "example.com",
+		},
+		{
+			name: "ip host",
+			otls: InitObfs(),
+			args: args{
+				[]byte{0x01, 0x02, 0x03, 0x04},
 			},
-			wantErr: false,
+			wantSNI: "",
 		},
 	}
 	for _, tt := range tests {
@@ -179,8 +188,28 @@ func TestObfsTLS_ClientEncode(t *testing.T) {
 				t.Errorf("ObfsTLS.ClientEncode() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("ObfsTLS.ClientEncode() = %v, want %v", got, tt.want)
+			// client hello is random, so only its structure is checked:
+			// record header, handshake header, version, session id, sni and the last extension
+			if len(got) < 9+2+32+1+32 {
+				t.Fatalf("ObfsTLS.ClientEncode() length = %v", len(got))
+			}
+			if !bytes.Equal(got[:3], []byte{0x16, 0x03, 0x01}) || int(binary.BigEndian.Uint16(got[3:5])) != len(got)-5 {
+				t.Errorf("record header = %x, length %v", got[:5], len(got))
+			}
+			if got[5] != 0x01 || int(got[6])<<16|int(binary.BigEndian.Uint16(got[7:9])) != len(got)-9 {
+				t.Errorf("handshake header = %x, length %v", got[5:9], len(got))
+			}
+			if !bytes.Equal(got[9:11], DEFAULT_VERSION) {
+				t.Errorf("version = %x, want %x", got[9:11], DEFAULT_VERSION)
+			}
+			if got[43] != 0x20 || !bytes.Equal(got[44:76], tt.otls.ObfsAuthData.ClientID) {
+				t.Errorf("session id = %x, want %x", got[43:76], tt.otls.ObfsAuthData.ClientID)
+			}
+			if !bytes.Contains(got[76:], tt.otls.sni(tt.wantSNI)) {
+				t.Errorf("client hello has no sni %q", tt.wantSNI)
+			}
+			if !bytes.HasSuffix(got, MustHexDecode("000a0006000400170018")) {
+				t.Errorf("client hello ends with %x", got[len(got)-10:])
 			}
 		})
 	}
@@ -318,15 +347,17 @@ func ExampleSlice() {
 
 func InitObfs() *ObfsTLS {
 	otls := &ObfsTLS{
-		Plain: &plain{
-			ServerInfo: &serverInfo{
-				Key:           []byte{0x01, 0x02, 0x03, 0x04},
-				ProtocolParam: "",
-				Host:          "0.0.0.0",
-				Port:          3306,
-				HeadLen:       30,
-				TCPMss:        1460,
-				BufferSize:    65535,
+		AuthBase: &AuthBase{
+			Plain: &plain{
+				ServerInfo: &serverInfo{
+					Key:           []byte{0x01, 0x02, 0x03, 0x04},
+					ProtocolParam: "",
+					Host:          "0.0.0.0",
+					Port:          3306,
+					HeadLen:       30,
+					TCPMss:        1460,
+					BufferSize:    65535,
+				},
 			},
 		},
 		TLSVersion:   DEFAULT_VERSION,
@@ -334,3 +365,79 @@ func InitObfs() *ObfsTLS {
 	}
 	return otls
 }
+
+func TestObfsTLS_FastAuth(t *testing.T) {
+	newObfs := func() Plain {
+		otls, err := GetObfs("tls1.2_ticket_fastauth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverInfo := NewServerInfo()
+		serverInfo.SetKey([]byte{0x01, 0x02, 0x03, 0x04})
+		serverInfo.SetHost("0.0.0.0")
+		otls.SetServerInfo(serverInfo)
+		return otls
+	}
+	client, server := newObfs(), newObfs()
+
+	// client hello, finished and data are sent in one round trip
+	result, err := client.ClientEncode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, needDecrypt, needSendBack, err := server.ServerDecode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" || !needDecrypt || !needSendBack {
+		t.Fatalf("ServerDecode() = %q, %v, %v", data, needDecrypt, needSendBack)
+	}
+
+	serverHello, err := server.ServerEncode([]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := server.ServerEncode([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, needSendBack, err = client.ClientDecode(conbineToBytes(serverHello, reply))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "world" || needSendBack {
+		t.Fatalf("ClientDecode() = %q, %v", data, needSendBack)
+	}
+
+	result, err = client.ClientEncode([]byte("again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _, err = server.ServerDecode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "again" {
+		t.Fatalf("ServerDecode() = %q", data)
+	}
+}
+
+func TestObfsTLS_DecodeErrorReturn(t *testing.T) {
+	for method, want := range map[string]bool{
+		"tls1.2_ticket_fastauth":            false,
+		"tls1.2_ticket_fastauth_compatible": true,
+	} {
+		otls, err := GetObfs(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otls.SetServerInfo(NewServerInfo())
+		data, needDecrypt, _, err := otls.ServerDecode([]byte("GET / HTTP/1.1\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if needDecrypt != want || (want && string(data) != "GET / HTTP/1.1\r\n") {
+			t.Errorf("%s ServerDecode() needDecrypt = %v, want %v", method, needDecrypt, want)
+		}
+	}
+}
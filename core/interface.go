@@ -12,8 +12,29 @@ type Reloadable interface {
 	Reload() error;
 }
 
+// Target is the destination of a proxy request
+type Target struct {
+	// Host is ip or domain
+	Host string
+	Port int
+	// Network is tcp or udp
+	Network string
+	// Protocol is sniffed from the first payload, such as tls, http or bittorrent
+	Protocol string
+	// SniffHost is the tls server name or http host sniffed from the first payload
+	SniffHost string
+}
+
+// HostFirewall judge whether the user is allowed to visit target, uid is the port of user
 type HostFirewall interface {
-	JudgeHostWithReport(ipOrDomain string, uid int) bool
+	JudgeHostWithReport(target Target, uid int) bool
+	// NeedSniff return whether the rules of user use SniffHost or Protocol of target
+	NeedSniff(uid int) bool
+}
+
+// UserChecker judge whether the user is allowed to connect from ip, uid is the port of user
+type UserChecker interface {
+	CheckUser(uid int, ip string) bool
 }
 
 type ObfsProtocolService interface {
@@ -6,8 +6,11 @@ require (
 	github.com/StackExchange/wmi v1.2.1 // indirect
 	github.com/asaskevich/EventBus v0.0.0-20200907212545-49d423059eef
 	github.com/dustin/go-humanize v1.0.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gin-gonic/gin v1.6.3
+	github.com/oschwald/maxminddb-golang v1.8.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.1
 	github.com/robfig/cron v1.2.0
 	github.com/rs/xid v1.2.1
 	github.com/shirou/gopsutil v3.21.7+incompatible
@@ -20,5 +23,8 @@ require (
 	gitlab.com/yawning/chacha20.git v0.0.0-20190903091407-6d1cb28dc72c
 	golang.org/x/crypto v0.0.0-20210813211128-0a44fdfbc16e
 	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
+	google.golang.org/protobuf v1.26.0
 	gopkg.in/resty.v1 v1.12.0
+	gopkg.in/yaml.v2 v2.4.0
+	lukechampine.com/blake3 v1.1.7
 )
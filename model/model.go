@@ -15,6 +15,9 @@ type NodeInfo struct {
 	SpeedLimit    uint64 `json:"speed_limit"`
 	IsUDP         int    `json:"is_udp"`
 	ClientLimit   int    `json:"client_limit"`
+	Redirect      string `json:"redirect"`
+	// IPLimit is the max source ips of each user, 0 is unlimited
+	IPLimit int `json:"ip_limit"`
 }
 
 type UserInfo struct {
@@ -23,6 +26,16 @@ type UserInfo struct {
 	Passwd string `json:"passwd"`
 	Limit  uint64 `json:"speed_limit"`
 	Enable int    `json:"enable"`
+	// Quota is the traffic bytes user can use, 0 is unlimited
+	Quota int64 `json:"quota"`
+	// Used is the traffic bytes user has used when the user list is fetched
+	Used int64 `json:"used"`
+	// ExpireTime is the unix time user expires, 0 never expires
+	ExpireTime int64 `json:"expire_time"`
+	// IPLimit is the max source ips of user, 0 use the ip limit of node
+	IPLimit int `json:"ip_limit"`
+	// Policy is the name of rule policy of user in Rule.Policies, empty only use the node rule
+	Policy string `json:"policy"`
 }
 
 type UserTraffic struct {
@@ -31,6 +44,8 @@ type UserTraffic struct {
 	Download  int64 `json:"download"`
 	UpSpeed   int64 `json:"upspeed"`
 	DownSpeed int64 `json:"downspeed"`
+	UpPeak    int64 `json:"uppeak"`
+	DownPeak  int64 `json:"downpeak"`
 }
 
 type NodeOnline struct {
@@ -44,11 +59,20 @@ type NodeStatus struct {
 	NET    string `json:"net"`
 	DISK   string `json:"disk"`
 	UPTIME int    `json:"uptime"`
+	// RuleVersion is the version of audit rules the node enforce
+	RuleVersion string `json:"rule_version"`
 }
 
 type Rule struct {
 	Model string     `json:"mode"`
 	Rules []RuleItem `json:"rules"`
+	// Policies are the rules of users by policy name, they are judged after the rules of node
+	Policies map[string]RulePolicy `json:"policies,omitempty"`
+}
+
+type RulePolicy struct {
+	Model string     `json:"mode"`
+	Rules []RuleItem `json:"rules"`
 }
 
 type RuleItem struct {
@@ -57,8 +81,17 @@ type RuleItem struct {
 	Pattern string `json:"pattern"`
 }
 
+// trigger types
+const (
+	TriggerTypeRule    = "rule"
+	TriggerTypeQuota   = "quota"
+	TriggerTypeExpire  = "expire"
+	TriggerTypeIPLimit = "ip_limit"
+)
+
 type Trigger struct {
 	Uid    int    `json:"uid"`
 	RuleId int    `json:"rule_id"`
 	Reason string `json:"reason"`
+	Type   string `json:"type"`
 }
@@ -1,5 +1,25 @@
 package client
 
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/network"
+	"github.com/ProxyPanel/VNet-SSR/utils/netx"
+	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ShadowsocksClient is the shadowsocksr client, it connect to the shadowsocksr server
+// and provide local socks5 and http proxy
 type ShadowsocksClient struct {
 	Host          string
 	Port          int
@@ -9,9 +29,158 @@ type ShadowsocksClient struct {
 	ProtocolParam string
 	Obfs          string
 	ObfsParam     string
+	listeners     []*network.Listener
+}
+
+// Proxy dial the shadowsocksr server and send the target address,
+// data write to the returned connection will be send to host:port by server
+func (s *ShadowsocksClient) Proxy(host string, port int) (*network.ShadowsocksRClientDecorate, error) {
+	addr := socksproxy.ParseAddr(net.JoinHostPort(host, strconv.Itoa(port)))
+	if addr == nil {
+		return nil, errors.Errorf("invalid target address %s:%v", host, port)
+	}
+	request, err := network.DialTcp(net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+	if err != nil {
+		return nil, errors.Wrap(err, "shadowsocksr client dial server error")
+	}
+	_ = request.SetKeepAlive(true)
+	ssrd, err := network.NewShadowsocksRClientDecorate(request,
+		s.Obfs, s.Method,
+		s.Passwd, s.Protocol,
+		s.ObfsParam, s.ProtocolParam,
+		s.Host, s.Port)
+	if err != nil {
+		request.Close()
+		return nil, err
+	}
+	if _, err = ssrd.Write(addr.Raw); err != nil {
+		ssrd.Close()
+		return nil, errors.Wrap(err, "shadowsocksr client write address error")
+	}
+	return ssrd, nil
+}
+
+// ListenSocks5 start a local socks5 server on addr, only CONNECT command is supported
+func (s *ShadowsocksClient) ListenSocks5(addr string) error {
+	listener := network.NewListener(addr, 5*time.Second)
+	s.listeners = append(s.listeners, listener)
+	return listener.ListenTCP(func(request *network.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				logrus.WithFields(logrus.Fields{
+					"requestId": request.RequestID,
+				}).Errorf("socks5 connection crashed :%v stack: %s", e, string(debug.Stack()))
+			}
+		}()
+		defer request.Close()
+		target, err := socksproxy.Handshake(request)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"requestId": request.RequestID,
+			}).Errorf("socks5 handshake error %s", err)
+			return
+		}
+		s.pipe(request, target.GetAddress(), target.GetPort())
+	})
 }
 
-func (s *ShadowsocksClient) Proxy(host string,port int){
+// ListenHTTP start a local http proxy on addr, both CONNECT and plain http request are supported
+func (s *ShadowsocksClient) ListenHTTP(addr string) error {
+	listener := network.NewListener(addr, 5*time.Second)
+	s.listeners = append(s.listeners, listener)
+	return listener.ListenTCP(func(request *network.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				logrus.WithFields(logrus.Fields{
+					"requestId": request.RequestID,
+				}).Errorf("http connection crashed :%v stack: %s", e, string(debug.Stack()))
+			}
+		}()
+		defer request.Close()
+		reader := bufio.NewReader(request)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"requestId": request.RequestID,
+			}).Errorf("http read request error %s", err)
+			return
+		}
+
+		hostPort := req.Host
+		if req.Method != http.MethodConnect && req.URL.Host != "" {
+			hostPort = req.URL.Host
+		}
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			hostPort = net.JoinHostPort(hostPort, "80")
+		}
+		host, portStr, _ := net.SplitHostPort(hostPort)
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"requestId": request.RequestID,
+			}).Errorf("http request port error %s", err)
+			return
+		}
 
+		var head []byte
+		if req.Method == http.MethodConnect {
+			if _, err = request.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+				return
+			}
+		} else {
+			req.Header.Del("Proxy-Connection")
+			req.Header.Del("Proxy-Authorization")
+			req.RequestURI = ""
+			buf := new(bytes.Buffer)
+			if err = req.Write(buf); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"requestId": request.RequestID,
+				}).Errorf("http write request error %s", err)
+				return
+			}
+			head = buf.Bytes()
+		}
+		if n := reader.Buffered(); n > 0 {
+			buffered, _ := reader.Peek(n)
+			head = append(head, buffered...)
+		}
+		s.pipe(request, host, port, head...)
+	})
 }
 
+// Close stop all local listeners
+func (s *ShadowsocksClient) Close() error {
+	for _, listener := range s.listeners {
+		if err := listener.Close(); err != nil {
+			return err
+		}
+	}
+	s.listeners = nil
+	return nil
+}
+
+// pipe proxy the local request to host:port through shadowsocksr server,
+// head is the data already read from local request
+func (s *ShadowsocksClient) pipe(request *network.Request, host string, port int, head ...byte) {
+	log.Info("proxy %s requestId: %s", net.JoinHostPort(host, strconv.Itoa(port)), request.RequestID)
+	ssrd, err := s.Proxy(host, port)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"requestId": request.RequestID,
+			"target":    fmt.Sprintf("%s:%v", host, port),
+		}).Errorf("shadowsocksr client proxy error %s", err)
+		return
+	}
+	defer ssrd.Close()
+	if len(head) > 0 {
+		if _, err = ssrd.Write(head); err != nil {
+			return
+		}
+	}
+	_, _, err = netx.DuplexCopyTcp(request, ssrd)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"requestId": request.RequestID,
+		}).Debugf("shadowsocksr client process error %s", err)
+	}
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/proxy/server"
+	"github.com/ProxyPanel/VNet-SSR/utils/binaryx"
+	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
+)
+
+func echoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestShadowsocksClient_Proxy(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+	echoAddr := echo.Addr().(*net.TCPAddr)
+
+	tests := []struct {
+		method   string
+		password string
+		protocol string
+		obfs     string
+	}{
+		{"aes-128-cfb", "killer", "origin", "plain"},
+		{"chacha20-ietf", "killer", "auth_aes128_md5", "http_simple"},
+		{"none", "killer", "auth_chain_a", "tls1.2_ticket_auth"},
+		{"aes-256-cfb", "killer", "auth_chain_d", "http_post"},
+		{"2022-blake3-aes-128-gcm", "AAECAwQFBgcICQoLDA0ODw==", "origin", "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+"_"+tt.protocol+"_"+tt.obfs, func(t *testing.T) {
+			core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData(tt.protocol))
+			port := freePort(t)
+			ssr := &server.ShadowsocksRProxy{
+				Host:             "127.0.0.1",
+				Port:             port,
+				Method:           tt.method,
+				Password:         tt.password,
+				Protocol:         tt.protocol,
+				Obfs:             tt.obfs,
+				Users:            map[string]string{string(binaryx.LEUint32ToBytes(1024)): "userpass"},
+				ShadowsocksRArgs: &server.ShadowsocksRArgs{UDPSwitch: "false"},
+			}
+			if err := ssr.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer ssr.Listener.Close()
+
+			client := &ShadowsocksClient{
+				Host:          "127.0.0.1",
+				Port:          port,
+				Passwd:        tt.password,
+				Method:        tt.method,
+				Protocol:      tt.protocol,
+				ProtocolParam: "1024:userpass",
+				Obfs:          tt.obfs,
+			}
+			conn, err := client.Proxy(echoAddr.IP.String(), echoAddr.Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			for i := 0; i < 3; i++ {
+				data := bytes.Repeat([]byte{byte('a' + i)}, 1000*(i+1))
+				if _, err := conn.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				got := make([]byte, len(data))
+				if _, err := io.ReadFull(conn, got); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("echo data mismatch in round %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestShadowsocksClient_ListenSocks5(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+
+	core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData("origin"))
+	port := freePort(t)
+	ssr := &server.ShadowsocksRProxy{
+		Host:             "127.0.0.1",
+		Port:             port,
+		Method:           "aes-128-cfb",
+		Password:         "killer",
+		Protocol:         "origin",
+		Obfs:             "plain",
+		ShadowsocksRArgs: &server.ShadowsocksRArgs{UDPSwitch: "false"},
+	}
+	if err := ssr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ssr.Listener.Close()
+
+	client := &ShadowsocksClient{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Passwd:   "killer",
+		Method:   "aes-128-cfb",
+		Protocol: "origin",
+		Obfs:     "plain",
+	}
+	socksAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+	if err := client.ListenSocks5(socksAddr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := net.Dial("tcp", socksAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte{5, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, []byte{5, 0}) {
+		t.Fatalf("socks5 method reply = %v, %v", reply, err)
+	}
+	request := append([]byte{5, socksproxy.CmdConnect, 0}, socksproxy.ParseAddr(echo.Addr().String()).Raw...)
+	if _, err = conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	reply = make([]byte, 10)
+	if _, err = io.ReadFull(conn, reply); err != nil || reply[1] != socksproxy.RepSucceeded {
+		t.Fatalf("socks5 connect reply = %v, %v", reply, err)
+	}
+	data := []byte("hello shadowsocksr")
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(data))
+	if _, err = io.ReadFull(conn, got); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("socks5 echo = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Session is an active tcp session or udp nat entry
+type Session struct {
+	// Uid is filled by the user of proxy, Port is the port of user
+	Uid       int       `json:"uid"`
+	Port      int       `json:"port"`
+	Server    int       `json:"server"`
+	Network   string    `json:"network"`
+	Client    string    `json:"client"`
+	Target    string    `json:"target,omitempty"`
+	SniffHost string    `json:"sniff_host,omitempty"`
+	Start     time.Time `json:"start"`
+}
+
+// sessionRegistry is the active sessions of proxy keyed by the closer of session,
+// closing it terminate the session
+type sessionRegistry struct {
+	sync.Mutex
+	sessions map[io.Closer]*Session
+}
+
+func (r *sessionRegistry) add(closer io.Closer, session *Session) {
+	r.Lock()
+	defer r.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[io.Closer]*Session)
+	}
+	r.sessions[closer] = session
+}
+
+// update change the session of closer with fn, it is skipped when session is removed
+func (r *sessionRegistry) update(closer io.Closer, fn func(session *Session)) {
+	r.Lock()
+	defer r.Unlock()
+	if session, ok := r.sessions[closer]; ok {
+		fn(session)
+	}
+}
+
+func (r *sessionRegistry) del(closer io.Closer) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.sessions, closer)
+}
+
+// list return the copies of sessions match fn
+func (r *sessionRegistry) list(fn func(session *Session) bool) []Session {
+	r.Lock()
+	defer r.Unlock()
+	result := make([]Session, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		if fn == nil || fn(session) {
+			result = append(result, *session)
+		}
+	}
+	return result
+}
+
+// close remove and close the sessions match fn, it return the count of closed sessions
+func (r *sessionRegistry) close(fn func(session *Session) bool) int {
+	r.Lock()
+	var closers []io.Closer
+	for closer, session := range r.sessions {
+		if fn == nil || fn(session) {
+			closers = append(closers, closer)
+			delete(r.sessions, closer)
+		}
+	}
+	r.Unlock()
+	for _, closer := range closers {
+		_ = closer.Close()
+	}
+	return len(closers)
+}
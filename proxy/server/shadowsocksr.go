@@ -5,13 +5,17 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/ProxyPanel/VNet-SSR/common"
+	"github.com/ProxyPanel/VNet-SSR/common/audit"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
 	"github.com/ProxyPanel/VNet-SSR/common/network"
 	"github.com/ProxyPanel/VNet-SSR/common/pool"
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/utils/binaryx"
 	"github.com/ProxyPanel/VNet-SSR/utils/goroutine"
 	"github.com/ProxyPanel/VNet-SSR/utils/netx"
+	"github.com/ProxyPanel/VNet-SSR/utils/sniffx"
 	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -22,6 +26,7 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -40,11 +45,20 @@ type ShadowsocksRProxy struct {
 	Users             map[string]string `json:"users,omitempty"`
 	Status            string            `json:"status,omitempty"`
 	Single            int               `json:"single,omitempty"`
+	Redirect          string            `json:"redirect,omitempty"`
 	network.ILimiter
 	core.HostFirewall
+	core.UserChecker
 	common.TrafficReport `json:"-"`
 	common.OnlineReport  `json:"-"`
+	common.AccessLog     `json:"-"`
 	*ShadowsocksRArgs
+	// SniffTimeout is the max time to wait the first payload of tcp for sniffing, 0 disable it
+	SniffTimeout time.Duration `json:"-"`
+	// sessions are the established tcp connections and udp nat entries
+	sessions sessionRegistry
+	// identities are the users of aead 2022 identity header, nil if it is disabled
+	identities *aead2022.Users
 }
 
 // ShadowsocksArgs is ShadowsocksProxy arguments
@@ -56,6 +70,10 @@ type ShadowsocksRArgs struct {
 // Start tcp and udp according to the configuration
 func (ssr *ShadowsocksRProxy) Start() error {
 	ssr.Listener = network.NewListener(fmt.Sprintf("%s:%v", ssr.Host, ssr.Port), 5*time.Second)
+	if ssr.identityEnabled() {
+		ssr.identities = aead2022.NewUsers()
+		ssr.Reload(ssr.Users)
+	}
 	var err error
 	if ssr.ShadowsocksRArgs.TCPSwitch != "false" {
 		err = ssr.StartTCP()
@@ -74,6 +92,7 @@ func (ssr *ShadowsocksRProxy) Start() error {
 }
 
 func (ssr *ShadowsocksRProxy) StartTCP() error {
+	redirect := network.NewRedirect(ssr.Redirect)
 	return ssr.ListenTCP(func(request *network.Request) {
 		ssrd, err := network.NewShadowsocksRDecorate(request,
 			ssr.Obfs, ssr.Method,
@@ -92,6 +111,17 @@ func (ssr *ShadowsocksRProxy) StartTCP() error {
 		}
 		ssrd.TrafficReport = ssr.TrafficReport
 		ssrd.SetLimter(ssr.ILimiter)
+		if ssr.identities != nil {
+			ssrd.SetIdentityUsers(ssr.identities)
+		}
+		// uid is the port of server in multi port mode, it is known after handshake in single port mode
+		ssr.sessions.add(ssrd, &Session{
+			Port:    ssrd.UID,
+			Server:  ssr.Port,
+			Network: "tcp",
+			Client:  request.RemoteAddr().String(),
+			Start:   time.Now(),
+		})
 		go func() {
 			defer func() {
 				if err := recover(); err != nil {
@@ -100,19 +130,62 @@ func (ssr *ShadowsocksRProxy) StartTCP() error {
 					}).Errorf("shadowsocksr connection read error :%v stack: %s", err, string(debug.Stack()))
 				}
 			}()
+			defer ssr.sessions.del(ssrd)
 			defer ssrd.Close()
+			metrics.IncTCPConnection(ssr.Port)
+			defer metrics.DecTCPConnection(ssr.Port)
 			addr, err := socksproxy.ReadAddr(ssrd)
 			if err != nil && err != io.EOF {
 				logrus.WithFields(logrus.Fields{
 					"requestId": ssrd.RequestID,
 				}).Errorf("shadowsocksr read address error %s", err)
+				metrics.HandshakeFail(ssrd.FailReason())
+				ssr.redirect(ssrd, redirect)
+				return
+			}
+			ssrd.FinishHandshake()
+			if ssr.UserChecker != nil && !ssr.UserChecker.CheckUser(ssrd.UID, ssrd.RemoteAddr().String()) {
+				log.Info("uid %v from %s is rejected, requestId: %s", ssrd.UID, ssrd.RemoteAddr().String(), ssrd.GetRequestId())
 				return
 			}
 			ssr.handleStageAddr(ssrd.UID, ssrd.RemoteAddr().String(), ssrd.LocalAddr().String(), addr.String(), "tcp")
+			ssr.sessions.update(ssrd, func(session *Session) {
+				session.Port, session.Target = ssrd.UID, addr.String()
+			})
 			log.Info("reslove addr success: %s requestId: %s", addr.String(), ssrd.GetRequestId())
+			record := &audit.Record{
+				Uid:     ssr.accessUid(ssrd.UID),
+				Port:    ssrd.UID,
+				Network: "tcp",
+				Client:  ssrd.RemoteAddr().String(),
+				Target:  addr.String(),
+				Start:   time.Now(),
+			}
+			defer ssr.access(record)
 
-			if ssr.HostFirewall != nil && !ssr.HostFirewall.JudgeHostWithReport(addr.GetAddress(), ssrd.UID) {
+			payload, sniffed, err := ssr.sniff(ssrd)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"requestId": ssrd.RequestID,
+				}).Errorf("shadowsocksr sniff first payload error %s", err)
+				record.Reason = audit.ReasonError
+				return
+			}
+			record.SniffHost = sniffed.Host
+			ssr.sessions.update(ssrd, func(session *Session) {
+				session.SniffHost = sniffed.Host
+			})
+			target := core.Target{
+				Host:      addr.GetAddress(),
+				Port:      addr.GetPort(),
+				Network:   "tcp",
+				Protocol:  sniffed.Protocol,
+				SniffHost: sniffed.Host,
+			}
+			if ssr.HostFirewall != nil && !ssr.HostFirewall.JudgeHostWithReport(target, ssrd.UID) {
 				log.Info("%s is reject", addr.String())
+				metrics.HandshakeFail(metrics.ReasonFirewallReject)
+				record.Reason = audit.ReasonReject
 				body := fmt.Sprintf("%s is reject", addr.String())
 				t := &http.Response{
 					Status:        "200 OK",
@@ -133,11 +206,23 @@ func (ssr *ShadowsocksRProxy) StartTCP() error {
 				logrus.WithFields(logrus.Fields{
 					"requestId": ssrd.RequestID,
 				}).Errorf("shadowsocksr proxy remote error %s", err)
+				record.Reason = audit.ReasonDialFail
 				return
 			}
 			defer req.Close()
 			_ = req.SetKeepAlive(true)
-			_, _, err = netx.DuplexCopyTcp(ssrd, req)
+			if len(payload) > 0 {
+				if _, err := req.Write(payload); err != nil {
+					logrus.WithFields(logrus.Fields{
+						"requestId": ssrd.RequestID,
+					}).Errorf("shadowsocksr proxy remote error %s", err)
+					record.Reason = audit.ReasonError
+					return
+				}
+			}
+			down, up, err := netx.DuplexCopyTcp(ssrd, req)
+			record.Up, record.Down = up+int64(len(payload)), down
+			record.Reason = closeReason(err, ssrd.Closed())
 			log.Debug("close %s", ssrd.RequestID)
 			if err != nil {
 				logrus.WithFields(logrus.Fields{
@@ -150,6 +235,156 @@ func (ssr *ShadowsocksRProxy) StartTCP() error {
 	})
 }
 
+// sniff read the first payload of connection in SniffTimeout and detect its protocol,
+// the payload need to be sent to remote before relay. it is skipped when the rules of
+// user don't use the sniffed result, so server first protocols are not delayed
+func (ssr *ShadowsocksRProxy) sniff(ssrd *network.ShadowsocksRDecorate) (payload []byte, result sniffx.Result, err error) {
+	if ssr.HostFirewall == nil || ssr.SniffTimeout <= 0 || !ssr.HostFirewall.NeedSniff(ssrd.UID) {
+		return nil, result, nil
+	}
+	_ = ssrd.Conn.SetReadDeadline(time.Now().Add(ssr.SniffTimeout))
+	defer ssrd.Conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 4*1024)
+	n := 0
+	for n == 0 && err == nil {
+		n, err = ssrd.Read(buf)
+	}
+	// server first protocols send nothing before response
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		err = nil
+	}
+	if n == 0 {
+		return nil, result, err
+	}
+	payload = buf[:n]
+	result, _ = sniffx.Sniff(payload, "tcp")
+	return payload, result, nil
+}
+
+// accessUid return the uid of port for access log when session starts
+func (ssr *ShadowsocksRProxy) accessUid(port int) int {
+	if ssr.AccessLog == nil {
+		return 0
+	}
+	return ssr.AccessLog.PortToUid(port)
+}
+
+// access write the record of finished session to AccessLog
+func (ssr *ShadowsocksRProxy) access(record *audit.Record) {
+	if ssr.AccessLog == nil {
+		return
+	}
+	record.End = time.Now()
+	if record.Reason == "" {
+		record.Reason = audit.ReasonEOF
+	}
+	ssr.AccessLog.Access(record)
+}
+
+// closeReason return the reason of relay end, timeout is the wake up of DuplexCopyTcp
+// after the other direction finished
+func closeReason(err error, closed bool) string {
+	if closed {
+		return audit.ReasonClosed
+	}
+	if err == nil {
+		return audit.ReasonEOF
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return audit.ReasonEOF
+	}
+	return audit.ReasonError
+}
+
+// ConnCount return the count of established tcp connections
+func (ssr *ShadowsocksRProxy) ConnCount() int {
+	return len(ssr.sessions.list(func(session *Session) bool {
+		return session.Network == "tcp"
+	}))
+}
+
+// Sessions return the established tcp connections and udp nat entries match fn, nil fn match all
+func (ssr *ShadowsocksRProxy) Sessions(fn func(session *Session) bool) []Session {
+	return ssr.sessions.list(fn)
+}
+
+func (ssr *ShadowsocksRProxy) closeConns() {
+	if count := ssr.sessions.close(nil); count > 0 {
+		logrus.WithFields(logrus.Fields{
+			"port":  ssr.Port,
+			"count": count,
+		}).Info("shadowsocksr close connections after drain")
+	}
+}
+
+// CloseUser close the established tcp connections and udp nat entries of user, uid is the port of user.
+// it return the count of closed sessions
+func (ssr *ShadowsocksRProxy) CloseUser(uid int) int {
+	return ssr.sessions.close(func(session *Session) bool {
+		return session.Port == uid
+	})
+}
+
+// Drain close the listener so the port can be bound again, established tcp connections keep
+// working with the old parameters and are closed after grace, then done is called if it's not nil.
+// udp has no session, it's closed at once
+func (ssr *ShadowsocksRProxy) Drain(grace time.Duration, done func()) error {
+	if err := ssr.Listener.Close(); err != nil {
+		return err
+	}
+	closeConns := func() {
+		ssr.closeConns()
+		if done != nil {
+			done()
+		}
+	}
+	if grace <= 0 {
+		closeConns()
+		return nil
+	}
+	time.AfterFunc(grace, closeConns)
+	return nil
+}
+
+// redirect replay the origin data of failed handshake to the decoy backend,
+// then pipe the connection, so active probe only see a normal web server
+func (ssr *ShadowsocksRProxy) redirect(ssrd *network.ShadowsocksRDecorate, redirect *network.Redirect) {
+	data := ssrd.HandshakeData()
+	if len(data) == 0 {
+		return
+	}
+	target, ok := redirect.Target(data)
+	if !ok {
+		return
+	}
+	ssrd.FinishHandshake()
+	logrus.WithFields(logrus.Fields{
+		"requestId": ssrd.RequestID,
+		"client":    ssrd.RemoteAddr().String(),
+		"target":    target,
+	}).Info("shadowsocksr handshake fail, redirect")
+	req, err := network.DialTcp(target)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"requestId": ssrd.RequestID,
+		}).Errorf("shadowsocksr redirect remote error %s", err)
+		return
+	}
+	defer req.Close()
+	if _, err = req.Write(data); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"requestId": ssrd.RequestID,
+		}).Errorf("shadowsocksr redirect write error %s", err)
+		return
+	}
+	_, _, err = netx.DuplexCopyTcp(ssrd.Request, req)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"requestId": ssrd.RequestID,
+		}).Debugf("shadowsocksr redirect process error %s", err)
+	}
+}
+
 func (ssr *ShadowsocksRProxy) StartUDP() error {
 	err := ssr.ListenUDP(func(request *network.Request) {
 		go func() {
@@ -173,8 +408,14 @@ func (ssr *ShadowsocksRProxy) StartUDP() error {
 					"error":     err,
 				}).Error("shadowsocksr NewShadowsocksRDecorate error")
 			}
+			if ssr.identities != nil {
+				ssrd.SetIdentityUsers(ssr.identities)
+			}
 			// TODO UDP TIMEOUT
 			udpMap := NewShadowsocksRUDPMap(30)
+			udpMap.port = ssr.Port
+			udpMap.AccessLog = ssr.AccessLog
+			udpMap.sessions = &ssr.sessions
 			for {
 				data, uid, addr, err := ssrd.ReadFrom()
 				if err != nil {
@@ -203,10 +444,48 @@ func (ssr *ShadowsocksRProxy) StartUDP() error {
 					"uid":        binaryx.LEBytesToUInt32(uid),
 				}).Info("recive udp proxy")
 				data = data[len(remoteAddr.Raw):]
+				remoteAddrResolve, err := net.ResolveUDPAddr("udp", remoteAddr.String())
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"remoteAddr": remoteAddr.String(),
+						"serverAddr": ssrd.PacketConn.LocalAddr().String(),
+						"clientAddr": addr.String(),
+						"uid":        binaryx.LEBytesToUInt32(uid),
+						"err":        err,
+					}).Error("shadowoscksr listenPacket udp error")
+					continue
+				}
+				if ssr.UserChecker != nil && !ssr.UserChecker.CheckUser(int(binaryx.LEBytesToUInt32(uid)), addr.String()) {
+					continue
+				}
+				ssr.handleStageAddr(int(binaryx.LEBytesToUInt32(uid)), addr.String(), ssrd.PacketConn.LocalAddr().String(), remoteAddr.String(), "udp")
+
+				// like tcp, packets are only sniffed when the rules of user need the protocol
+				var sniffed sniffx.Result
+				if ssr.HostFirewall != nil && ssr.HostFirewall.NeedSniff(int(binaryx.LEBytesToUInt32(uid))) {
+					sniffed, _ = sniffx.Sniff(data, "udp")
+				}
+				target := core.Target{
+					Host:     remoteAddr.GetAddress(),
+					Port:     remoteAddr.GetPort(),
+					Network:  "udp",
+					Protocol: sniffed.Protocol,
+				}
+				// only the packet is dropped, other destinations and users of the port keep working
+				if ssr.HostFirewall != nil && !ssr.HostFirewall.JudgeHostWithReport(target, int(binaryx.LEBytesToUInt32(uid))) {
+					metrics.HandshakeFail(metrics.ReasonFirewallReject)
+					continue
+				}
+
+				// nat entry is created after the checks, so rejected users never get a socket
 				remotePacketConn := udpMap.Get(addr.String())
 				if remotePacketConn == nil {
 					remotePacketConn = &ShadowsocksRUDPMapItem{}
 					remotePacketConn.Uid = uid
+					remotePacketConn.UserID = ssr.accessUid(int(binaryx.LEBytesToUInt32(uid)))
+					remotePacketConn.Client = addr.String()
+					remotePacketConn.Target = remoteAddr.String()
+					remotePacketConn.Start = time.Now()
 					remotePacketConn.PacketConn, err = net.ListenPacket("udp", "")
 					if err != nil {
 						logrus.WithFields(logrus.Fields{
@@ -220,25 +499,10 @@ func (ssr *ShadowsocksRProxy) StartUDP() error {
 					}
 					udpMap.Add(addr, ssrd, remotePacketConn)
 				}
-				remoteAddrResolve, err := net.ResolveUDPAddr("udp", remoteAddr.String())
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"remoteAddr": remoteAddr.String(),
-						"serverAddr": ssrd.PacketConn.LocalAddr().String(),
-						"clientAddr": addr.String(),
-						"uid":        binaryx.LEBytesToUInt32(uid),
-						"err":        err,
-					}).Error("shadowoscksr listenPacket udp error")
-					continue
-				}
-				ssr.handleStageAddr(int(binaryx.LEBytesToUInt32(uid)), addr.String(), ssrd.PacketConn.LocalAddr().String(), remoteAddr.String(), "udp")
-
-				if ssr.HostFirewall != nil && !ssr.HostFirewall.JudgeHostWithReport(addr.String(), int(binaryx.LEBytesToUInt32(uid))) {
-					return
-				}
-
-				//udpMap.Add(addr, ssrd, remotePacketConn)
 				_, err = remotePacketConn.WriteTo(data, remoteAddrResolve)
+				if err == nil {
+					atomic.AddInt64(&remotePacketConn.up, int64(len(data)))
+				}
 				if err != nil {
 					if err != nil {
 						logrus.WithFields(logrus.Fields{
@@ -281,23 +545,72 @@ func (ssr *ShadowsocksRProxy) AddUser(uid int, password string) {
 	logrus.Debugf("shadowsocksr adduser uidPack: %s", hex.EncodeToString(uidPack))
 	uidPackStr := string(uidPack)
 	ssr.Users[uidPackStr] = password
+	if ssr.identities != nil {
+		if psk, err := ssr.identityPSK(uid, password); err == nil {
+			ssr.identities.Set(uid, psk)
+		}
+	}
 }
 
+// DelUser remove the password of user and close its sessions, uid is the port of user
 func (ssr *ShadowsocksRProxy) DelUser(uid int) {
-	if ssr.Users == nil {
-		return
+	if ssr.Users != nil {
+		uidPack := string(binaryx.LEUint32ToBytes(uint32(uid)))
+		delete(ssr.Users, uidPack)
 	}
-	uidPack := string(binaryx.LEUint32ToBytes(uint32(uid)))
-	delete(ssr.Users, uidPack)
+	if ssr.identities != nil {
+		ssr.identities.Del(uid)
+	}
+	ssr.CloseUser(uid)
 }
 
 func (ssr *ShadowsocksRProxy) Reload(users map[string]string) {
 	ssr.Users = users
+	if ssr.identities != nil {
+		psks := make(map[int][]byte, len(users))
+		for uidPack, password := range users {
+			uid := int(binaryx.LEBytesToUInt32([]byte(uidPack)))
+			if psk, err := ssr.identityPSK(uid, password); err == nil {
+				psks[uid] = psk
+			}
+		}
+		ssr.identities.Reset(psks)
+	}
+}
+
+// identityEnabled return whether users are identified by the identity header of aead 2022,
+// it needs single port mode without ssr protocol, the password of proxy is the identity psk
+func (ssr *ShadowsocksRProxy) identityEnabled() bool {
+	if ssr.Single != 1 || aead2022.GetIdentityCipher(ssr.Method) == nil {
+		return false
+	}
+	return ssr.Protocol == "" || ssr.Protocol == "origin" || ssr.Protocol == "plain"
+}
+
+// identityPSK decode the password of user as its psk, the user is skipped if it is invalid
+func (ssr *ShadowsocksRProxy) identityPSK(uid int, password string) ([]byte, error) {
+	psk, err := aead2022.DecodePSK(password, aead2022.GetAEAD2022Cipher(ssr.Method).KeySize())
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"uid":   uid,
+			"error": err,
+		}).Warn("shadowsocksr user password is not aead 2022 psk")
+	}
+	return psk, err
 }
 
 type ShadowsocksRUDPMapItem struct {
+	// up and down are the relayed bytes, they are first for 64-bit alignment of atomic
+	up   int64
+	down int64
 	net.PacketConn
 	Uid []byte
+	// UserID is the uid of user when entry is created, Client and Target are the
+	// addresses of the first packet, for access log
+	UserID int
+	Client string
+	Target string
+	Start  time.Time
 }
 
 // Packet NAT table
@@ -305,6 +618,11 @@ type ShadowsocksRUDPMap struct {
 	sync.RWMutex
 	m       map[string]*ShadowsocksRUDPMapItem
 	timeout time.Duration
+	// port is the server port for metrics
+	port int
+	common.AccessLog
+	// sessions register the nat entries so they can be listed and closed
+	sessions *sessionRegistry
 }
 
 func NewShadowsocksRUDPMap(timeout time.Duration) *ShadowsocksRUDPMap {
@@ -323,6 +641,9 @@ func (m *ShadowsocksRUDPMap) Get(key string) *ShadowsocksRUDPMapItem {
 func (m *ShadowsocksRUDPMap) Set(key string, pc *ShadowsocksRUDPMapItem) {
 	m.Lock()
 	defer m.Unlock()
+	if _, ok := m.m[key]; !ok {
+		metrics.IncUDPNATEntry(m.port)
+	}
 	m.m[key] = pc
 }
 
@@ -333,6 +654,7 @@ func (m *ShadowsocksRUDPMap) Del(key string) *ShadowsocksRUDPMapItem {
 	pc, ok := m.m[key]
 	if ok {
 		delete(m.m, key)
+		metrics.DecUDPNATEntry(m.port)
 		return pc
 	}
 	return nil
@@ -340,12 +662,51 @@ func (m *ShadowsocksRUDPMap) Del(key string) *ShadowsocksRUDPMapItem {
 
 func (m *ShadowsocksRUDPMap) Add(client net.Addr, server *network.ShadowsocksRDecorate, remoteServer *ShadowsocksRUDPMapItem) {
 	m.Set(client.String(), remoteServer)
+	if m.sessions != nil {
+		m.sessions.add(remoteServer, &Session{
+			Port:    int(binaryx.LEBytesToUInt32(remoteServer.Uid)),
+			Server:  m.port,
+			Network: "udp",
+			Client:  remoteServer.Client,
+			Target:  remoteServer.Target,
+			Start:   remoteServer.Start,
+		})
+	}
 	go goroutine.Protect(func() {
 		//TODO defer recover
-		_ = ShadowsocksRMapTimeCopy(server, client, remoteServer, m.timeout)
+		err := ShadowsocksRMapTimeCopy(server, client, remoteServer, m.timeout)
 		if pc := m.Del(client.String()); pc != nil {
 			_ = pc.Close()
 		}
+		if m.sessions != nil {
+			m.sessions.del(remoteServer)
+		}
+		m.access(remoteServer, err)
+	})
+}
+
+// access write the record of expired nat entry to AccessLog
+func (m *ShadowsocksRUDPMap) access(item *ShadowsocksRUDPMapItem, err error) {
+	if m.AccessLog == nil {
+		return
+	}
+	reason := audit.ReasonError
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		reason = audit.ReasonTimeout
+	} else if err != nil && strings.Contains(err.Error(), "use of closed network connection") {
+		reason = audit.ReasonClosed
+	}
+	m.AccessLog.Access(&audit.Record{
+		Uid:     item.UserID,
+		Port:    int(binaryx.LEBytesToUInt32(item.Uid)),
+		Network: "udp",
+		Client:  item.Client,
+		Target:  item.Target,
+		Start:   item.Start,
+		End:     time.Now(),
+		Up:      atomic.LoadInt64(&item.up),
+		Down:    atomic.LoadInt64(&item.down),
+		Reason:  reason,
 	})
 }
 
@@ -375,5 +736,6 @@ func ShadowsocksRMapTimeCopy(dst *network.ShadowsocksRDecorate, target net.Addr,
 		if err != nil {
 			return errors.Cause(err)
 		}
+		atomic.AddInt64(&src.down, int64(n))
 	}
 }
@@ -1,12 +1,19 @@
 package server
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/ProxyPanel/VNet-SSR/common/audit"
+	"github.com/ProxyPanel/VNet-SSR/common/ciphers/aead2022"
 	"github.com/ProxyPanel/VNet-SSR/common/network/ciphers"
+	"github.com/ProxyPanel/VNet-SSR/utils/binaryx"
 	"github.com/ProxyPanel/VNet-SSR/utils/socksproxy"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"testing"
 	"time"
 )
 
@@ -42,3 +49,127 @@ func ExampleShadowsocksR() {
 	fmt.Println(string(text))
 	//Output:
 }
+
+// timeoutError is the error of deadline
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestCloseReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		closed bool
+		want   string
+	}{
+		{nil, false, audit.ReasonEOF},
+		{timeoutError{}, false, audit.ReasonEOF},
+		{errors.New("connection reset by peer"), false, audit.ReasonError},
+		{errors.New("use of closed network connection"), true, audit.ReasonClosed},
+	}
+	for _, test := range tests {
+		if got := closeReason(test.err, test.closed); got != test.want {
+			t.Errorf("closeReason(%v, %v) = %s, want %s", test.err, test.closed, got, test.want)
+		}
+	}
+}
+
+// closer count the calls of Close
+type closer struct{ closed int }
+
+func (c *closer) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestSessionRegistry(t *testing.T) {
+	var registry sessionRegistry
+	a, b, c := &closer{}, &closer{}, &closer{}
+	registry.add(a, &Session{Port: 1, Network: "tcp"})
+	registry.add(b, &Session{Port: 1, Network: "udp"})
+	registry.add(c, &Session{Network: "tcp"})
+	registry.update(c, func(session *Session) {
+		session.Port = 2
+	})
+	if sessions := registry.list(nil); len(sessions) != 3 {
+		t.Fatalf("sessions = %+v, want 3", sessions)
+	}
+	if count := registry.close(func(session *Session) bool { return session.Port == 1 }); count != 2 {
+		t.Fatalf("closed %v sessions, want 2", count)
+	}
+	if a.closed != 1 || b.closed != 1 || c.closed != 0 {
+		t.Fatalf("closed calls = %v %v %v", a.closed, b.closed, c.closed)
+	}
+	sessions := registry.list(nil)
+	if len(sessions) != 1 || sessions[0].Port != 2 {
+		t.Fatalf("sessions after close = %+v", sessions)
+	}
+	registry.del(c)
+	registry.update(c, func(session *Session) {
+		t.Fatal("removed session is updated")
+	})
+}
+
+func TestShadowsocksRProxyIdentities(t *testing.T) {
+	psk := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 16))
+	}
+	ssr := &ShadowsocksRProxy{Method: "2022-blake3-aes-128-gcm", Protocol: "origin", Single: 1}
+	if !ssr.identityEnabled() {
+		t.Fatal("identity header should be enabled")
+	}
+	ssr.identities = aead2022.NewUsers()
+	ssr.AddUser(1, psk(1))
+	ssr.AddUser(2, "not a psk")
+	ssr.AddUser(3, psk(3))
+	ssr.DelUser(3)
+	if ssr.identities.Len() != 1 {
+		t.Fatalf("identities = %v, want 1", ssr.identities.Len())
+	}
+	if user, err := ssr.identities.Get(aead2022.IdentityHash(bytes.Repeat([]byte{1}, 16))); err != nil || user.ID != 1 {
+		t.Fatalf("Get() = %+v, %v", user, err)
+	}
+	ssr.Reload(map[string]string{string(binaryx.LEUint32ToBytes(4)): psk(4)})
+	if user, err := ssr.identities.Get(aead2022.IdentityHash(bytes.Repeat([]byte{4}, 16))); err != nil || user.ID != 4 || ssr.identities.Len() != 1 {
+		t.Fatalf("Get() after reload = %+v, %v", user, err)
+	}
+
+	for _, disabled := range []*ShadowsocksRProxy{
+		{Method: "2022-blake3-aes-128-gcm", Protocol: "auth_chain_a", Single: 1},
+		{Method: "2022-blake3-chacha20-poly1305", Protocol: "origin", Single: 1},
+		{Method: "2022-blake3-aes-128-gcm", Protocol: "origin", Single: 0},
+	} {
+		if disabled.identityEnabled() {
+			t.Errorf("identity header of %+v should be disabled", disabled)
+		}
+	}
+}
+
+// accessLog record the access records, uid of port is 100 + port
+type accessLog struct {
+	records []*audit.Record
+}
+
+func (l *accessLog) PortToUid(port int) int {
+	return 100 + port
+}
+
+func (l *accessLog) Access(record *audit.Record) {
+	l.records = append(l.records, record)
+}
+
+func TestAccessUid(t *testing.T) {
+	log := new(accessLog)
+	ssr := &ShadowsocksRProxy{AccessLog: log}
+	if uid := ssr.accessUid(1); uid != 101 {
+		t.Fatalf("accessUid() = %v, want 101", uid)
+	}
+	// uid is resolved when nat entry is created, not when it expires
+	m := NewShadowsocksRUDPMap(30)
+	m.AccessLog = log
+	m.access(&ShadowsocksRUDPMapItem{Uid: binaryx.LEUint32ToBytes(2), UserID: 7}, timeoutError{})
+	if len(log.records) != 1 || log.records[0].Uid != 7 || log.records[0].Port != 2 || log.records[0].Reason != audit.ReasonTimeout {
+		t.Fatalf("records = %+v", log.records)
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/audit"
+	"github.com/sirupsen/logrus"
+)
+
+// OpenAccessLog open the access log at path, empty path disable it.
+// the file is rotated when it exceeds maxSize bytes, rotated files older than maxAge are removed
+func (s *SSRManager) OpenAccessLog(path string, maxSize int64, maxAge time.Duration) error {
+	if path == "" {
+		return nil
+	}
+	accessLog, err := audit.Open(path, maxSize, maxAge)
+	if err != nil {
+		return err
+	}
+	s.accessLog = accessLog
+	return nil
+}
+
+func (s *SSRManager) CloseAccessLog() error {
+	if s.accessLog == nil {
+		return nil
+	}
+	return s.accessLog.Close()
+}
+
+// Access write the record of proxy
+func (s *SSRManager) Access(record *audit.Record) {
+	if s.accessLog == nil {
+		return
+	}
+	if err := s.accessLog.Write(record); err != nil {
+		logrus.Errorf("write access log error %s", err)
+	}
+}
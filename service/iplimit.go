@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/ProxyPanel/VNet-SSR/utils/addrx"
+)
+
+// defaultIPWindow is the default time an ip is remembered after its last connection
+const defaultIPWindow = 120 * time.Second
+
+// ipLimit record the recent source ips of users, ips not seen in window are expired
+type ipLimit struct {
+	sync.Mutex
+	ips map[int]map[string]time.Time
+	// reported is the last time user is reported, report once in a window
+	reported map[int]time.Time
+}
+
+func newIPLimit() *ipLimit {
+	return &ipLimit{
+		ips:      make(map[int]map[string]time.Time),
+		reported: make(map[int]time.Time),
+	}
+}
+
+// allow report whether ip can connect as uid, user can use limit ips at most in window,
+// a known ip is always allowed and its time is refreshed
+func (l *ipLimit) allow(uid int, ip string, limit int, window time.Duration, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	ips := l.ips[uid]
+	if ips == nil {
+		ips = make(map[string]time.Time)
+		l.ips[uid] = ips
+	}
+	for item, last := range ips {
+		if now.Sub(last) > window {
+			delete(ips, item)
+		}
+	}
+	if _, ok := ips[ip]; ok || limit <= 0 || len(ips) < limit {
+		ips[ip] = now
+		return true
+	}
+	return false
+}
+
+// shouldReport report whether the rejection of uid need to be reported
+func (l *ipLimit) shouldReport(uid int, window time.Duration, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if last, ok := l.reported[uid]; ok && now.Sub(last) <= window {
+		return false
+	}
+	l.reported[uid] = now
+	return true
+}
+
+func (l *ipLimit) del(uid int) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.ips, uid)
+	delete(l.reported, uid)
+}
+
+// checkIP judge the source ip with ip limit of user, node ip limit is used when user has none
+func (s *SSRManager) checkIP(user *model.UserInfo, ip string) bool {
+	limit := user.IPLimit
+	if limit == 0 {
+		limit = core.GetApp().NodeInfo().IPLimit
+	}
+	ip = addrx.SplitIpFromAddr(ip)
+	now := time.Now()
+	if s.ipLimit.allow(user.Uid, ip, limit, s.IPWindow, now) {
+		return true
+	}
+	metrics.HandshakeFail(metrics.ReasonIPLimit)
+	if s.ipLimit.shouldReport(user.Uid, s.IPWindow, now) {
+		s.reportBlocked(user.Uid, model.TriggerTypeIPLimit, fmt.Sprintf("%s is over ip limit %v", ip, limit))
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+func TestIPLimit_Allow(t *testing.T) {
+	limit := newIPLimit()
+	now := time.Now()
+	window := time.Minute
+	if !limit.allow(1, "1.1.1.1", 2, window, now) || !limit.allow(1, "2.2.2.2", 2, window, now) {
+		t.Fatal("ips under limit are rejected")
+	}
+	if limit.allow(1, "3.3.3.3", 2, window, now) {
+		t.Fatal("ip over limit is allowed")
+	}
+	if !limit.allow(1, "1.1.1.1", 2, window, now.Add(30*time.Second)) {
+		t.Fatal("known ip is rejected")
+	}
+	// 2.2.2.2 is expired, 1.1.1.1 is refreshed
+	if !limit.allow(1, "3.3.3.3", 2, window, now.Add(70*time.Second)) {
+		t.Fatal("ip is rejected after old ip expired")
+	}
+	if limit.allow(1, "2.2.2.2", 2, window, now.Add(70*time.Second)) {
+		t.Fatal("ip over limit is allowed after refresh")
+	}
+	if !limit.allow(2, "2.2.2.2", 0, window, now) {
+		t.Fatal("zero limit should be unlimited")
+	}
+}
+
+func TestSSRManager_CheckUserIPLimit(t *testing.T) {
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1, IPLimit: 1})
+	defer client.SetPanelClient(client.GetPanelClient())
+	panel := &triggerClient{triggers: make(chan model.Trigger, 4)}
+	client.SetPanelClient(panel)
+	manager := NewShadowsocksrService()
+	if err := manager.AddUsers([]*model.UserInfo{
+		{Uid: 1, Port: 1, Passwd: "a", Enable: 1},
+		{Uid: 2, Port: 2, Passwd: "b", IPLimit: 2, Enable: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !manager.CheckUser(1, "1.1.1.1:1000") || !manager.CheckUser(1, "1.1.1.1:1001") {
+		t.Fatal("first ip of user is rejected")
+	}
+	if manager.CheckUser(1, "2.2.2.2:1000") {
+		t.Fatal("ip over node ip limit is allowed")
+	}
+	panel.wait(t, model.TriggerTypeIPLimit)
+	if manager.CheckUser(1, "3.3.3.3:1000") {
+		t.Fatal("ip over node ip limit is allowed")
+	}
+	select {
+	case <-panel.triggers:
+		t.Fatal("ip limit is reported more than once in window")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// user ip limit override node ip limit
+	if !manager.CheckUser(2, "1.1.1.1:1000") || !manager.CheckUser(2, "2.2.2.2:1000") {
+		t.Fatal("ips under user ip limit are rejected")
+	}
+
+	// ip limit of node is changed live
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1, IPLimit: 2})
+	if !manager.CheckUser(1, "2.2.2.2:1000") {
+		t.Fatal("ip limit of node is not changed")
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/ProxyPanel/VNet-SSR/utils/randomx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// journal record operations
+const (
+	journalDelta = "delta"
+	journalBatch = "batch"
+	journalAck   = "ack"
+)
+
+// trafficBatch is one traffic report, key is the idempotency key of report
+type trafficBatch struct {
+	Key     string               `json:"key"`
+	Time    int64                `json:"time"`
+	Traffic []*model.UserTraffic `json:"traffic"`
+}
+
+type journalRecord struct {
+	Op      string               `json:"op"`
+	Key     string               `json:"key,omitempty"`
+	Time    int64                `json:"time,omitempty"`
+	Traffic []*model.UserTraffic `json:"traffic,omitempty"`
+}
+
+// trafficJournal is the write-ahead journal of traffic. traffic deltas are appended before
+// they are reported, a report is a batch which is kept until panel acknowledges it.
+// the file is rewritten with unacknowledged batches and the carried traffic on every batch,
+// the journal is only kept in memory when path is empty
+type trafficJournal struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	pending []*trafficBatch
+}
+
+// openTrafficJournal replay the journal file, the unacknowledged batches are pending and
+// the deltas after last batch are returned as the traffic not reported yet
+func openTrafficJournal(path string) (*trafficJournal, []*model.UserTraffic, error) {
+	j := &trafficJournal{path: path}
+	if path == "" {
+		return j, nil, nil
+	}
+	carry := make(map[int]*model.UserTraffic)
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "open traffic journal error")
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			record := new(journalRecord)
+			if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+				// the last line may be broken by crash
+				logrus.WithFields(logrus.Fields{
+					"path": path,
+					"err":  err,
+				}).Warn("skip broken traffic journal record")
+				continue
+			}
+			switch record.Op {
+			case journalDelta:
+				mergeTraffic(carry, record.Traffic)
+			case journalBatch:
+				j.pending = append(j.pending, &trafficBatch{Key: record.Key, Time: record.Time, Traffic: record.Traffic})
+				// deltas before batch are included in batch or carried after it
+				carry = make(map[int]*model.UserTraffic)
+			case journalAck:
+				j.remove(record.Key)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "read traffic journal error")
+		}
+	}
+	traffic := make([]*model.UserTraffic, 0, len(carry))
+	for _, item := range carry {
+		traffic = append(traffic, item)
+	}
+	if err := j.rewrite(traffic); err != nil {
+		return nil, nil, err
+	}
+	return j, traffic, nil
+}
+
+func mergeTraffic(m map[int]*model.UserTraffic, traffic []*model.UserTraffic) {
+	for _, item := range traffic {
+		if m[item.Uid] == nil {
+			m[item.Uid] = &model.UserTraffic{Uid: item.Uid}
+		}
+		m[item.Uid].Upload += item.Upload
+		m[item.Uid].Download += item.Download
+	}
+}
+
+func (j *trafficJournal) remove(key string) {
+	for i, batch := range j.pending {
+		if batch.Key == key {
+			j.pending = append(j.pending[:i], j.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// rewrite replace the file with pending batches and carried traffic, then reopen it for append
+func (j *trafficJournal) rewrite(carry []*model.UserTraffic) error {
+	if j.path == "" {
+		return nil
+	}
+	tmp := j.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create traffic journal error")
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, batch := range j.pending {
+		err = encoder.Encode(&journalRecord{Op: journalBatch, Key: batch.Key, Time: batch.Time, Traffic: batch.Traffic})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil && len(carry) > 0 {
+		err = encoder.Encode(&journalRecord{Op: journalDelta, Traffic: carry})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "write traffic journal error")
+	}
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return errors.Wrap(err, "replace traffic journal error")
+	}
+	if dir, err := os.Open(filepath.Dir(j.path)); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return errors.Wrap(err, "open traffic journal error")
+}
+
+func (j *trafficJournal) append(record *journalRecord) error {
+	if j.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	return errors.Wrap(err, "append traffic journal error")
+}
+
+// Delta append traffic deltas which are not reported yet
+func (j *trafficJournal) Delta(traffic []*model.UserTraffic) error {
+	if len(traffic) == 0 {
+		return nil
+	}
+	j.Lock()
+	defer j.Unlock()
+	return j.append(&journalRecord{Op: journalDelta, Traffic: traffic})
+}
+
+// Batch create a report of traffic, carry is the traffic left for next report,
+// so all deltas before are replaced by them
+func (j *trafficJournal) Batch(traffic, carry []*model.UserTraffic) (*trafficBatch, error) {
+	j.Lock()
+	defer j.Unlock()
+	batch := &trafficBatch{
+		Key:     hex.EncodeToString(randomx.RandomBytes(16)),
+		Time:    time.Now().Unix(),
+		Traffic: traffic,
+	}
+	if len(traffic) > 0 {
+		j.pending = append(j.pending, batch)
+	}
+	return batch, j.rewrite(carry)
+}
+
+// Ack mark the batch is received by panel
+func (j *trafficJournal) Ack(key string) error {
+	j.Lock()
+	defer j.Unlock()
+	j.remove(key)
+	return j.append(&journalRecord{Op: journalAck, Key: key})
+}
+
+// Pending return the unacknowledged batches, oldest first
+func (j *trafficJournal) Pending() []*trafficBatch {
+	j.Lock()
+	defer j.Unlock()
+	return append([]*trafficBatch(nil), j.pending...)
+}
+
+func (j *trafficJournal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// minSendBackoff and maxSendBackoff are the retry interval of failed traffic report
+var (
+	minSendBackoff = time.Second
+	maxSendBackoff = 5 * time.Minute
+)
+
+// OpenJournal open the traffic journal at path, traffic not reported before last exit is restored
+func (s *SSRManager) OpenJournal(path string) error {
+	journal, carry, err := openTrafficJournal(path)
+	if err != nil {
+		return err
+	}
+	s.trafficLock.Lock()
+	defer s.trafficLock.Unlock()
+	mergeTraffic(s.traffic, carry)
+	s.journal = journal
+	s.quotaLock.Lock()
+	for _, batch := range append(journal.Pending(), &trafficBatch{Traffic: carry}) {
+		for _, item := range batch.Traffic {
+			s.restored[item.Uid] += item.Upload + item.Download
+		}
+	}
+	s.quotaLock.Unlock()
+	if pending := len(journal.Pending()); pending > 0 || len(carry) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"path":    path,
+			"pending": pending,
+			"carry":   len(carry),
+		}).Info("traffic journal restored")
+	}
+	return nil
+}
+
+// CloseJournal append the traffic not reported and close journal
+func (s *SSRManager) CloseJournal() error {
+	if s.journal == nil {
+		return nil
+	}
+	s.flushJournal()
+	return s.journal.Close()
+}
+
+// addDelta record the traffic not appended to journal. caller must hold trafficLock
+func (s *SSRManager) addDelta(uid int, upload, download int64) {
+	if s.delta[uid] == nil {
+		s.delta[uid] = &model.UserTraffic{Uid: uid}
+	}
+	s.delta[uid].Upload += upload
+	s.delta[uid].Download += download
+}
+
+// flushJournal append the traffic deltas to journal
+func (s *SSRManager) flushJournal() {
+	s.trafficLock.Lock()
+	delta := s.delta
+	s.delta = make(map[int]*model.UserTraffic)
+	s.trafficLock.Unlock()
+	if len(delta) == 0 || s.journal == nil {
+		return
+	}
+	traffic := make([]*model.UserTraffic, 0, len(delta))
+	for _, item := range delta {
+		traffic = append(traffic, item)
+	}
+	if err := s.journal.Delta(traffic); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// reportBatch journal the traffic to report as a batch and wake up SendTask
+func (s *SSRManager) reportBatch() {
+	s.trafficLock.Lock()
+	traffic := s.reportTrafficLocked()
+	// deltas are included in the batch or the carried traffic
+	s.delta = make(map[int]*model.UserTraffic)
+	carry := make([]*model.UserTraffic, 0, len(s.traffic))
+	for _, item := range s.traffic {
+		carry = append(carry, &model.UserTraffic{Uid: item.Uid, Upload: item.Upload, Download: item.Download})
+	}
+	s.trafficLock.Unlock()
+	log.Info("prepare report traffic data, data length: %v", len(traffic))
+	if _, err := s.journal.Batch(traffic, carry); err != nil {
+		logrus.Error(err)
+	}
+	select {
+	case s.journalNotify <- struct{}{}:
+	default:
+	}
+}
+
+// SendTask post the pending batches of journal oldest first, failed batch is retried
+// with exponential backoff and the same idempotency key
+func (s *SSRManager) SendTask() {
+	log.Info("SendTask start")
+	backoff := minSendBackoff
+	for {
+		batches := s.journal.Pending()
+		if len(batches) == 0 {
+			select {
+			case <-s.Context.Done():
+				log.Info("SendTask close")
+				return
+			case <-s.journalNotify:
+			}
+			continue
+		}
+		batch := batches[0]
+		if err := client.PostAllUserTraffic(batch.Key, batch.Traffic); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"key":     batch.Key,
+				"pending": len(batches),
+				"retry":   backoff.String(),
+				"err":     err,
+			}).Error("post traffic error")
+			select {
+			case <-s.Context.Done():
+				log.Info("SendTask close")
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxSendBackoff {
+				backoff = maxSendBackoff
+			}
+			continue
+		}
+		backoff = minSendBackoff
+		if err := s.journal.Ack(batch.Key); err != nil {
+			logrus.Error(err)
+		}
+		s.acknowledge(batch.Traffic)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+func TestTrafficJournal_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traffic.journal")
+
+	journal, carry, err := openTrafficJournal(path)
+	if err != nil || len(carry) != 0 {
+		t.Fatalf("open empty journal = %v, %v", carry, err)
+	}
+	_ = journal.Delta([]*model.UserTraffic{{Uid: 1, Upload: 100}, {Uid: 2, Upload: 10}})
+	batch, err := journal.Batch([]*model.UserTraffic{{Uid: 1, Upload: 100}}, []*model.UserTraffic{{Uid: 2, Upload: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acked, _ := journal.Batch([]*model.UserTraffic{{Uid: 3, Upload: 30}}, []*model.UserTraffic{{Uid: 2, Upload: 10}})
+	_ = journal.Ack(acked.Key)
+	_ = journal.Delta([]*model.UserTraffic{{Uid: 2, Download: 5}})
+	// crash in the middle of a line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.WriteString(`{"op":"delta","traf`)
+	file.Close()
+
+	journal, carry, err = openTrafficJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := journal.Pending()
+	if len(pending) != 1 || pending[0].Key != batch.Key || pending[0].Traffic[0].Upload != 100 {
+		t.Fatalf("pending after replay = %+v", pending)
+	}
+	if len(carry) != 1 || carry[0].Uid != 2 || carry[0].Upload != 10 || carry[0].Download != 5 {
+		t.Fatalf("carry after replay = %+v", carry)
+	}
+	_ = journal.Ack(batch.Key)
+	journal.Close()
+
+	journal, _, err = openTrafficJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if pending := journal.Pending(); len(pending) != 0 {
+		t.Fatalf("acked batch is pending %+v", pending)
+	}
+}
+
+// flakyTrafficClient fail the first posts of traffic
+type flakyTrafficClient struct {
+	client.PanelClient
+	fails int
+	keys  chan string
+}
+
+func (c *flakyTrafficClient) PostAllUserTraffic(key string, allUserTraffic []*model.UserTraffic) error {
+	c.keys <- key
+	if c.fails > 0 {
+		c.fails--
+		return errors.New("panel is down")
+	}
+	return nil
+}
+
+func TestSSRManager_SendTask(t *testing.T) {
+	defer func(min time.Duration) { minSendBackoff = min }(minSendBackoff)
+	minSendBackoff = 10 * time.Millisecond
+	defer client.SetPanelClient(client.GetPanelClient())
+	panel := &flakyTrafficClient{fails: 2, keys: make(chan string, 4)}
+	client.SetPanelClient(panel)
+
+	manager := NewShadowsocksrService()
+	manager.ReportThreshold = 0
+	manager.userTable[1] = &model.UserInfo{Uid: 1, Port: 1}
+	if err := manager.OpenJournal(""); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Context = ctx
+	manager.Upload(1, 100)
+	manager.reportBatch()
+	go manager.SendTask()
+
+	var keys []string
+	for len(keys) < 3 {
+		select {
+		case key := <-panel.keys:
+			keys = append(keys, key)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("traffic is not retried, keys %v", keys)
+		}
+	}
+	if keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Fatalf("idempotency key changed on retry %v", keys)
+	}
+	for i := 0; len(manager.journal.Pending()) != 0; i++ {
+		if i > 100 {
+			t.Fatal("batch is not acknowledged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,89 +2,225 @@ package service
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
+	"github.com/ProxyPanel/VNet-SSR/common/network"
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/model"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
-	"sync"
 )
 
+// minLimitBurst is the min burst bytes of limiter, so that small limit still allow a whole packet
+const minLimitBurst = 16 * 1024
+
 var (
 	limitInstance = NewLimit()
 )
 
 func GetLimitInstance() *Limit {
-	return limitInstance;
+	return limitInstance
 }
 
 func init() {
 	GetSSRManager().RegisterAddUserHandle(func(userInfo *model.UserInfo) {
-		// prefer use node limit when node limit less then user limit
-		if core.GetApp().NodeInfo().SpeedLimit == 0 ||
-			(core.GetApp().NodeInfo().SpeedLimit > userInfo.Limit && userInfo.Limit != 0) {
-			limitInstance.Set(userInfo.Port, int(userInfo.Limit))
-		} else {
-			limitInstance.Set(userInfo.Port, int(core.GetApp().NodeInfo().SpeedLimit))
-		}
+		limit := userLimit(userInfo.Limit, core.GetApp().NodeInfo().SpeedLimit)
+		limitInstance.Set(userInfo.Port, limit, limit)
 	})
 
-	GetSSRManager().RegisterDelUserHandle(func(uid int) {
-		limitInstance.Del(uid)
+	GetSSRManager().RegisterDelUserHandle(func(userInfo *model.UserInfo) {
+		limitInstance.Del(userInfo.Port)
 	})
 }
 
+// userLimit prefer use node limit when node limit less then user limit
+func userLimit(limit, nodeLimit uint64) int {
+	if nodeLimit == 0 || (nodeLimit > limit && limit != 0) {
+		return int(limit)
+	}
+	return int(nodeLimit)
+}
+
+// bucket is the token buckets of up and down direction, zero rate is unlimited
+type bucket struct {
+	up   *rate.Limiter
+	down *rate.Limiter
+}
+
+func newBucket(up, down int) *bucket {
+	return &bucket{
+		up:   rate.NewLimiter(limitOf(up), burstOf(up)),
+		down: rate.NewLimiter(limitOf(down), burstOf(down)),
+	}
+}
+
+// set change the rates in place, tokens of waiting connections are kept
+func (b *bucket) set(up, down int) {
+	b.up.SetLimit(limitOf(up))
+	b.up.SetBurst(burstOf(up))
+	b.down.SetLimit(limitOf(down))
+	b.down.SetBurst(burstOf(down))
+}
+
+func limitOf(bytes int) rate.Limit {
+	if bytes <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bytes)
+}
+
+// burstOf allow a fifth second of traffic in burst
+func burstOf(bytes int) int {
+	if burst := bytes / 5; burst > minLimitBurst {
+		return burst
+	}
+	return minLimitBurst
+}
+
+// Limit is a hierarchical limiter, traffic of a connection wait the connection bucket,
+// then the bucket of its user, then the aggregate bucket of node. users are keyed by port
 type Limit struct {
-	gLocker    sync.Locker
-	upLimits   map[int]*rate.Limiter
-	downLimits map[int]*rate.Limiter
+	sync.RWMutex
+	node  *bucket
+	users map[int]*bucket
+	// connUp and connDown are the rates of each connection, connVersion is increased when they change
+	connUp      int64
+	connDown    int64
+	connVersion int64
 }
 
 func NewLimit() *Limit {
 	return &Limit{
-		gLocker:    new(sync.Mutex),
-		upLimits:   make(map[int]*rate.Limiter),
-		downLimits: make(map[int]*rate.Limiter),
+		node:  newBucket(0, 0),
+		users: make(map[int]*bucket),
+	}
+}
+
+// Set the up and down bytes per second of user, 0 is unlimited
+func (l *Limit) Set(port int, up, down int) {
+	l.RLock()
+	b := l.users[port]
+	l.RUnlock()
+	if b == nil {
+		if up == 0 && down == 0 {
+			return
+		}
+		l.Lock()
+		if b = l.users[port]; b == nil {
+			b = newBucket(0, 0)
+			l.users[port] = b
+		}
+		l.Unlock()
+	}
+	logrus.Infof("limit set %v: up %v down %v", port, up, down)
+	b.set(up, down)
+}
+
+func (l *Limit) Del(port int) {
+	l.Lock()
+	defer l.Unlock()
+	logrus.Infof("limit remove %v", port)
+	delete(l.users, port)
+}
+
+// SetNode set the aggregate bytes per second of all users, 0 is unlimited
+func (l *Limit) SetNode(up, down int) {
+	logrus.Infof("limit node up %v down %v", up, down)
+	l.node.set(up, down)
+}
+
+// SetConn set the bytes per second of each connection, 0 is unlimited
+func (l *Limit) SetConn(up, down int) {
+	atomic.StoreInt64(&l.connUp, int64(up))
+	atomic.StoreInt64(&l.connDown, int64(down))
+	atomic.AddInt64(&l.connVersion, 1)
+}
+
+func (l *Limit) user(port int) *bucket {
+	l.RLock()
+	defer l.RUnlock()
+	return l.users[port]
+}
+
+func (l *Limit) UpLimit(ctx context.Context, port, n int) error {
+	if b := l.user(port); b != nil {
+		if err := waitN(ctx, b.up, "up", n); err != nil {
+			return err
+		}
 	}
+	return waitN(ctx, l.node.up, "up", n)
 }
 
-func (l *Limit) Set(uid int, limition int) {
-	l.gLocker.Lock()
-	defer l.gLocker.Unlock()
+func (l *Limit) DownLimit(ctx context.Context, port, n int) error {
+	if b := l.user(port); b != nil {
+		if err := waitN(ctx, b.down, "down", n); err != nil {
+			return err
+		}
+	}
+	return waitN(ctx, l.node.down, "down", n)
+}
 
-	if limition != 0 {
-		logrus.Infof("limit add %v:%v", uid, limition)
-		l.upLimits[uid] = rate.NewLimiter(rate.Limit(limition), int(limition))
-		l.downLimits[uid] = rate.NewLimiter(rate.Limit(limition), int(limition))
-	} else {
-		logrus.Infof("limit ignore zero limit uid: %v", uid)
+// NewConn return the limiter of one connection
+func (l *Limit) NewConn() network.ILimiter {
+	return &connLimit{
+		Limit:  l,
+		bucket: newBucket(0, 0),
 	}
+}
 
+// connLimit wait the bucket of connection before the buckets of Limit
+type connLimit struct {
+	*Limit
+	*bucket
+	version int64
 }
 
-func (l *Limit) Del(uid int) {
-	l.gLocker.Lock()
-	defer l.gLocker.Unlock()
-	logrus.Infof("limit remove %v", uid)
-	delete(l.upLimits, uid)
+// sync update the connection bucket when the rates of connection changed
+func (c *connLimit) sync() {
+	if version := atomic.LoadInt64(&c.Limit.connVersion); version != atomic.LoadInt64(&c.version) {
+		atomic.StoreInt64(&c.version, version)
+		c.bucket.set(int(atomic.LoadInt64(&c.Limit.connUp)), int(atomic.LoadInt64(&c.Limit.connDown)))
+	}
 }
 
-func (l *Limit) UpLimit(uid, n int) error {
-	if l.upLimits[uid] != nil {
-		return l.upLimits[uid].WaitN(context.Background(), n)
+func (c *connLimit) UpLimit(ctx context.Context, port, n int) error {
+	c.sync()
+	if err := waitN(ctx, c.bucket.up, "up", n); err != nil {
+		return err
 	}
-	return nil
+	return c.Limit.UpLimit(ctx, port, n)
 }
 
-func (l *Limit) DownLimit(uid, n int) error {
-	if l.downLimits[uid] != nil {
-		return l.downLimits[uid].WaitN(context.Background(), n)
+func (c *connLimit) DownLimit(ctx context.Context, port, n int) error {
+	c.sync()
+	if err := waitN(ctx, c.bucket.down, "down", n); err != nil {
+		return err
 	}
-	return nil
+	return c.Limit.DownLimit(ctx, port, n)
 }
 
-func (l *Limit) Wait(uid, n int) error {
-	if l.upLimits[uid] != nil {
-		return l.upLimits[uid].WaitN(context.Background(), n)
+// waitN wait the limiter in chunks of its burst and count the blocked time into metrics,
+// it returns when ctx is done
+func waitN(ctx context.Context, limiter *rate.Limiter, direction string, n int) error {
+	if limiter.Limit() == rate.Inf || n <= 0 {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		metrics.LimiterWait(direction, time.Since(start))
+	}()
+	for n > 0 {
+		chunk := limiter.Burst()
+		if chunk > n {
+			chunk = n
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
 	}
 	return nil
 }
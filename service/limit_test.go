@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimit_Set(t *testing.T) {
+	limit := NewLimit()
+	limit.Set(1, 0, 0)
+	if limit.user(1) != nil {
+		t.Fatal("unlimited user is added")
+	}
+	limit.Set(1, 100*1024, 200*1024)
+	b := limit.user(1)
+	if b == nil || b.up.Limit() != 100*1024 || b.down.Limit() != 200*1024 {
+		t.Fatal("user limit is not set")
+	}
+	limit.Set(1, 300*1024, 300*1024)
+	if limit.user(1) != b || b.up.Limit() != 300*1024 || b.up.Burst() != 300*1024/5 {
+		t.Fatal("user limit is not updated in place")
+	}
+	limit.Del(1)
+	if limit.user(1) != nil {
+		t.Fatal("user limit is not removed")
+	}
+}
+
+func TestLimit_Wait(t *testing.T) {
+	limit := NewLimit()
+	limit.Set(1, minLimitBurst, 0)
+	ctx := context.Background()
+	// more than burst is waited in chunks
+	start := time.Now()
+	if err := limit.UpLimit(ctx, 1, minLimitBurst*3/2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("up is not limited, elapsed %v", elapsed)
+	}
+	if err := limit.DownLimit(ctx, 1, 10*minLimitBurst); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait is cancelled with the context of connection
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	if err := limit.UpLimit(ctx, 1, 10*minLimitBurst); err == nil {
+		t.Fatal("cancelled wait return no error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("wait is not cancelled, elapsed %v", elapsed)
+	}
+}
+
+func TestLimit_NodeAndConn(t *testing.T) {
+	limit := NewLimit()
+	ctx := context.Background()
+	conn := limit.NewConn()
+	limit.SetNode(0, minLimitBurst)
+	_ = limit.DownLimit(ctx, 2, minLimitBurst)
+	start := time.Now()
+	// node limit is shared by users without limit
+	if err := conn.DownLimit(ctx, 3, minLimitBurst/2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("node down is not limited, elapsed %v", elapsed)
+	}
+
+	limit.SetConn(minLimitBurst, 0)
+	_ = conn.UpLimit(ctx, 3, minLimitBurst)
+	start = time.Now()
+	if err := conn.UpLimit(ctx, 3, minLimitBurst/2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("conn limit is not updated, elapsed %v", elapsed)
+	}
+	// other connections have their own bucket
+	start = time.Now()
+	_ = limit.NewConn().UpLimit(ctx, 3, minLimitBurst/2)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("conn limit is shared, elapsed %v", elapsed)
+	}
+}
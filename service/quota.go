@@ -0,0 +1,221 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+// userQuota is the quota state of user, usage is the traffic counted by node which
+// is not included in used yet, so quota is enforced between user list syncs.
+// acked is the part of usage acknowledged by panel, only it is removed from usage when used grows
+type userQuota struct {
+	port       int
+	quota      int64
+	used       int64
+	usage      int64
+	acked      int64
+	expireTime int64
+	// blocked is the trigger type user is blocked for, empty is not blocked
+	blocked string
+}
+
+// exceed return the trigger type when user is over quota or expired
+func (q *userQuota) exceed(now time.Time) string {
+	if q.expireTime > 0 && now.Unix() >= q.expireTime {
+		return model.TriggerTypeExpire
+	}
+	if q.quota > 0 && q.used+q.usage >= q.quota {
+		return model.TriggerTypeQuota
+	}
+	return ""
+}
+
+func (q *userQuota) reason() string {
+	if q.blocked == model.TriggerTypeExpire {
+		return fmt.Sprintf("expired at %s", time.Unix(q.expireTime, 0).Format(time.RFC3339))
+	}
+	return fmt.Sprintf("used %s of quota %s", humanize.Bytes(uint64(q.used+q.usage)), humanize.Bytes(uint64(q.quota)))
+}
+
+// setQuotaLocked update quota of user when user is added or changed. used also grows by the
+// traffic of other nodes, so only the acknowledged usage of this node is subtracted.
+// caller must hold userTableLock
+func (s *SSRManager) setQuotaLocked(user *model.UserInfo) {
+	s.quotaLock.Lock()
+	q := s.quotas[user.Uid]
+	if q == nil {
+		q = new(userQuota)
+		s.quotas[user.Uid] = q
+	} else if user.Used > q.used {
+		counted := user.Used - q.used
+		if counted > q.acked {
+			counted = q.acked
+		}
+		q.acked -= counted
+		if q.usage -= counted; q.usage < 0 {
+			q.usage = 0
+		}
+	}
+	q.port = user.Port
+	q.quota = user.Quota
+	q.used = user.Used
+	q.expireTime = user.ExpireTime
+	before := q.blocked
+	q.blocked = q.exceed(time.Now())
+	blocked, reason := q.blocked, q.reason()
+	s.quotaLock.Unlock()
+
+	if before != "" && blocked == "" {
+		logrus.WithFields(logrus.Fields{
+			"uid": user.Uid,
+		}).Info("user is unblocked")
+	}
+	if before == "" && blocked != "" {
+		s.closeUserLocked(user.Port)
+		s.reportBlocked(user.Uid, blocked, reason)
+	}
+}
+
+func (s *SSRManager) delQuota(uid int) {
+	s.quotaLock.Lock()
+	delete(s.quotas, uid)
+	s.quotaLock.Unlock()
+}
+
+// consume count the traffic of user and block user once quota is used up
+func (s *SSRManager) consume(uid int, n int64) {
+	s.quotaLock.Lock()
+	q := s.quotas[uid]
+	if q == nil {
+		s.quotaLock.Unlock()
+		return
+	}
+	// traffic of blocked user is still reported, so it is counted for acknowledgement
+	q.usage += n
+	if q.blocked != "" {
+		s.quotaLock.Unlock()
+		return
+	}
+	q.blocked = q.exceed(time.Now())
+	blocked, port, reason := q.blocked, q.port, q.reason()
+	s.quotaLock.Unlock()
+	if blocked != "" {
+		s.blockUser(uid, port, blocked, reason)
+	}
+}
+
+// acknowledge count the traffic of batch received by panel in the usage to subtract,
+// the traffic restored from journal is skipped as it is not in usage
+func (s *SSRManager) acknowledge(traffic []*model.UserTraffic) {
+	s.quotaLock.Lock()
+	defer s.quotaLock.Unlock()
+	for _, item := range traffic {
+		n := item.Upload + item.Download
+		if restored := s.restored[item.Uid]; restored > 0 {
+			if restored > n {
+				restored = n
+			}
+			n -= restored
+			if s.restored[item.Uid] -= restored; s.restored[item.Uid] == 0 {
+				delete(s.restored, item.Uid)
+			}
+		}
+		if q := s.quotas[item.Uid]; q != nil && n > 0 {
+			q.acked += n
+		}
+	}
+}
+
+// checkExpire block the users expired since last check
+func (s *SSRManager) checkExpire() {
+	now := time.Now()
+	type expired struct {
+		uid, port int
+		reason    string
+	}
+	var users []expired
+	s.quotaLock.Lock()
+	for uid, q := range s.quotas {
+		if q.blocked == "" && q.expireTime > 0 && now.Unix() >= q.expireTime {
+			q.blocked = model.TriggerTypeExpire
+			users = append(users, expired{uid, q.port, q.reason()})
+		}
+	}
+	s.quotaLock.Unlock()
+	for _, user := range users {
+		s.blockUser(user.uid, user.port, model.TriggerTypeExpire, user.reason)
+	}
+}
+
+// CheckUser implement core.UserChecker, reject the handshakes of disabled or blocked user
+// and the source ips over ip limit
+func (s *SSRManager) CheckUser(port int, ip string) bool {
+	s.userTableLock.Lock()
+	user := s.userTable[s.portToUidLocked(port)]
+	s.userTableLock.Unlock()
+	if user == nil {
+		return true
+	}
+	if user.Enable == 0 {
+		metrics.HandshakeFail(metrics.ReasonUserDisabled)
+		return false
+	}
+	if !s.checkQuota(user.Uid) {
+		metrics.HandshakeFail(metrics.ReasonUserBlocked)
+		return false
+	}
+	return s.checkIP(user, ip)
+}
+
+func (s *SSRManager) checkQuota(uid int) bool {
+	s.quotaLock.Lock()
+	defer s.quotaLock.Unlock()
+	q := s.quotas[uid]
+	if q == nil {
+		return true
+	}
+	// expired user is blocked and reported by checkExpire
+	return q.blocked == "" && q.exceed(time.Now()) == ""
+}
+
+func (s *SSRManager) blockUser(uid, port int, triggerType, reason string) {
+	s.userTableLock.Lock()
+	s.closeUserLocked(port)
+	s.userTableLock.Unlock()
+	s.reportBlocked(uid, triggerType, reason)
+}
+
+// closeUserLocked close the sessions of user on all servers including draining ones and return
+// the count of them. caller must hold userTableLock
+func (s *SSRManager) closeUserLocked(port int) int {
+	count := 0
+	for _, ssr := range s.serversLocked() {
+		count += ssr.CloseUser(port)
+	}
+	return count
+}
+
+func (s *SSRManager) reportBlocked(uid int, triggerType, reason string) {
+	logrus.WithFields(logrus.Fields{
+		"uid":    uid,
+		"type":   triggerType,
+		"reason": reason,
+	}).Warn("user is blocked")
+	go func() {
+		err := client.PostTrigger(model.Trigger{
+			Uid:    uid,
+			Reason: reason,
+			Type:   triggerType,
+		})
+		if err != nil {
+			log.Err(err)
+		}
+	}()
+}
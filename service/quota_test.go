@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+// triggerClient is a panel client which record triggers
+type triggerClient struct {
+	client.PanelClient
+	triggers chan model.Trigger
+}
+
+func (c *triggerClient) PostTrigger(trigger model.Trigger) error {
+	c.triggers <- trigger
+	return nil
+}
+
+func (c *triggerClient) wait(t *testing.T, triggerType string) {
+	select {
+	case trigger := <-c.triggers:
+		if trigger.Type != triggerType {
+			t.Fatalf("trigger type = %v, want %v", trigger.Type, triggerType)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("trigger %v is not reported", triggerType)
+	}
+}
+
+func TestSSRManager_Quota(t *testing.T) {
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1})
+	defer client.SetPanelClient(client.GetPanelClient())
+	panel := &triggerClient{triggers: make(chan model.Trigger, 4)}
+	client.SetPanelClient(panel)
+	manager := NewShadowsocksrService()
+	user := &model.UserInfo{Uid: 1, Port: 1, Passwd: "a", Quota: 1000, Used: 800, Enable: 1}
+	if err := manager.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Upload(1, 100)
+	if !manager.CheckUser(1, "127.0.0.1:1000") {
+		t.Fatal("user is blocked before quota is used up")
+	}
+	manager.Download(1, 100)
+	if manager.CheckUser(1, "127.0.0.1:1000") {
+		t.Fatal("user is not blocked after quota is used up")
+	}
+	panel.wait(t, model.TriggerTypeQuota)
+
+	// used grows by the traffic of other nodes before the report of this node is acknowledged
+	manager.userTableLock.Lock()
+	manager.setQuotaLocked(&model.UserInfo{Uid: 1, Port: 1, Passwd: "a", Quota: 2000, Used: 900, Enable: 1})
+	manager.userTableLock.Unlock()
+	if usage := manager.quotas[1].usage; usage != 200 {
+		t.Fatalf("usage before acknowledged = %v, want 200", usage)
+	}
+
+	// panel count the acknowledged traffic in used, and add more quota
+	manager.acknowledge([]*model.UserTraffic{{Uid: 1, Upload: 100, Download: 100}})
+	manager.userTableLock.Lock()
+	manager.setQuotaLocked(&model.UserInfo{Uid: 1, Port: 1, Passwd: "a", Quota: 2000, Used: 1100, Enable: 1})
+	manager.userTableLock.Unlock()
+	if !manager.CheckUser(1, "127.0.0.1:1000") {
+		t.Fatal("user is not unblocked after quota increased")
+	}
+	if q := manager.quotas[1]; q.usage != 0 || q.acked != 0 {
+		t.Fatalf("usage included in used = %v, acked = %v, want 0", q.usage, q.acked)
+	}
+
+	// traffic restored from journal is not in usage
+	manager.restored[1] = 50
+	manager.Upload(1, 100)
+	manager.acknowledge([]*model.UserTraffic{{Uid: 1, Upload: 150}})
+	if q := manager.quotas[1]; q.acked != 100 || len(manager.restored) != 0 {
+		t.Fatalf("acked = %v, restored = %v, want 100 and empty", q.acked, manager.restored)
+	}
+}
+
+func TestSSRManager_Disabled(t *testing.T) {
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1})
+	manager := NewShadowsocksrService()
+	if err := manager.AddUser(&model.UserInfo{Uid: 3, Port: 3, Passwd: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if manager.CheckUser(3, "127.0.0.1:1000") {
+		t.Fatal("disabled user is allowed")
+	}
+	manager.userTableLock.Lock()
+	err := manager.syncUser(&model.UserInfo{Uid: 3, Port: 3, Passwd: "c", Enable: 1})
+	manager.userTableLock.Unlock()
+	if err != nil || !manager.CheckUser(3, "127.0.0.1:1000") {
+		t.Fatalf("enabled user is rejected: %v", err)
+	}
+}
+
+func TestSSRManager_Expire(t *testing.T) {
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1})
+	defer client.SetPanelClient(client.GetPanelClient())
+	panel := &triggerClient{triggers: make(chan model.Trigger, 4)}
+	client.SetPanelClient(panel)
+	manager := NewShadowsocksrService()
+	expireTime := time.Now().Add(time.Second).Unix()
+	if err := manager.AddUser(&model.UserInfo{Uid: 2, Port: 2, Passwd: "b", ExpireTime: expireTime, Enable: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !manager.CheckUser(2, "127.0.0.1:1000") {
+		t.Fatal("user is blocked before expire")
+	}
+	for time.Now().Unix() < expireTime {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if manager.CheckUser(2, "127.0.0.1:1000") {
+		t.Fatal("expired user is allowed")
+	}
+	manager.checkExpire()
+	panel.wait(t, model.TriggerTypeExpire)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/obfs"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/ProxyPanel/VNet-SSR/proxy/server"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SetObfsProtocolService set the protocol service of node, the service and its recorded clients
+// are kept when protocol is not changed, only the client limit is swapped
+func SetObfsProtocolService(before, after *model.NodeInfo) {
+	if before == nil || before.Protocol != after.Protocol || core.GetApp().GetObfsProtocolService() == nil {
+		core.GetApp().SetObfsProtocolService(obfs.NewObfsAuthChainData(after.Protocol))
+	}
+	if after.ClientLimit != 0 {
+		log.Info("set client limit with %v", after.ClientLimit)
+		core.GetApp().GetObfsProtocolService().SetMaxClient(after.ClientLimit)
+	} else {
+		log.Info("ignore client limit, because client_limit is zero, use default limit is %v", obfs.DefaultMaxClient)
+		core.GetApp().GetObfsProtocolService().SetMaxClient(obfs.DefaultMaxClient)
+	}
+}
+
+// listenerChanged report whether the listeners must be rebound with the new node info,
+// password of node is only used in single port mode
+func listenerChanged(before, after *model.NodeInfo) bool {
+	return before.Method != after.Method ||
+		before.Protocol != after.Protocol ||
+		before.ProtocolParam != after.ProtocolParam ||
+		before.Obfs != after.Obfs ||
+		before.ObfsParam != after.ObfsParam ||
+		before.Redirect != after.Redirect ||
+		before.IsUDP != after.IsUDP ||
+		(after.Single == 1 && before.Passwd != after.Passwd)
+}
+
+// ReloadNode apply the new node info without restart, only listeners whose parameters or port
+// changed are rebound, their established connections are drained in GraceTimeout.
+// switching between single port and multi port falls back to a full reload
+func (s *SSRManager) ReloadNode(nodeInfo *model.NodeInfo) error {
+	before := core.GetApp().NodeInfo()
+	if before == nil || before.Single != nodeInfo.Single {
+		core.GetApp().SetNodeInfo(nodeInfo)
+		return s.Reload()
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.userTableLock.Lock()
+	defer s.userTableLock.Unlock()
+	core.GetApp().SetNodeInfo(nodeInfo)
+
+	changed := listenerChanged(before, nodeInfo)
+	var err error
+	if nodeInfo.Single == 1 {
+		err = s.reloadSinglePorts(nodeInfo, changed)
+	} else if changed {
+		err = s.rebindUserPorts(nodeInfo)
+	}
+	if before.SpeedLimit != nodeInfo.SpeedLimit {
+		for _, user := range s.userTable {
+			for _, handle := range s.addUserHandles {
+				handle(user)
+			}
+		}
+	}
+	return err
+}
+
+// reloadSinglePorts drain the removed ports and all ports when parameters changed, then
+// start the missing ports with users of user table
+func (s *SSRManager) reloadSinglePorts(after *model.NodeInfo, changed bool) error {
+	ports, err := parsePorts(after.Port)
+	if err != nil {
+		return err
+	}
+	keep := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		keep[port] = !changed
+	}
+	for port, ssr := range s.Shadowsocksrs {
+		if keep[port] {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"port": port,
+		}).Info("reload node drain single port")
+		if err := s.drainLocked(ssr); err != nil {
+			return errors.Wrap(err, "reload node drain port error")
+		}
+		delete(s.Shadowsocksrs, port)
+	}
+	var failed []string
+	for _, port := range ports {
+		if s.Shadowsocksrs[port] != nil {
+			continue
+		}
+		ssr := s.NewShadowsocksRProxy(port,
+			after.Method,
+			after.Passwd,
+			after.Protocol,
+			after.ProtocolParam,
+			after.Obfs,
+			after.ObfsParam,
+			after.Single,
+			&server.ShadowsocksRArgs{})
+		for _, user := range s.userTable {
+			ssr.AddUser(user.Port, user.Passwd)
+		}
+		if err := ssr.Start(); err != nil {
+			delete(s.Shadowsocksrs, port)
+			failed = append(failed, fmt.Sprintf("port %v: %s", port, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("reload node start port error: %s", strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
+// rebindUserPorts drain the port of every user and bind it again with the new parameters
+func (s *SSRManager) rebindUserPorts(after *model.NodeInfo) error {
+	var failed []string
+	for _, user := range s.userTable {
+		if ssr := s.Shadowsocksrs[user.Port]; ssr != nil {
+			if err := s.drainLocked(ssr); err != nil {
+				failed = append(failed, fmt.Sprintf("port %v: %s", user.Port, err))
+				continue
+			}
+			delete(s.Shadowsocksrs, user.Port)
+		}
+		ssr := s.NewShadowsocksRProxy(user.Port,
+			after.Method,
+			user.Passwd,
+			after.Protocol,
+			after.ProtocolParam,
+			after.Obfs,
+			after.ObfsParam,
+			after.Single,
+			&server.ShadowsocksRArgs{})
+		if err := ssr.Start(); err != nil {
+			delete(s.Shadowsocksrs, user.Port)
+			failed = append(failed, fmt.Sprintf("port %v: %s", user.Port, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("reload node rebind port error: %s", strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
+// drainLocked drain the server, it's kept in draining until its connections are closed after
+// GraceTimeout, so its sessions are still listed and closed with users. caller must hold userTableLock
+func (s *SSRManager) drainLocked(ssr *server.ShadowsocksRProxy) error {
+	if s.GraceTimeout <= 0 {
+		return ssr.Drain(0, nil)
+	}
+	s.draining[ssr] = true
+	err := ssr.Drain(s.GraceTimeout, func() {
+		s.userTableLock.Lock()
+		defer s.userTableLock.Unlock()
+		delete(s.draining, ssr)
+	})
+	if err != nil {
+		delete(s.draining, ssr)
+	}
+	return err
+}
+
+// serversLocked return the running and draining servers. caller must hold userTableLock
+func (s *SSRManager) serversLocked() []*server.ShadowsocksRProxy {
+	servers := make([]*server.ShadowsocksRProxy, 0, len(s.Shadowsocksrs)+len(s.draining))
+	for _, ssr := range s.Shadowsocksrs {
+		servers = append(servers, ssr)
+	}
+	for ssr := range s.draining {
+		servers = append(servers, ssr)
+	}
+	return servers
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestSSRManager_ReloadNode(t *testing.T) {
+	core.GetApp().SetHost("127.0.0.1")
+	core.GetApp().SetNodeInfo(&model.NodeInfo{
+		Method:   "aes-256-cfb",
+		Protocol: "origin",
+		Obfs:     "plain",
+	})
+	manager := NewShadowsocksrService()
+	manager.GraceTimeout = 200 * time.Millisecond
+	port := freePort(t)
+	if err := manager.AddUser(&model.UserInfo{Uid: 1, Port: port, Passwd: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.DelUser(1)
+	before := manager.Shadowsocksrs[port]
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; before.ConnCount() == 0; i++ {
+		if i > 100 {
+			t.Fatal("connection is not tracked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// client limit is not a listener parameter
+	if err := manager.ReloadNode(&model.NodeInfo{Method: "aes-256-cfb", Protocol: "origin", Obfs: "plain", ClientLimit: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if manager.Shadowsocksrs[port] != before {
+		t.Fatal("listener is rebound without parameter change")
+	}
+
+	if err := manager.ReloadNode(&model.NodeInfo{Method: "aes-128-cfb", Protocol: "origin", Obfs: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	after := manager.Shadowsocksrs[port]
+	if after == before || after.Method != "aes-128-cfb" {
+		t.Fatalf("listener is not rebound, method %v", after.Method)
+	}
+	newConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	if err != nil {
+		t.Fatalf("rebound port is not accepted: %v", err)
+	}
+	newConn.Close()
+
+	// established connection still works in grace timeout, then it's closed
+	if before.ConnCount() != 1 {
+		t.Fatalf("connection is closed before grace timeout")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection is not closed after grace timeout")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("connection is not closed after grace timeout")
+	}
+}
+
+func TestSetObfsProtocolService(t *testing.T) {
+	nodeInfo := &model.NodeInfo{Protocol: "auth_aes128_md5", ClientLimit: 4}
+	SetObfsProtocolService(nil, nodeInfo)
+	service := core.GetApp().GetObfsProtocolService()
+	SetObfsProtocolService(nodeInfo, &model.NodeInfo{Protocol: "auth_aes128_md5", ClientLimit: 8})
+	if core.GetApp().GetObfsProtocolService() != service {
+		t.Fatal("protocol service is replaced when protocol is not changed")
+	}
+	SetObfsProtocolService(nodeInfo, &model.NodeInfo{Protocol: "auth_chain_a"})
+	if core.GetApp().GetObfsProtocolService() == service {
+		t.Fatal("protocol service is kept when protocol changed")
+	}
+}
+
+func TestSSRManager_ReloadNodeDraining(t *testing.T) {
+	core.GetApp().SetHost("127.0.0.1")
+	core.GetApp().SetNodeInfo(&model.NodeInfo{
+		Method:   "aes-256-cfb",
+		Protocol: "origin",
+		Obfs:     "plain",
+	})
+	manager := NewShadowsocksrService()
+	manager.GraceTimeout = time.Second
+	port := freePort(t)
+	if err := manager.AddUser(&model.UserInfo{Uid: 1, Port: port, Passwd: "pass", Enable: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.DelUser(1)
+	before := manager.Shadowsocksrs[port]
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; before.ConnCount() == 0; i++ {
+		if i > 100 {
+			t.Fatal("connection is not tracked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := manager.ReloadNode(&model.NodeInfo{Method: "aes-128-cfb", Protocol: "origin", Obfs: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// sessions of the draining server are listed and kicked in grace timeout
+	if sessions := manager.Sessions(SessionFilter{Uid: 1}); len(sessions) != 1 || sessions[0].Uid != 1 {
+		t.Fatalf("sessions in grace timeout = %+v", sessions)
+	}
+	if count, err := manager.KickUser(1); err != nil || count != 1 {
+		t.Fatalf("KickUser() = %v, %v", count, err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("kicked connection is not closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("kicked connection is not closed")
+	}
+
+	// draining server is forgotten after its connections are closed
+	for i := 0; ; i++ {
+		manager.userTableLock.Lock()
+		draining := len(manager.draining)
+		manager.userTableLock.Unlock()
+		if draining == 0 {
+			break
+		}
+		if i > 300 {
+			t.Fatal("draining server is kept after grace timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadNodeProtocolService(t *testing.T) {
+	before := &model.NodeInfo{Single: 1, Port: "", Protocol: "auth_aes128_md5"}
+	core.GetApp().SetNodeInfo(before)
+	SetObfsProtocolService(nil, before)
+	service := core.GetApp().GetObfsProtocolService()
+	// listeners are not reloaded, so protocol service is kept
+	if err := ReloadNode(&model.NodeInfo{Single: 1, Port: "bad", Protocol: "auth_chain_a"}); err == nil {
+		t.Fatal("reload node with bad port should fail")
+	}
+	if core.GetApp().GetObfsProtocolService() != service {
+		t.Fatal("protocol service is replaced when reload node failed")
+	}
+}
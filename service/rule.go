@@ -1,25 +1,56 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/ProxyPanel/VNet-SSR/api/client"
 	"github.com/ProxyPanel/VNet-SSR/common/cache"
+	"github.com/ProxyPanel/VNet-SSR/common/geo"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/matcher"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
+	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"net"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	RuleTypeReg    = "reg"
-	RuleTypeDomain = "domain"
-	RuleTypeIp     = "ip"
+	RuleTypeReg           = "reg"
+	RuleTypeDomain        = "domain"
+	RuleTypeIp            = "ip"
+	RuleTypeCIDR          = "cidr"
+	RuleTypeDomainSuffix  = "domain_suffix"
+	RuleTypeDomainKeyword = "domain_keyword"
+	RuleTypePort          = "port"
+	RuleTypePortRange     = "port_range"
+	RuleTypeNetwork       = "network"
+	RuleTypeGeoIP         = "geoip"
+	RuleTypeGeoSite       = "geosite"
+	RuleTypeProtocol      = "protocol"
 
 	RuleModeAllow  = "allow"
 	RuleModeReject = "reject"
 	RuleModeAll    = "all"
 )
 
+// resolveTimeout is the max time to resolve domain for cidr and geoip rules
+const resolveTimeout = 2 * time.Second
+
+// geoWatchDelay wait the geo database file written completely before reload
+const geoWatchDelay = time.Second
+
 var (
 	ruleServiceInstance = NewRuleService()
 )
@@ -28,14 +59,75 @@ func GetRuleService() *RuleService {
 	return ruleServiceInstance
 }
 
-type RuleItemComiled struct {
-	model.RuleItem
-	compile interface{}
+func init() {
+	GetSSRManager().RegisterAddUserHandle(func(userInfo *model.UserInfo) {
+		ruleServiceInstance.SetUserPolicy(userInfo.Port, userInfo.Policy)
+	})
+
+	GetSSRManager().RegisterDelUserHandle(func(userInfo *model.UserInfo) {
+		ruleServiceInstance.SetUserPolicy(userInfo.Port, "")
+	})
 }
-type RuleService struct {
+
+// rulePolicy is the mode and rules of a policy
+type rulePolicy struct {
 	mode  string
-	rules []*RuleItemComiled
-	cache *cache.LRU
+	rules *ruleSet
+}
+
+// ruleState is the compiled rules, it is never changed after built and swapped as a whole,
+// so a judge always use the rules of one version
+type ruleState struct {
+	rule     *model.Rule
+	version  string
+	mode     string
+	rules    *ruleSet
+	policies map[string]*rulePolicy
+	cache    *cache.LRU
+}
+
+// newRuleState compile rule with the geo databases
+func newRuleState(rule *model.Rule, version string, geoIP geo.IPDB, geoSite *geo.SiteDB) *ruleState {
+	state := &ruleState{
+		rule:     rule,
+		version:  version,
+		mode:     rule.Model,
+		rules:    newRuleSet(rule.Rules, geoIP, geoSite),
+		policies: make(map[string]*rulePolicy, len(rule.Policies)),
+		cache:    cache.NewLruCache(5 * time.Second),
+	}
+	for name, policy := range rule.Policies {
+		state.policies[name] = &rulePolicy{
+			mode:  policy.Model,
+			rules: newRuleSet(policy.Rules, geoIP, geoSite),
+		}
+	}
+	return state
+}
+
+// RuleVersion return the hash of rule, same rules have the same version
+func RuleVersion(rule *model.Rule) string {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RuleService judge target with the rules of node, then the rules of user policy
+type RuleService struct {
+	// state is the current *ruleState
+	state atomic.Value
+	// userPolicies are the policies of users by port
+	userLock     sync.RWMutex
+	userPolicies map[int]string
+	// lock serialize the loading of rules and protect the geo databases and their paths
+	lock        sync.Mutex
+	geoIP       geo.IPDB
+	geoSite     *geo.SiteDB
+	geoIPPath   string
+	geoSitePath string
 }
 
 func NewRuleService() *RuleService {
@@ -46,9 +138,38 @@ func NewRuleService() *RuleService {
 
 // Reset RuleService set all field to default.
 func (r *RuleService) Reset() {
-	r.cache = cache.NewLruCache(5 * time.Second)
-	r.rules = make([]*RuleItemComiled, 0, 256)
-	r.mode = RuleModeAll
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state.Store(newRuleState(&model.Rule{Model: RuleModeAll}, "", nil, nil))
+}
+
+func (r *RuleService) current() *ruleState {
+	return r.state.Load().(*ruleState)
+}
+
+// Version return the version of rules in use, empty before rules loaded
+func (r *RuleService) Version() string {
+	return r.current().version
+}
+
+// SetUserPolicy set the policy of user at port, empty policy only use the rules of node
+func (r *RuleService) SetUserPolicy(port int, policy string) {
+	r.userLock.Lock()
+	defer r.userLock.Unlock()
+	if r.userPolicies == nil {
+		r.userPolicies = make(map[int]string)
+	}
+	if policy == "" {
+		delete(r.userPolicies, port)
+		return
+	}
+	r.userPolicies[port] = policy
+}
+
+func (r *RuleService) userPolicy(port int) string {
+	r.userLock.RLock()
+	defer r.userLock.RUnlock()
+	return r.userPolicies[port]
 }
 
 func (r *RuleService) LoadFromApi() error {
@@ -60,52 +181,142 @@ func (r *RuleService) LoadFromApi() error {
 	return nil
 }
 
-// Load RuleService load rule
+// Load RuleService load rule, the compiled rules replace the old ones at once.
+// it does nothing when the version of rule is not changed
 func (r *RuleService) Load(rule *model.Rule) {
-	r.Reset()
-	r.mode = rule.Model
-	for _, item := range rule.Rules {
-		switch item.Type {
-		case RuleTypeReg:
-			regexCompiled, err := regexp.Compile(item.Pattern)
-			if err != nil {
-				log.Error("compile regex %s error: %s ", item.Pattern, err.Error())
-				continue
-			}
+	version := RuleVersion(rule)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if version == r.current().version {
+		return
+	}
+	r.state.Store(newRuleState(rule, version, r.geoIP, r.geoSite))
+	log.Info("loaded rule set %s: %+v", version, *rule)
+}
 
-			r.rules = append(r.rules, &RuleItemComiled{
-				RuleItem: item,
-				compile:  regexCompiled,
-			})
-		case RuleTypeIp:
-			r.rules = append(r.rules, &RuleItemComiled{
-				RuleItem: item,
-				compile:  item.Pattern,
-			})
-		case RuleTypeDomain:
-			r.rules = append(r.rules, &RuleItemComiled{
-				RuleItem: item,
-				compile:  item.Pattern,
-			})
+// StartRefresh reload rules from api every interval on the cron of app
+func (r *RuleService) StartRefresh(interval time.Duration) error {
+	if interval <= 0 {
+		return nil
+	}
+	return core.GetApp().Cron().AddFunc(fmt.Sprintf("@every %s", interval), func() {
+		if err := r.LoadFromApi(); err != nil {
+			logrus.Errorf("refresh rule error %s", err)
+		}
+	})
+}
+
+// LoadGeo load the geoip database of mmdb or geoip.dat and the geosite.dat, empty path is skipped.
+// rules are compiled again with the new databases
+func (r *RuleService) LoadGeo(geoIPPath, geoSitePath string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if geoIPPath != "" {
+		geoIP, err := geo.OpenIPDB(geoIPPath)
+		if err != nil {
+			return err
+		}
+		r.geoIP, r.geoIPPath = geoIP, geoIPPath
+	}
+	if geoSitePath != "" {
+		geoSite, err := geo.OpenSiteDB(geoSitePath)
+		if err != nil {
+			return err
+		}
+		r.geoSite, r.geoSitePath = geoSite, geoSitePath
+	}
+	state := r.current()
+	r.state.Store(newRuleState(state.rule, state.version, r.geoIP, r.geoSite))
+	return nil
+}
+
+// WatchGeo reload the geo databases loaded by LoadGeo when their files change
+func (r *RuleService) WatchGeo() error {
+	// paths are the database files to watch, value is true for geoip
+	paths := make(map[string]bool)
+	r.lock.Lock()
+	if r.geoIPPath != "" {
+		paths[filepath.Clean(r.geoIPPath)] = true
+	}
+	if r.geoSitePath != "" {
+		paths[filepath.Clean(r.geoSitePath)] = false
+	}
+	r.lock.Unlock()
+	if len(paths) == 0 {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for path := range paths {
+		// watch the directory, because the database is usually replaced by rename
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			return err
 		}
 	}
-	log.Info("loaded rule set: %+v", *rule)
+	go func() {
+		timers := make(map[string]*time.Timer)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				path := filepath.Clean(event.Name)
+				isGeoIP, ok := paths[path]
+				if !ok || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				if timers[path] != nil {
+					timers[path].Stop()
+				}
+				geoIPPath, geoSitePath := "", path
+				if isGeoIP {
+					geoIPPath, geoSitePath = path, ""
+				}
+				timers[path] = time.AfterFunc(geoWatchDelay, func() {
+					if err := r.LoadGeo(geoIPPath, geoSitePath); err != nil {
+						logrus.WithFields(logrus.Fields{
+							"path": path,
+							"err":  err,
+						}).Error("reload geo database error")
+						return
+					}
+					logrus.WithFields(logrus.Fields{
+						"path": path,
+					}).Info("geo database reloaded")
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("watch geo database error %s", err)
+			}
+		}
+	}()
+	return nil
 }
 
-func (r *RuleService) JudgeHostWithReport(ipOrDomain string, port int) bool {
-	ruleId, result, isFromCache := r.judgeWithCache(ipOrDomain, port)
+func (r *RuleService) JudgeHostWithReport(target core.Target, uid int) bool {
+	ruleId, result, isFromCache := r.judgeWithCache(target, uid)
+	if !result {
+		metrics.RuleTrigger(ruleId)
+	}
 
 	if isFromCache {
 		return result
 	}
 
-	uid := GetSSRManager().PortToUid(port)
+	uid = GetSSRManager().PortToUid(uid)
 	if !result {
 		go func() {
 			err := client.PostTrigger(model.Trigger{
 				Uid:    uid,
 				RuleId: ruleId,
-				Reason: ipOrDomain,
+				Reason: target.Host,
+				Type:   model.TriggerTypeRule,
 			})
 			if err != nil {
 				log.Err(err)
@@ -115,10 +326,12 @@ func (r *RuleService) JudgeHostWithReport(ipOrDomain string, port int) bool {
 	return result
 }
 
-// add cache because this function has a lot invoke
-func (r *RuleService) judgeWithCache(ipOrDomain string, port int) (ruleId int, result bool, isFromCache bool) {
-	cacheKey := fmt.Sprintf("%s:%v", ipOrDomain, port)
-	value, isFromCache := r.cache.Get(cacheKey).(struct {
+// add cache because this function has a lot invoke, users of the same policy share the result
+func (r *RuleService) judgeWithCache(target core.Target, uid int) (ruleId int, result bool, isFromCache bool) {
+	policy := r.userPolicy(uid)
+	state := r.current()
+	cacheKey := fmt.Sprintf("%s|%s:%v:%s:%s:%s", policy, target.Host, target.Port, target.Network, target.Protocol, target.SniffHost)
+	value, isFromCache := state.cache.Get(cacheKey).(struct {
 		RuleId int
 		Result bool
 	})
@@ -127,9 +340,9 @@ func (r *RuleService) judgeWithCache(ipOrDomain string, port int) (ruleId int, r
 		return value.RuleId, value.Result, isFromCache
 	}
 
-	ruleId, result = r.judge(ipOrDomain)
+	ruleId, result = state.judge(target, policy)
 
-	r.cache.Put(cacheKey, struct {
+	state.cache.Put(cacheKey, struct {
 		RuleId int
 		Result bool
 	}{
@@ -139,44 +352,325 @@ func (r *RuleService) judgeWithCache(ipOrDomain string, port int) (ruleId int, r
 	return ruleId, result, isFromCache
 }
 
-func (r *RuleService) judge(host string) (int, bool) {
-	// check if cache have value then return cache value
-	if r.mode == RuleModeAll {
+// NeedSniff implement core.HostFirewall, the first payload is sniffed only when the rules
+// of node or user policy match domain or protocol
+func (r *RuleService) NeedSniff(uid int) bool {
+	return r.current().needSniff(r.userPolicy(uid))
+}
+
+func (s *ruleState) needSniff(policy string) bool {
+	if s.mode != RuleModeAll && s.rules.sniffRules {
+		return true
+	}
+	item, ok := s.policies[policy]
+	return ok && item.mode != RuleModeAll && item.rules.sniffRules
+}
+
+// judge the target with rules of node, the target allowed by node is judged with rules of policy
+func (s *ruleState) judge(target core.Target, policy string) (int, bool) {
+	ruleId, result := judgeRules(s.mode, s.rules, target)
+	if !result {
+		return ruleId, result
+	}
+	if item, ok := s.policies[policy]; ok {
+		return judgeRules(item.mode, item.rules, target)
+	}
+	return ruleId, result
+}
+
+func judgeRules(mode string, rules *ruleSet, target core.Target) (int, bool) {
+	if mode == RuleModeAll {
 		return 0, true
 	}
 
-	for _, regexItem := range r.rules {
-		switch regexItem.Type {
-		case RuleTypeReg:
-			regexCompiled, ok := regexItem.compile.(*regexp.Regexp)
-			if !ok {
-				log.Error("regex %s break", regexItem.Pattern)
+	if item, ok := rules.match(target); ok {
+		if mode == RuleModeAllow {
+			return 0, true
+		}
+		if mode == RuleModeReject {
+			return item.Id, false
+		}
+	}
+
+	if mode == RuleModeReject {
+		return 0, true
+	}
+	return 0, false
+}
+
+// ruleSet is the compiled rule items, items are indexed by type so that judge does not scan
+// all of them. when several items match, the earliest one in rule list is returned
+type ruleSet struct {
+	items []model.RuleItem
+	// exact is the ip and domain items
+	exact      map[string]int
+	cidrs      *matcher.CIDRTree
+	suffixes   *matcher.DomainTrie
+	keywords   []ruleValue
+	regs       []ruleReg
+	ports      map[int]int
+	portRanges []rulePortRange
+	networks   map[string]int
+	protocols  map[string]int
+	geoIP      geo.IPDB
+	geoSite    *geo.SiteDB
+	geoIPCodes []ruleValue
+	// ipRules is true when there are cidr or geoip items, the domain is resolved to judge them.
+	// ip items keep matching the literal ip of target only
+	ipRules bool
+	// sniffRules is true when there are domain or protocol items, they match the sniffed result
+	sniffRules bool
+}
+
+type ruleReg struct {
+	index int
+	*regexp.Regexp
+}
+
+type ruleValue struct {
+	index int
+	value string
+}
+
+type rulePortRange struct {
+	index    int
+	from, to int
+}
+
+// newRuleSet compile the rule items, the invalid items are skipped
+func newRuleSet(items []model.RuleItem, geoIP geo.IPDB, geoSite *geo.SiteDB) *ruleSet {
+	s := &ruleSet{
+		items:     items,
+		geoIP:     geoIP,
+		geoSite:   geoSite,
+		exact:     make(map[string]int),
+		cidrs:     matcher.NewCIDRTree(),
+		suffixes:  matcher.NewDomainTrie(),
+		ports:     make(map[int]int),
+		networks:  make(map[string]int),
+		protocols: make(map[string]int),
+	}
+	for index, item := range items {
+		if err := s.add(index, item); err != nil {
+			log.Error("compile rule %v %s %s error: %s ", item.Id, item.Type, item.Pattern, err.Error())
+			continue
+		}
+		switch item.Type {
+		case RuleTypeReg, RuleTypeDomain, RuleTypeDomainSuffix, RuleTypeDomainKeyword, RuleTypeGeoSite, RuleTypeProtocol:
+			s.sniffRules = true
+		}
+	}
+	return s
+}
+
+func (s *ruleSet) add(index int, item model.RuleItem) error {
+	pattern := strings.TrimSpace(item.Pattern)
+	switch item.Type {
+	case RuleTypeReg:
+		regexCompiled, err := regexp.Compile(item.Pattern)
+		if err != nil {
+			return err
+		}
+		s.regs = append(s.regs, ruleReg{index: index, Regexp: regexCompiled})
+	case RuleTypeIp:
+		addIndex(s.exact, item.Pattern, index)
+	case RuleTypeDomain:
+		addIndex(s.exact, item.Pattern, index)
+	case RuleTypeCIDR:
+		ipNet, err := matcher.ParseCIDR(pattern)
+		if err != nil {
+			return err
+		}
+		s.cidrs.Insert(ipNet, index)
+		s.ipRules = true
+	case RuleTypeDomainSuffix:
+		s.suffixes.Insert(pattern, index)
+	case RuleTypeDomainKeyword:
+		if pattern == "" {
+			return fmt.Errorf("empty keyword")
+		}
+		s.keywords = append(s.keywords, ruleValue{index: index, value: strings.ToLower(pattern)})
+	case RuleTypeGeoIP:
+		if s.geoIP == nil {
+			return fmt.Errorf("geoip database is not loaded")
+		}
+		code := strings.ToLower(strings.TrimPrefix(pattern, "geoip:"))
+		s.geoIPCodes = append(s.geoIPCodes, ruleValue{index: index, value: code})
+		s.ipRules = true
+	case RuleTypeGeoSite:
+		if s.geoSite == nil {
+			return fmt.Errorf("geosite database is not loaded")
+		}
+		domains, err := s.geoSite.Domains(strings.TrimPrefix(pattern, "geosite:"))
+		if err != nil {
+			return err
+		}
+		s.addDomains(index, domains)
+	case RuleTypePort:
+		port, err := parseRulePort(pattern)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.ports[port]; !ok {
+			s.ports[port] = index
+		}
+	case RuleTypePortRange:
+		parts := strings.SplitN(pattern, "-", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("port range should be from-to")
+		}
+		from, err := parseRulePort(parts[0])
+		if err != nil {
+			return err
+		}
+		to, err := parseRulePort(parts[1])
+		if err != nil {
+			return err
+		}
+		if from > to {
+			return fmt.Errorf("port range from is greater than to")
+		}
+		s.portRanges = append(s.portRanges, rulePortRange{index: index, from: from, to: to})
+	case RuleTypeNetwork:
+		network := strings.ToLower(pattern)
+		if network != "tcp" && network != "udp" {
+			return fmt.Errorf("network should be tcp or udp")
+		}
+		addIndex(s.networks, network, index)
+	case RuleTypeProtocol:
+		if pattern == "" {
+			return fmt.Errorf("empty protocol")
+		}
+		addIndex(s.protocols, strings.ToLower(pattern), index)
+	default:
+		return fmt.Errorf("unknown rule type")
+	}
+	return nil
+}
+
+// addDomains add the domains of geosite as the item at index
+func (s *ruleSet) addDomains(index int, domains []geo.Domain) {
+	for _, domain := range domains {
+		switch domain.Type {
+		case geo.DomainFull:
+			addIndex(s.exact, strings.ToLower(domain.Value), index)
+		case geo.DomainRoot:
+			s.suffixes.Insert(domain.Value, index)
+		case geo.DomainPlain:
+			s.keywords = append(s.keywords, ruleValue{index: index, value: strings.ToLower(domain.Value)})
+		case geo.DomainRegex:
+			regexCompiled, err := regexp.Compile(domain.Value)
+			if err != nil {
+				log.Error("compile geosite regex %s error: %s ", domain.Value, err.Error())
 				continue
 			}
+			s.regs = append(s.regs, ruleReg{index: index, Regexp: regexCompiled})
+		}
+	}
+}
 
-			if r.mode == RuleModeAllow && regexCompiled.Match([]byte(host)) {
-				return 0, true
-			}
+func addIndex(m map[string]int, key string, index int) {
+	if _, ok := m[key]; !ok {
+		m[key] = index
+	}
+}
 
-			if r.mode == RuleModeReject && regexCompiled.Match([]byte(host)) {
-				return regexItem.Id, false
-			}
+func parseRulePort(pattern string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(pattern))
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %s", pattern)
+	}
+	return port, nil
+}
 
-		case RuleTypeDomain, RuleTypeIp:
-			if r.mode == RuleModeAllow && regexItem.Pattern == host {
-				return 0, true
-			}
+// match return the earliest rule item which target matches, the host rules are matched
+// with both the destination and the sniffed host
+func (s *ruleSet) match(target core.Target) (model.RuleItem, bool) {
+	best := -1
+	found := func(index int, ok bool) {
+		if ok && (best == -1 || index < best) {
+			best = index
+		}
+	}
+	s.matchHost(target.Host, true, found)
+	if target.SniffHost != "" && target.SniffHost != target.Host {
+		// the destination ip is matched already, so sniffed host is not resolved
+		s.matchHost(target.SniffHost, false, found)
+	}
+	index, ok := s.ports[target.Port]
+	found(index, ok)
+	for _, portRange := range s.portRanges {
+		if target.Port >= portRange.from && target.Port <= portRange.to {
+			found(portRange.index, true)
+			break
+		}
+	}
+	index, ok = s.networks[target.Network]
+	found(index, ok)
+	if target.Protocol != "" {
+		index, ok = s.protocols[target.Protocol]
+		found(index, ok)
+	}
+	if best == -1 {
+		return model.RuleItem{}, false
+	}
+	return s.items[best], true
+}
 
-			if r.mode == RuleModeReject && regexItem.Pattern == host {
-				return regexItem.Id, false
+// matchHost match ip or domain with the host rules, domain is resolved for cidr and geoip rules when resolve is true
+func (s *ruleSet) matchHost(host string, resolve bool, found func(int, bool)) {
+	index, ok := s.exact[host]
+	found(index, ok)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		found(s.suffixes.Lookup(host))
+		lower := strings.ToLower(host)
+		for _, keyword := range s.keywords {
+			if strings.Contains(lower, keyword.value) {
+				found(keyword.index, true)
+				break
 			}
-		default:
-			continue
 		}
 	}
+	if s.ipRules && (ip != nil || resolve) {
+		ips := []net.IP{ip}
+		if ip == nil {
+			ips = lookupIP(host)
+		}
+		for _, ip := range ips {
+			s.matchIP(ip, found)
+		}
+	}
+	for _, reg := range s.regs {
+		if reg.MatchString(host) {
+			found(reg.index, true)
+			break
+		}
+	}
+}
 
-	if r.mode == RuleModeReject {
-		return 0, true
+// matchIP match ip with cidr and geoip items
+func (s *ruleSet) matchIP(ip net.IP, found func(int, bool)) {
+	found(s.cidrs.Lookup(ip))
+	for _, code := range s.geoIPCodes {
+		if s.geoIP.Contains(code.value, ip) {
+			found(code.index, true)
+			break
+		}
 	}
-	return 0, false
+}
+
+// lookupIP resolve the domain of target, cidr and geoip rules are judged with its ips
+var lookupIP = func(host string) []net.IP {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips
 }
@@ -3,9 +3,13 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/ProxyPanel/VNet-SSR/common/geo"
+	"github.com/ProxyPanel/VNet-SSR/core"
 	"github.com/ProxyPanel/VNet-SSR/model"
 	"github.com/tidwall/gjson"
+	"net"
 	"regexp"
+	"sync"
 	"testing"
 )
 
@@ -68,15 +72,15 @@ func TestRuleServiceBlackList(t *testing.T) {
 		t.Fatal(err)
 	}
 	GetRuleService().Load(rule)
-	if _, ok, _ := GetRuleService().judgeWithCache("ntdtv.com",0); ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "ntdtv.com"}, 0); ok {
 		t.Fatal("ntd.tv test fail")
 	}
 
-	if _, ok, _ := GetRuleService().judgeWithCache("baidu.com",0); ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "baidu.com"}, 0); ok {
 		t.Fatal("baidu.com test fail")
 	}
 
-	if _, ok, _ := GetRuleService().judgeWithCache("192.168.1.1",0); !ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "192.168.1.1"}, 0); !ok {
 		t.Fatal("192.168.1.1 test fail")
 	}
 }
@@ -124,19 +128,19 @@ func TestRuleServiceWhiteList(t *testing.T) {
 		t.Fatal(err)
 	}
 	GetRuleService().Load(rule)
-	if _, ok, _ := GetRuleService().judgeWithCache("ntdtv.com",0); !ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "ntdtv.com"}, 0); !ok {
 		t.Fatal("ntd.tv test fail")
 	}
 
-	if _, ok, _ := GetRuleService().judgeWithCache("baidu.com",0); !ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "baidu.com"}, 0); !ok {
 		t.Fatal("baidu.com test fail")
 	}
 
-	if _, ok, _ := GetRuleService().judgeWithCache("192.168.1.1",0); !ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "192.168.1.1"}, 0); !ok {
 		t.Fatal("192.168.1.1 test fail")
 	}
 
-	if _, ok, _ := GetRuleService().judgeWithCache("google.com",0); ok {
+	if _, ok, _ := GetRuleService().judgeWithCache(core.Target{Host: "google.com"}, 0); ok {
 		t.Fatal("google.com test fail")
 	}
 }
@@ -185,18 +189,255 @@ func TestJudgeCache(t *testing.T){
 	}
 	GetRuleService().Load(rule)
 
-	_, ok, isCache := GetRuleService().judgeWithCache("ntdtv.com",0)
+	_, ok, isCache := GetRuleService().judgeWithCache(core.Target{Host: "ntdtv.com"}, 0)
 	if !ok && !isCache {
 		t.Fatal("ntd.tv cache test fail")
 	}
 
-	_, ok, isCache = GetRuleService().judgeWithCache("ntdtv.com",0)
+	_, ok, isCache = GetRuleService().judgeWithCache(core.Target{Host: "ntdtv.com"}, 0)
 	if !ok && isCache {
 		t.Fatal("ntd.tv  cache test fail")
 	}
 
-	_, ok, isCache = GetRuleService().judgeWithCache("ntdtv.com",1)
+	_, ok, isCache = GetRuleService().judgeWithCache(core.Target{Host: "ntdtv.com"}, 1)
 	if !ok && !isCache {
 		t.Fatal("ntd.tv  cache test fail")
 	}
 }
+
+func TestRuleSetMatch(t *testing.T) {
+	rules := newRuleSet([]model.RuleItem{
+		{Id: 1, Type: RuleTypeCIDR, Pattern: "10.0.0.0/8"},
+		{Id: 2, Type: RuleTypeCIDR, Pattern: "2001:db8::/32"},
+		{Id: 3, Type: RuleTypeDomainSuffix, Pattern: "example.com"},
+		{Id: 4, Type: RuleTypeDomainKeyword, Pattern: "Torrent"},
+		{Id: 5, Type: RuleTypePort, Pattern: "25"},
+		{Id: 6, Type: RuleTypePortRange, Pattern: "6881-6889"},
+		{Id: 7, Type: RuleTypeNetwork, Pattern: "udp"},
+		{Id: 8, Type: RuleTypeDomain, Pattern: "www.example.com"},
+		{Id: 9, Type: RuleTypePortRange, Pattern: "9-1"},
+		{Id: 10, Type: RuleTypeCIDR, Pattern: "bad"},
+		{Id: 11, Type: RuleTypeProtocol, Pattern: "bittorrent"},
+		{Id: 12, Type: RuleTypeDomainSuffix, Pattern: "blocked.org"},
+	}, nil, nil)
+	for _, item := range []struct {
+		target core.Target
+		id     int
+	}{
+		{core.Target{Host: "10.1.2.3", Port: 80, Network: "tcp"}, 1},
+		{core.Target{Host: "2001:db8::1", Port: 80, Network: "tcp"}, 2},
+		{core.Target{Host: "a.Example.com", Port: 80, Network: "tcp"}, 3},
+		{core.Target{Host: "www.example.com", Port: 80, Network: "tcp"}, 3},
+		{core.Target{Host: "badexample.com", Port: 80, Network: "tcp"}, 0},
+		{core.Target{Host: "mytorrents.org", Port: 80, Network: "tcp"}, 4},
+		{core.Target{Host: "mail.org", Port: 25, Network: "tcp"}, 5},
+		{core.Target{Host: "peer.org", Port: 6885, Network: "tcp"}, 6},
+		{core.Target{Host: "dns.org", Port: 53, Network: "udp"}, 7},
+		{core.Target{Host: "11.0.0.1", Port: 5, Network: "tcp"}, 0},
+		{core.Target{Host: "11.0.0.1", Port: 5, Network: "tcp", Protocol: "bittorrent"}, 11},
+		{core.Target{Host: "11.0.0.1", Port: 443, Network: "tcp", Protocol: "tls", SniffHost: "www.blocked.org"}, 12},
+		{core.Target{Host: "11.0.0.1", Port: 443, Network: "tcp", Protocol: "tls", SniffHost: "www.example.org"}, 0},
+	} {
+		rule, ok := rules.match(item.target)
+		if item.id == 0 && ok || item.id != 0 && rule.Id != item.id {
+			t.Fatalf("match %+v = %v %v, want %v", item.target, rule.Id, ok, item.id)
+		}
+	}
+}
+
+func TestRuleServiceTargetCache(t *testing.T) {
+	ruleService := NewRuleService()
+	ruleService.Load(&model.Rule{
+		Model: RuleModeReject,
+		Rules: []model.RuleItem{{Id: 1, Type: RuleTypePort, Pattern: "25"}},
+	})
+	if _, ok, _ := ruleService.judgeWithCache(core.Target{Host: "mail.org", Port: 25, Network: "tcp"}, 1); ok {
+		t.Fatal("port 25 is allowed")
+	}
+	if _, ok, _ := ruleService.judgeWithCache(core.Target{Host: "mail.org", Port: 587, Network: "tcp"}, 1); !ok {
+		t.Fatal("result of other port is cached")
+	}
+}
+
+// countryDB is a geoip database of ip to country
+type countryDB map[string]string
+
+func (db countryDB) Contains(code string, ip net.IP) bool {
+	return db[ip.String()] == code
+}
+
+func TestRuleSetMatchGeo(t *testing.T) {
+	defer func(lookup func(string) []net.IP) { lookupIP = lookup }(lookupIP)
+	lookupIP = func(host string) []net.IP {
+		if host == "foreign.org" {
+			return []net.IP{net.ParseIP("1.1.1.1")}
+		}
+		return nil
+	}
+	geoIP := countryDB{"1.1.1.1": "au"}
+	rules := newRuleSet([]model.RuleItem{
+		{Id: 1, Type: RuleTypeGeoIP, Pattern: "geoip:AU"},
+		{Id: 2, Type: RuleTypeGeoSite, Pattern: "category-ads"},
+	}, geoIP, nil)
+	if len(rules.geoIPCodes) != 1 {
+		t.Fatal("geoip rule is not compiled")
+	}
+	// geosite database is not loaded, add the domains of category-ads
+	rules.addDomains(1, []geo.Domain{
+		{Type: geo.DomainRoot, Value: "ads.com"},
+		{Type: geo.DomainFull, Value: "ad.cn"},
+		{Type: geo.DomainPlain, Value: "adserver"},
+		{Type: geo.DomainRegex, Value: "^ad[0-9]+\\."},
+	})
+	for host, id := range map[string]int{
+		"1.1.1.1":          1,
+		"foreign.org":      1,
+		"8.8.8.8":          0,
+		"x.ads.com":        2,
+		"ad.cn":            2,
+		"www.ad.cn":        0,
+		"my-adserver.net":  2,
+		"ad12.example.org": 2,
+		"example.org":      0,
+	} {
+		rule, ok := rules.match(core.Target{Host: host, Port: 443, Network: "tcp"})
+		if id == 0 && ok || id != 0 && rule.Id != id {
+			t.Fatalf("match %v = %v %v, want %v", host, rule.Id, ok, id)
+		}
+	}
+}
+
+func TestRuleServicePolicy(t *testing.T) {
+	ruleService := NewRuleService()
+	ruleService.Load(&model.Rule{
+		Model: RuleModeReject,
+		Rules: []model.RuleItem{{Id: 1, Type: RuleTypePort, Pattern: "25"}},
+		Policies: map[string]model.RulePolicy{
+			"kids": {
+				Model: RuleModeReject,
+				Rules: []model.RuleItem{{Id: 2, Type: RuleTypeDomainSuffix, Pattern: "games.com"}},
+			},
+			"business": {Model: RuleModeAll},
+		},
+	})
+	ruleService.SetUserPolicy(10001, "kids")
+	ruleService.SetUserPolicy(10002, "business")
+	games := core.Target{Host: "www.games.com", Port: 443, Network: "tcp"}
+	mail := core.Target{Host: "mail.org", Port: 25, Network: "tcp"}
+
+	if ruleId, ok, _ := ruleService.judgeWithCache(games, 10001); ok || ruleId != 2 {
+		t.Fatalf("kids policy = %v %v, want rejected by 2", ruleId, ok)
+	}
+	if _, ok, _ := ruleService.judgeWithCache(games, 10002); !ok {
+		t.Fatal("business policy is rejected")
+	}
+	if _, ok, _ := ruleService.judgeWithCache(games, 10003); !ok {
+		t.Fatal("user without policy is rejected")
+	}
+	// node rules are the base of all policies
+	if ruleId, ok, _ := ruleService.judgeWithCache(mail, 10002); ok || ruleId != 1 {
+		t.Fatalf("business policy = %v %v, want rejected by node rule 1", ruleId, ok)
+	}
+
+	// users of the same policy share the cache
+	ruleService.SetUserPolicy(10004, "kids")
+	if _, ok, isFromCache := ruleService.judgeWithCache(games, 10004); ok || !isFromCache {
+		t.Fatalf("result of kids policy = %v, from cache %v", ok, isFromCache)
+	}
+	ruleService.SetUserPolicy(10004, "")
+	if _, ok, _ := ruleService.judgeWithCache(games, 10004); !ok {
+		t.Fatal("user policy is not removed")
+	}
+
+	// only the domain rules of kids policy use the sniffed host
+	if !ruleService.NeedSniff(10001) || ruleService.NeedSniff(10002) || ruleService.NeedSniff(10003) {
+		t.Fatal("only kids policy need sniff")
+	}
+	ruleService.Load(&model.Rule{Model: RuleModeAll, Rules: []model.RuleItem{{Id: 3, Type: RuleTypeProtocol, Pattern: "bittorrent"}}})
+	if ruleService.NeedSniff(10003) {
+		t.Fatal("rules of all mode need sniff")
+	}
+	ruleService.Load(&model.Rule{Model: RuleModeReject, Rules: []model.RuleItem{{Id: 3, Type: RuleTypeProtocol, Pattern: "bittorrent"}}})
+	if !ruleService.NeedSniff(10003) {
+		t.Fatal("protocol rules don't need sniff")
+	}
+}
+
+func TestRuleServiceLoadSwap(t *testing.T) {
+	ruleService := NewRuleService()
+	if ruleService.Version() != "" {
+		t.Fatalf("version before load = %s", ruleService.Version())
+	}
+	reject := &model.Rule{
+		Model: RuleModeReject,
+		Rules: []model.RuleItem{{Id: 1, Type: RuleTypePort, Pattern: "25"}},
+	}
+	allow := &model.Rule{
+		Model: RuleModeAllow,
+		Rules: []model.RuleItem{{Id: 1, Type: RuleTypePort, Pattern: "25"}},
+	}
+	target := core.Target{Host: "mail.org", Port: 25, Network: "tcp"}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				ruleService.judgeWithCache(target, 10001)
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		ruleService.Load(reject)
+		ruleService.Load(allow)
+	}
+	close(stop)
+	wg.Wait()
+
+	ruleService.Load(reject)
+	version := ruleService.Version()
+	if version == "" || version != RuleVersion(reject) {
+		t.Fatalf("version = %s, want %s", version, RuleVersion(reject))
+	}
+	if RuleVersion(allow) == version {
+		t.Fatal("different rules have the same version")
+	}
+	if _, ok, _ := ruleService.judgeWithCache(target, 10001); ok {
+		t.Fatal("target is not rejected")
+	}
+	// loading the same rules keep the compiled rules and the cache
+	ruleService.Load(&model.Rule{
+		Model: RuleModeReject,
+		Rules: []model.RuleItem{{Id: 1, Type: RuleTypePort, Pattern: "25"}},
+	})
+	if _, _, isFromCache := ruleService.judgeWithCache(target, 10001); !isFromCache {
+		t.Fatal("cache is reset by the same rules")
+	}
+}
+
+func TestRuleSetIpNotResolved(t *testing.T) {
+	defer func(lookup func(string) []net.IP) { lookupIP = lookup }(lookupIP)
+	lookups := 0
+	lookupIP = func(host string) []net.IP {
+		lookups++
+		return []net.IP{net.ParseIP("1.1.1.1")}
+	}
+	rules := newRuleSet([]model.RuleItem{{Id: 1, Type: RuleTypeIp, Pattern: "1.1.1.1"}}, nil, nil)
+	if rule, ok := rules.match(core.Target{Host: "1.1.1.1", Port: 443, Network: "tcp"}); !ok || rule.Id != 1 {
+		t.Fatalf("match ip = %v %v", rule.Id, ok)
+	}
+	// ip items only match the literal ip, domain of the same ip is not resolved
+	if rule, ok := rules.match(core.Target{Host: "one.one", Port: 443, Network: "tcp"}); ok || lookups != 0 {
+		t.Fatalf("match domain = %v %v, lookups %v", rule.Id, ok, lookups)
+	}
+
+	rules = newRuleSet([]model.RuleItem{{Id: 2, Type: RuleTypeCIDR, Pattern: "1.1.1.0/24"}}, nil, nil)
+	if rule, ok := rules.match(core.Target{Host: "one.one", Port: 443, Network: "tcp"}); !ok || rule.Id != 2 || lookups != 1 {
+		t.Fatalf("match domain with cidr = %v %v, lookups %v", rule.Id, ok, lookups)
+	}
+}
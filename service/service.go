@@ -1,5 +1,10 @@
 package service
 
+import (
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
 func Start() (err error) {
 	if err = GetSSRManager().Start(); err != nil {
 		return err
@@ -21,3 +26,17 @@ func Reload() error {
 	}
 	return nil
 }
+
+// ReloadNode apply the new node info and keep the untouched listeners
+func ReloadNode(nodeInfo *model.NodeInfo) error {
+	before := core.GetApp().NodeInfo()
+	if err := GetSSRManager().ReloadNode(nodeInfo); err != nil {
+		return err
+	}
+	// protocol service is swapped after listeners are reloaded, so it always matches them
+	SetObfsProtocolService(before, nodeInfo)
+	if err := GetRuleService().LoadFromApi(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/ProxyPanel/VNet-SSR/proxy/server"
+	"github.com/ProxyPanel/VNet-SSR/utils/addrx"
+	"github.com/pkg/errors"
+)
+
+// SessionFilter select the sessions, zero fields match all
+type SessionFilter struct {
+	Uid  int
+	Port int
+	// IP match the ip of client or destination
+	IP string
+}
+
+func (f *SessionFilter) match(session *server.Session) bool {
+	if f.Port != 0 && session.Port != f.Port {
+		return false
+	}
+	return f.IP == "" || addrx.SplitHostFromAddr(session.Client) == f.IP || addrx.SplitHostFromAddr(session.Target) == f.IP
+}
+
+// Sessions return the established tcp connections and udp nat entries of all servers including
+// draining ones in start order
+func (s *SSRManager) Sessions(filter SessionFilter) []server.Session {
+	s.userTableLock.Lock()
+	defer s.userTableLock.Unlock()
+	result := make([]server.Session, 0)
+	if filter.Uid != 0 {
+		port := s.uidToPortLocked(filter.Uid)
+		if port == 0 || (filter.Port != 0 && filter.Port != port) {
+			return result
+		}
+		filter.Port = port
+	}
+	for _, ssr := range s.serversLocked() {
+		for _, session := range ssr.Sessions(filter.match) {
+			session.Uid = s.portToUidLocked(session.Port)
+			result = append(result, session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// KickUser close the sessions of user and return the count of them, the user can connect again
+func (s *SSRManager) KickUser(uid int) (int, error) {
+	s.userTableLock.Lock()
+	defer s.userTableLock.Unlock()
+	port := s.uidToPortLocked(uid)
+	if port == 0 {
+		return 0, errors.Errorf("uid %v is not exist", uid)
+	}
+	return s.closeUserLocked(port), nil
+}
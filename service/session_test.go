@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+func TestSSRManager_KickUser(t *testing.T) {
+	core.GetApp().SetHost("127.0.0.1")
+	core.GetApp().SetNodeInfo(&model.NodeInfo{
+		Method:   "aes-256-cfb",
+		Protocol: "origin",
+		Obfs:     "plain",
+	})
+	manager := NewShadowsocksrService()
+	port := freePort(t)
+	if err := manager.AddUser(&model.UserInfo{Uid: 1, Port: port, Passwd: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.DelUser(1)
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; len(manager.Sessions(SessionFilter{Uid: 1})) == 0; i++ {
+			if i > 100 {
+				t.Fatal("session is not registered")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return conn
+	}
+	closed := func(conn net.Conn) bool {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		netErr, ok := err.(net.Error)
+		return err != nil && !(ok && netErr.Timeout())
+	}
+
+	conn := dial()
+	defer conn.Close()
+	sessions := manager.Sessions(SessionFilter{IP: "127.0.0.1"})
+	if len(sessions) != 1 || sessions[0].Uid != 1 || sessions[0].Port != port || sessions[0].Network != "tcp" {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	if sessions := manager.Sessions(SessionFilter{IP: "10.0.0.1"}); len(sessions) != 0 {
+		t.Fatalf("sessions of other ip = %+v", sessions)
+	}
+	if sessions := manager.Sessions(SessionFilter{Uid: 2}); len(sessions) != 0 {
+		t.Fatalf("sessions of unknown uid = %+v", sessions)
+	}
+
+	if _, err := manager.KickUser(2); err == nil {
+		t.Fatal("kick unknown uid without error")
+	}
+	if count, err := manager.KickUser(1); err != nil || count != 1 {
+		t.Fatalf("kick user = %v %v, want 1 session", count, err)
+	}
+	if !closed(conn) {
+		t.Fatal("connection is not closed by kick")
+	}
+
+	// the user is kept after kick, deleting it close its sessions too
+	conn = dial()
+	defer conn.Close()
+	if err := manager.DelUser(1); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(conn) {
+		t.Fatal("connection is not closed by deleting user")
+	}
+}
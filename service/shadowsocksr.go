@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/common/audit"
 	"github.com/ProxyPanel/VNet-SSR/common/log"
+	"github.com/ProxyPanel/VNet-SSR/common/metrics"
 	"github.com/ProxyPanel/VNet-SSR/core"
 	"runtime/debug"
 	"strconv"
@@ -31,32 +33,72 @@ func GetSSRManager() *SSRManager {
 }
 
 type AddUserHandle func(*model.UserInfo)
-type DelUserHandle func(int)
+type DelUserHandle func(*model.UserInfo)
 
 func NewShadowsocksrService() *SSRManager {
 	return &SSRManager{
-		Locker:        new(sync.Mutex),
-		Shadowsocksrs: make(map[int]*server.ShadowsocksRProxy),
-		traffic:       make(map[int]*model.UserTraffic),
-		trafficLock:   new(sync.Mutex),
-		online:        make(map[int]*model.NodeOnline),
-		onlineLock:    new(sync.Mutex),
-		userTable:     make(map[int]*model.UserInfo),
-		userTableLock: new(sync.Mutex),
-		UpTime:        time.Now(),
+		Locker:          new(sync.Mutex),
+		Shadowsocksrs:   make(map[int]*server.ShadowsocksRProxy),
+		draining:        make(map[*server.ShadowsocksRProxy]bool),
+		traffic:         make(map[int]*model.UserTraffic),
+		trafficLock:     new(sync.Mutex),
+		speeds:          make(map[int]*speedMeter),
+		speedStart:      time.Now(),
+		delta:           make(map[int]*model.UserTraffic),
+		journalNotify:   make(chan struct{}, 1),
+		online:          make(map[int]*model.NodeOnline),
+		onlineLock:      new(sync.Mutex),
+		userTable:       make(map[int]*model.UserInfo),
+		userTableLock:   new(sync.Mutex),
+		quotas:          make(map[int]*userQuota),
+		restored:        make(map[int]int64),
+		quotaLock:       new(sync.Mutex),
+		ipLimit:         newIPLimit(),
+		IPWindow:        defaultIPWindow,
+		ReportInterval:  60 * time.Second,
+		ReportThreshold: 50 * 1024,
+		SniffTimeout:    300 * time.Millisecond,
+		UpTime:          time.Now(),
 	}
 }
 
 type SSRManager struct {
 	sync.Locker
-	Shadowsocksrs  map[int]*server.ShadowsocksRProxy
-	traffic        map[int]*model.UserTraffic
-	trafficLock    *sync.Mutex
-	online         map[int]*model.NodeOnline
-	onlineLock     *sync.Mutex
-	userTable      map[int]*model.UserInfo
-	userTableLock  *sync.Mutex
-	UpTime         time.Time
+	Shadowsocksrs map[int]*server.ShadowsocksRProxy
+	traffic       map[int]*model.UserTraffic
+	trafficLock   *sync.Mutex
+	speeds        map[int]*speedMeter
+	speedStart    time.Time
+	// delta is the traffic not appended to journal yet
+	delta         map[int]*model.UserTraffic
+	journal       *trafficJournal
+	journalNotify chan struct{}
+	accessLog     *audit.Logger
+	online        map[int]*model.NodeOnline
+	onlineLock    *sync.Mutex
+	userTable     map[int]*model.UserInfo
+	userTableLock *sync.Mutex
+	quotas        map[int]*userQuota
+	// restored is the traffic restored from journal, it is reported but not counted in quota usage
+	restored  map[int]int64
+	quotaLock *sync.Mutex
+	ipLimit   *ipLimit
+	UpTime    time.Time
+	// SyncInterval is the interval to pull user list from panel, 0 disable it
+	SyncInterval time.Duration
+	// GraceTimeout is how long connections of rebound listeners keep working on node reload
+	GraceTimeout time.Duration
+	// draining is the servers rebound by node reload whose connections are not closed yet,
+	// it is guarded by userTableLock
+	draining map[*server.ShadowsocksRProxy]bool
+	// IPWindow is how long a source ip is counted in ip limit after its last connection
+	IPWindow time.Duration
+	// ReportInterval is the interval to report traffic, online and node status
+	ReportInterval time.Duration
+	// ReportThreshold is the min traffic bytes of user to report, less traffic is carried over
+	ReportThreshold int64
+	// SniffTimeout is the max time to wait the first payload of tcp for sniffing, 0 disable it
+	SniffTimeout   time.Duration
 	addUserHandles []AddUserHandle
 	delUserHanelds []DelUserHandle
 	context.Context
@@ -96,6 +138,7 @@ func (s *SSRManager) PortToUid(port int) int {
 func (s *SSRManager) Upload(port int, n int64) {
 	s.trafficLock.Lock()
 	uid := s.PortToUid(port)
+	metrics.AddUpload(uid, n)
 	if s.traffic[uid] != nil {
 		s.traffic[uid].Upload += n
 	} else {
@@ -104,12 +147,16 @@ func (s *SSRManager) Upload(port int, n int64) {
 		traffic.Uid = uid
 		s.traffic[uid] = traffic
 	}
+	s.speedMeter(uid).add(time.Now(), n, 0)
+	s.addDelta(uid, n, 0)
 	s.trafficLock.Unlock()
+	s.consume(uid, n)
 }
 
 func (s *SSRManager) Download(port int, n int64) {
 	s.trafficLock.Lock()
 	uid := s.PortToUid(port)
+	metrics.AddDownload(uid, n)
 	if s.traffic[uid] != nil {
 		s.traffic[uid].Download += n
 	} else {
@@ -118,22 +165,50 @@ func (s *SSRManager) Download(port int, n int64) {
 		traffic.Uid = uid
 		s.traffic[uid] = traffic
 	}
+	s.speedMeter(uid).add(time.Now(), 0, n)
+	s.addDelta(uid, 0, n)
 	s.trafficLock.Unlock()
+	s.consume(uid, n)
+}
+
+// speedMeter return the speed meter of user in current report interval. caller must hold trafficLock
+func (s *SSRManager) speedMeter(uid int) *speedMeter {
+	meter := s.speeds[uid]
+	if meter == nil {
+		meter = new(speedMeter)
+		s.speeds[uid] = meter
+	}
+	return meter
 }
 
 func (s *SSRManager) ReportTraffic() []*model.UserTraffic {
 	s.trafficLock.Lock()
+	defer s.trafficLock.Unlock()
+	return s.reportTrafficLocked()
+}
+
+// reportTrafficLocked take the traffic to report. caller must hold trafficLock
+func (s *SSRManager) reportTrafficLocked() []*model.UserTraffic {
+	now := time.Now()
+	interval := now.Sub(s.speedStart)
 	reportData := s.traffic
+	speeds := s.speeds
 	s.traffic = make(map[int]*model.UserTraffic)
+	s.speeds = make(map[int]*speedMeter)
+	s.speedStart = now
 	convertReportData := make([]*model.UserTraffic, 0, len(reportData))
 	for key, value := range reportData {
-		if value.Download+value.Upload < 50*1024 {
+		value.UpSpeed, value.DownSpeed, value.UpPeak, value.DownPeak = 0, 0, 0, 0
+		if meter := speeds[key]; meter != nil {
+			value.UpSpeed, value.DownSpeed, value.UpPeak, value.DownPeak = meter.speed(interval)
+		}
+		// traffic under threshold is carried over to next report
+		if value.Download+value.Upload < s.ReportThreshold {
+			s.traffic[key] = value
 			continue
 		}
 		convertReportData = append(convertReportData, value)
-		delete(s.traffic, key)
 	}
-	s.trafficLock.Unlock()
 	return convertReportData
 }
 
@@ -173,11 +248,12 @@ func (s *SSRManager) ReportOnline() []*model.NodeOnline {
 func (s *SSRManager) ReportNodeStatus() model.NodeStatus {
 	up, down := monitor.GetNetwork()
 	return model.NodeStatus{
-		CPU:    fmt.Sprintf("%v%%", monitor.GetCPUUsage()),
-		MEM:    fmt.Sprintf("%v%%", monitor.GetMemUsage()),
-		NET:    fmt.Sprintf("%v↑-%v↓", humanize.Bytes(up), humanize.Bytes(down)),
-		DISK:   fmt.Sprintf("%v%%", monitor.GetDiskUsage()),
-		UPTIME: int(time.Since(s.UpTime).Seconds()),
+		CPU:         fmt.Sprintf("%v%%", monitor.GetCPUUsage()),
+		MEM:         fmt.Sprintf("%v%%", monitor.GetMemUsage()),
+		NET:         fmt.Sprintf("%v↑-%v↓", humanize.Bytes(up), humanize.Bytes(down)),
+		DISK:        fmt.Sprintf("%v%%", monitor.GetDiskUsage()),
+		UPTIME:      int(time.Since(s.UpTime).Seconds()),
+		RuleVersion: GetRuleService().Version(),
 	}
 }
 
@@ -200,6 +276,12 @@ func (s *SSRManager) NewShadowsocksRProxy(port int, method, passwd, protocol, pr
 	shadowsocksRProxy.ILimiter = GetLimitInstance()
 	shadowsocksRProxy.Users = make(map[string]string)
 	shadowsocksRProxy.HostFirewall = GetRuleService()
+	shadowsocksRProxy.UserChecker = s
+	if s.accessLog != nil {
+		shadowsocksRProxy.AccessLog = s
+	}
+	shadowsocksRProxy.SniffTimeout = s.SniffTimeout
+	shadowsocksRProxy.Redirect = core.GetApp().NodeInfo().Redirect
 	if core.GetApp().NodeInfo().IsUDP == 1 {
 		shadowsocksRProxy.UDPSwitch = "true"
 	} else {
@@ -290,6 +372,7 @@ func (s *SSRManager) addUser(user *model.UserInfo) error {
 		}
 	}
 	s.userTable[user.Uid] = user
+	s.setQuotaLocked(user)
 	// deal with all add users handles
 	for _, handle := range s.addUserHandles {
 		handle(user)
@@ -345,6 +428,8 @@ func (s *SSRManager) delUserReturl(uid int) (user *model.UserInfo, err error) {
 			server.DelUser(port)
 			logrus.Infof("server %v del %v success", server.Port, port)
 		}
+		// sessions on draining servers are closed too
+		s.closeUserLocked(port)
 		user = s.userTable[uid]
 		delete(s.userTable, uid)
 	} else {
@@ -359,17 +444,155 @@ func (s *SSRManager) delUserReturl(uid int) (user *model.UserInfo, err error) {
 		if err := server.Close(); err != nil {
 			return nil, err
 		}
+		// closing listener does not close the established sessions
+		s.closeUserLocked(port)
 		user = s.userTable[uid]
 		delete(s.Shadowsocksrs, port)
 		delete(s.userTable, uid)
 	}
+	s.delQuota(uid)
+	s.ipLimit.del(uid)
 	// deal with all add users handles
 	for _, handle := range s.delUserHanelds {
-		handle(uid)
+		handle(user)
 	}
 	return user, nil
 }
 
+// userDiff is the difference between local user table and user list of panel
+type userDiff struct {
+	added   []*model.UserInfo
+	removed []int
+	changed []*model.UserInfo
+	// usage is the users whose quota, used or expire time changed only, used grows on
+	// every pull, so they are updated silently
+	usage []*model.UserInfo
+}
+
+// empty return whether no user is added, removed or changed, usage is not counted
+func (d *userDiff) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+// userChanged return whether the settings of user applied to listeners and checks changed
+func userChanged(before, user *model.UserInfo) bool {
+	return before.Port != user.Port || before.Passwd != user.Passwd || before.Limit != user.Limit ||
+		before.Enable != user.Enable || before.IPLimit != user.IPLimit || before.Policy != user.Policy
+}
+
+// usageChanged return whether the quota or expire time of user changed
+func usageChanged(before, user *model.UserInfo) bool {
+	return before.Quota != user.Quota || before.Used != user.Used || before.ExpireTime != user.ExpireTime
+}
+
+// diffUsers compare user table with the user list, users are matched by uid
+func diffUsers(userTable map[int]*model.UserInfo, users []*model.UserInfo) *userDiff {
+	diff := new(userDiff)
+	latest := make(map[int]*model.UserInfo, len(users))
+	for _, user := range users {
+		latest[user.Uid] = user
+		before := userTable[user.Uid]
+		if before == nil {
+			diff.added = append(diff.added, user)
+		} else if userChanged(before, user) {
+			diff.changed = append(diff.changed, user)
+		} else if usageChanged(before, user) {
+			diff.usage = append(diff.usage, user)
+		}
+	}
+	for uid := range userTable {
+		if latest[uid] == nil {
+			diff.removed = append(diff.removed, uid)
+		}
+	}
+	return diff
+}
+
+// SyncUsers pull user list from panel and only apply the difference, listeners
+// and connections of untouched users are kept
+func (s *SSRManager) SyncUsers() error {
+	users, err := client.GetUserList()
+	if err != nil {
+		return errors.Wrap(err, "sync user list error")
+	}
+	s.userTableLock.Lock()
+	defer s.userTableLock.Unlock()
+	diff := diffUsers(s.userTable, users)
+	for _, user := range diff.usage {
+		s.userTable[user.Uid] = user
+		s.setQuotaLocked(user)
+	}
+	if diff.empty() {
+		return nil
+	}
+	logrus.WithFields(logrus.Fields{
+		"added":   len(diff.added),
+		"removed": len(diff.removed),
+		"changed": len(diff.changed),
+	}).Info("sync user list")
+	var failed []string
+	// remove first, so the ports of removed users can be reused
+	for _, uid := range diff.removed {
+		if _, err := s.delUserReturl(uid); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	for _, user := range diff.changed {
+		if err := s.syncUser(user); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	for _, user := range diff.added {
+		if err := s.addUser(user); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("sync user list error: %s", strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
+// syncUser apply a changed user, the listener is restarted only when port or password changed
+func (s *SSRManager) syncUser(user *model.UserInfo) error {
+	before := s.userTable[user.Uid]
+	if before.Port != user.Port || before.Passwd != user.Passwd {
+		_, err := s.editUserReturn(user)
+		return err
+	}
+	s.userTable[user.Uid] = user
+	s.setQuotaLocked(user)
+	// sessions of disabled user are closed, new ones are rejected by CheckUser
+	if before.Enable != 0 && user.Enable == 0 {
+		s.closeUserLocked(user.Port)
+	}
+	// quota and used change on every sync, they don't need add user handles
+	if before.Limit != user.Limit || before.Enable != user.Enable || before.Policy != user.Policy {
+		for _, handle := range s.addUserHandles {
+			handle(user)
+		}
+	}
+	return nil
+}
+
+// SyncTask pull user list every SyncInterval until service closed
+func (s *SSRManager) SyncTask() {
+	log.Info("SyncTask start")
+	ticker := time.NewTicker(s.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.Context.Done():
+			log.Info("SyncTask close")
+			return
+		case <-ticker.C:
+		}
+		if err := s.SyncUsers(); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
 func (s *SSRManager) GetUserFromPort(port int) *model.UserInfo {
 	for _, value := range s.userTable {
 		if value.Port == port {
@@ -421,7 +644,7 @@ func (s *SSRManager) RegisterDelUserHandle(handle DelUserHandle) {
 func (s *SSRManager) ReportTask() {
 	log.Info("ReportTask start")
 	timer := time.Tick(1 * time.Second)
-	tick := 0
+	var lastReport time.Time
 	for {
 		select {
 		case <-s.Context.Done():
@@ -429,15 +652,12 @@ func (s *SSRManager) ReportTask() {
 			return
 		case <-timer:
 		}
-		if tick%60 == 0 {
+		s.checkExpire()
+		s.flushJournal()
+		if time.Since(lastReport) >= s.ReportInterval {
+			lastReport = time.Now()
 			log.Info("trigger report task")
-			traffic := s.ReportTraffic()
-			log.Info("prepare report traffic data, data length: %v", len(traffic))
-			if len(traffic) > 0 {
-				if err := client.PostAllUserTraffic(traffic); err != nil {
-					logrus.Error(err)
-				}
-			}
+			s.reportBatch()
 			online := s.ReportOnline()
 			log.Info("prepare report online data, data length: %v", len(online))
 			if len(online) > 0 {
@@ -451,7 +671,6 @@ func (s *SSRManager) ReportTask() {
 				logrus.Error(err)
 			}
 		}
-		tick++
 	}
 }
 
@@ -463,6 +682,19 @@ func (s *SSRManager) GetUids() []int {
 	return uids
 }
 
+// parsePorts parse the comma separated ports of single port node
+func parsePorts(port string) ([]int, error) {
+	ports := []int{}
+	for _, item := range strings.Split(port, ",") {
+		convertPort, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("port format error: %s", port))
+		}
+		ports = append(ports, convertPort)
+	}
+	return ports, nil
+}
+
 func (s *SSRManager) Start() error {
 	s.Lock()
 	defer s.Unlock()
@@ -471,14 +703,9 @@ func (s *SSRManager) Start() error {
 	s.cancel = cancel
 	nodeInfo := core.GetApp().NodeInfo()
 	if nodeInfo.Single == 1 {
-		portStrArray := strings.Split(nodeInfo.Port, ",")
-		ports := []int{}
-		for _, item := range portStrArray {
-			convertPort, err := strconv.Atoi(item)
-			if err != nil {
-				panic(fmt.Sprintf("port format error: %s", nodeInfo.Port))
-			}
-			ports = append(ports, convertPort)
+		ports, err := parsePorts(nodeInfo.Port)
+		if err != nil {
+			panic(err.Error())
 		}
 
 		for _, port := range ports {
@@ -514,7 +741,14 @@ func (s *SSRManager) Start() error {
 			return err
 		}
 	}
+	if s.journal == nil {
+		s.journal, _, _ = openTrafficJournal("")
+	}
 	go s.ReportTask()
+	go s.SendTask()
+	if s.SyncInterval > 0 {
+		go s.SyncTask()
+	}
 	return nil
 }
 
@@ -1,6 +1,119 @@
 package service
 
+import (
+	"testing"
+
+	"github.com/ProxyPanel/VNet-SSR/api/client"
+	"github.com/ProxyPanel/VNet-SSR/core"
+	"github.com/ProxyPanel/VNet-SSR/model"
+	"github.com/ProxyPanel/VNet-SSR/proxy/server"
+)
+
 func ExampleS(){
 
 	//Output:
 }
+
+// userListClient is a panel client which only supply user list
+type userListClient struct {
+	client.PanelClient
+	users []*model.UserInfo
+}
+
+func (u *userListClient) GetUserList() ([]*model.UserInfo, error) {
+	return u.users, nil
+}
+
+func TestDiffUsers(t *testing.T) {
+	userTable := map[int]*model.UserInfo{
+		1: {Uid: 1, Port: 1001, Passwd: "a", Enable: 1},
+		2: {Uid: 2, Port: 1002, Passwd: "b", Enable: 1},
+		3: {Uid: 3, Port: 1003, Passwd: "c", Enable: 1},
+	}
+	diff := diffUsers(userTable, []*model.UserInfo{
+		{Uid: 1, Port: 1001, Passwd: "a", Enable: 1},
+		{Uid: 2, Port: 1002, Passwd: "b", Limit: 1024, Enable: 1},
+		{Uid: 3, Port: 1003, Passwd: "c", Enable: 1, Quota: 2048, Used: 1024},
+		{Uid: 4, Port: 1004, Passwd: "d", Enable: 1},
+	})
+	if len(diff.added) != 1 || diff.added[0].Uid != 4 {
+		t.Fatalf("added = %+v", diff.added)
+	}
+	if len(diff.removed) != 0 {
+		t.Fatalf("removed = %+v", diff.removed)
+	}
+	if len(diff.changed) != 1 || diff.changed[0].Uid != 2 {
+		t.Fatalf("changed = %+v", diff.changed)
+	}
+	// traffic used is not a change of user
+	if len(diff.usage) != 1 || diff.usage[0].Uid != 3 {
+		t.Fatalf("usage = %+v", diff.usage)
+	}
+
+	diff = diffUsers(userTable, []*model.UserInfo{
+		{Uid: 1, Port: 1001, Passwd: "a", Enable: 1},
+		{Uid: 2, Port: 1002, Passwd: "b", Enable: 1},
+	})
+	if len(diff.removed) != 1 || diff.removed[0] != 3 || diff.empty() {
+		t.Fatalf("removed = %+v", diff.removed)
+	}
+}
+
+func TestSSRManager_SyncUsers(t *testing.T) {
+	core.GetApp().SetNodeInfo(&model.NodeInfo{Single: 1})
+	defer client.SetPanelClient(client.GetPanelClient())
+	manager := NewShadowsocksrService()
+	ssr := new(server.ShadowsocksRProxy)
+	manager.Shadowsocksrs[443] = ssr
+	kept := &model.UserInfo{Uid: 1, Port: 1, Passwd: "a", Enable: 1}
+	if err := manager.AddUsers([]*model.UserInfo{kept, {Uid: 2, Port: 2, Passwd: "b", Enable: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetPanelClient(&userListClient{users: []*model.UserInfo{
+		{Uid: 1, Port: 1, Passwd: "a", Enable: 1},
+		{Uid: 3, Port: 3, Passwd: "c", Enable: 1},
+	}})
+	if err := manager.SyncUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if manager.userTable[1] != kept {
+		t.Fatal("untouched user should not be applied again")
+	}
+	if manager.userTable[2] != nil || manager.userTable[3] == nil {
+		t.Fatalf("user table after sync = %+v", manager.userTable)
+	}
+	if len(ssr.Users) != 2 {
+		t.Fatalf("single port users after sync = %v", len(ssr.Users))
+	}
+
+	client.SetPanelClient(&userListClient{users: []*model.UserInfo{
+		{Uid: 1, Port: 1, Passwd: "changed", Enable: 1},
+		{Uid: 3, Port: 3, Passwd: "c", Limit: 1024, Enable: 1},
+	}})
+	if err := manager.SyncUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if manager.userTable[1].Passwd != "changed" || manager.userTable[3].Limit != 1024 {
+		t.Fatalf("user table after change = %+v %+v", manager.userTable[1], manager.userTable[3])
+	}
+	for _, passwd := range ssr.Users {
+		if passwd == "a" {
+			t.Fatal("password of single port user is not changed")
+		}
+	}
+
+	// used traffic is updated without add user handles
+	handled := 0
+	manager.RegisterAddUserHandle(func(user *model.UserInfo) { handled++ })
+	client.SetPanelClient(&userListClient{users: []*model.UserInfo{
+		{Uid: 1, Port: 1, Passwd: "changed", Enable: 1, Quota: 4096, Used: 1024},
+		{Uid: 3, Port: 3, Passwd: "c", Limit: 1024, Enable: 1},
+	}})
+	if err := manager.SyncUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if manager.userTable[1].Used != 1024 || manager.quotas[1].quota != 4096 || handled != 0 {
+		t.Fatalf("user after used change = %+v, handled %v", manager.userTable[1], handled)
+	}
+}
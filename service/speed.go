@@ -0,0 +1,47 @@
+package service
+
+import "time"
+
+// speedMeter estimate the speed of user in a report interval, the average speed is
+// the bytes of interval divided by its seconds, the peak speed is the max bytes of one second
+type speedMeter struct {
+	second   int64
+	up       int64
+	down     int64
+	upPeak   int64
+	downPeak int64
+	upSum    int64
+	downSum  int64
+}
+
+func (m *speedMeter) add(now time.Time, up, down int64) {
+	if second := now.Unix(); second != m.second {
+		m.flush()
+		m.second = second
+	}
+	m.up += up
+	m.down += down
+	m.upSum += up
+	m.downSum += down
+}
+
+// flush end the current second and update the peak speed
+func (m *speedMeter) flush() {
+	if m.up > m.upPeak {
+		m.upPeak = m.up
+	}
+	if m.down > m.downPeak {
+		m.downPeak = m.down
+	}
+	m.up, m.down = 0, 0
+}
+
+// speed return the average and peak bytes per second in interval
+func (m *speedMeter) speed(interval time.Duration) (upSpeed, downSpeed, upPeak, downPeak int64) {
+	m.flush()
+	seconds := int64(interval / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return m.upSum / seconds, m.downSum / seconds, m.upPeak, m.downPeak
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProxyPanel/VNet-SSR/model"
+)
+
+func TestSpeedMeter(t *testing.T) {
+	meter := new(speedMeter)
+	start := time.Unix(1000, 0)
+	meter.add(start, 100, 10)
+	meter.add(start.Add(500*time.Millisecond), 200, 10)
+	meter.add(start.Add(time.Second), 50, 40)
+	meter.add(start.Add(3*time.Second), 50, 0)
+	upSpeed, downSpeed, upPeak, downPeak := meter.speed(4 * time.Second)
+	if upSpeed != 100 || downSpeed != 15 {
+		t.Fatalf("average speed = %v %v, want 100 15", upSpeed, downSpeed)
+	}
+	if upPeak != 300 || downPeak != 40 {
+		t.Fatalf("peak speed = %v %v, want 300 40", upPeak, downPeak)
+	}
+}
+
+func TestSSRManager_ReportTraffic(t *testing.T) {
+	manager := NewShadowsocksrService()
+	manager.ReportThreshold = 1000
+	manager.userTable[1] = &model.UserInfo{Uid: 1, Port: 1}
+	manager.userTable[2] = &model.UserInfo{Uid: 2, Port: 2}
+	manager.Upload(1, 600)
+	manager.Download(1, 600)
+	manager.Upload(2, 500)
+
+	traffic := manager.ReportTraffic()
+	if len(traffic) != 1 || traffic[0].Uid != 1 || traffic[0].UpSpeed == 0 || traffic[0].UpPeak != 600 {
+		t.Fatalf("first report = %+v", traffic)
+	}
+	// traffic under threshold is carried over
+	manager.Download(2, 500)
+	traffic = manager.ReportTraffic()
+	if len(traffic) != 1 || traffic[0].Uid != 2 || traffic[0].Upload != 500 || traffic[0].Download != 500 {
+		t.Fatalf("second report = %+v", traffic)
+	}
+	if traffic = manager.ReportTraffic(); len(traffic) != 0 {
+		t.Fatalf("reported traffic is reported again %+v", traffic)
+	}
+}
@@ -67,6 +67,15 @@ func SplitIpFromAddr(addr string) string {
 	return ip
 }
 
+// SplitHostFromAddr return the host of addr, addr itself is returned when it has no port
+func SplitHostFromAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
 func SplitPortFromAddr(addr string) int {
 	_, port, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -31,3 +31,17 @@ func Benchmark_GetNetworkFromAddr(t *testing.B) {
 	t.Log(GetNetworkFromAddr(client))
 	t.ReportAllocs()
 }
+
+func TestSplitHostFromAddr(t *testing.T) {
+	tests := map[string]string{
+		"1.1.1.1:443":     "1.1.1.1",
+		"[::1]:80":        "::1",
+		"example.com:443": "example.com",
+		"1.1.1.1":         "1.1.1.1",
+	}
+	for addr, want := range tests {
+		if host := SplitHostFromAddr(addr); host != want {
+			t.Errorf("SplitHostFromAddr(%v) = %v, want %v", addr, host, want)
+		}
+	}
+}
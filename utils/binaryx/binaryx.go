@@ -60,4 +60,9 @@ func BEUInt32ToBytes(data uint32) []byte{
 	buf := make([]byte, 4)
 	binary.LittleEndian.PutUint32(buf, data)
 	return buf
-}
\ No newline at end of file
+}
+func BEUInt64ToBytes(data uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, data)
+	return buf
+}
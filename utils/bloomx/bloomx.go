@@ -0,0 +1,204 @@
+// Package bloomx implements the bloom filter and a rotating pair of them,
+// which forget the old items after the capacity is reached
+package bloomx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const fileMagic = "VBF1"
+
+// Filter is the classic bloom filter with double hashing
+type Filter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewFilter create the filter which can hold capacity items with false positive rate
+func NewFilter(capacity int, fpRate float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 1e-6
+	}
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Ceil(math.Ln2 * float64(m) / float64(capacity)))
+	if k < 1 {
+		k = 1
+	}
+	m = (m + 63) / 64 * 64
+	return &Filter{
+		bits: make([]uint64, m/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (f *Filter) location(data []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write(data)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// Add put data into the filter
+func (f *Filter) Add(data []byte) {
+	h1, h2 := f.location(data)
+	for i := uint64(0); i < f.k; i++ {
+		loc := (h1 + i*h2) % f.m
+		f.bits[loc/64] |= 1 << (loc % 64)
+	}
+}
+
+// Test return true if data may be in the filter
+func (f *Filter) Test(data []byte) bool {
+	h1, h2 := f.location(data)
+	for i := uint64(0); i < f.k; i++ {
+		loc := (h1 + i*h2) % f.m
+		if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RotatingFilter hold the current and previous filter, when current one is full,
+// it becomes the previous one and a new filter is created, so the items seen in
+// last capacity to twice capacity additions are remembered
+type RotatingFilter struct {
+	sync.Mutex
+	capacity int
+	fpRate   float64
+	count    int
+	current  *Filter
+	previous *Filter
+}
+
+func NewRotatingFilter(capacity int, fpRate float64) *RotatingFilter {
+	return &RotatingFilter{
+		capacity: capacity,
+		fpRate:   fpRate,
+		current:  NewFilter(capacity, fpRate),
+		previous: NewFilter(capacity, fpRate),
+	}
+}
+
+// TestAndAdd return true if data has been seen, otherwise data is added
+func (r *RotatingFilter) TestAndAdd(data []byte) bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.current.Test(data) || r.previous.Test(data) {
+		return true
+	}
+	if r.count >= r.capacity {
+		r.previous = r.current
+		r.current = NewFilter(r.capacity, r.fpRate)
+		r.count = 0
+	}
+	r.current.Add(data)
+	r.count++
+	return false
+}
+
+// WriteTo serialize the filter pair, the format is
+// magic | capacity | fpRate | count | k | m | current bits | previous bits
+func (r *RotatingFilter) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+	header := []uint64{
+		uint64(r.capacity),
+		math.Float64bits(r.fpRate),
+		uint64(r.count),
+		r.current.k,
+		r.current.m,
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(fileMagic); err != nil {
+		return 0, err
+	}
+	for _, item := range [][]uint64{header, r.current.bits, r.previous.bits} {
+		if err := binary.Write(bw, binary.BigEndian, item); err != nil {
+			return 0, err
+		}
+	}
+	n := int64(len(fileMagic) + 8*(len(header)+len(r.current.bits)+len(r.previous.bits)))
+	return n, bw.Flush()
+}
+
+// ReadFrom restore the filter pair written by WriteTo, the capacity and
+// false positive rate must be same as this filter
+func (r *RotatingFilter) ReadFrom(reader io.Reader) (int64, error) {
+	br := bufio.NewReader(reader)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return 0, err
+	}
+	if string(magic) != fileMagic {
+		return 0, errors.New("bloom filter magic mismatch")
+	}
+	header := make([]uint64, 5)
+	if err := binary.Read(br, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if header[0] != uint64(r.capacity) || math.Float64frombits(header[1]) != r.fpRate ||
+		header[3] != r.current.k || header[4] != r.current.m {
+		return 0, errors.Errorf("bloom filter parameter mismatch, capacity: %v fpRate: %v",
+			header[0], math.Float64frombits(header[1]))
+	}
+	current := NewFilter(r.capacity, r.fpRate)
+	previous := NewFilter(r.capacity, r.fpRate)
+	if err := binary.Read(br, binary.BigEndian, current.bits); err != nil {
+		return 0, err
+	}
+	if err := binary.Read(br, binary.BigEndian, previous.bits); err != nil {
+		return 0, err
+	}
+	r.count = int(header[2])
+	r.current = current
+	r.previous = previous
+	return int64(len(fileMagic) + 8*(len(header)+len(current.bits)+len(previous.bits))), nil
+}
+
+// Save write the filter pair into file
+func (r *RotatingFilter) Save(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = r.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load restore the filter pair from file, it is not an error if file not exist
+func (r *RotatingFilter) Load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = r.ReadFrom(file)
+	return err
+}
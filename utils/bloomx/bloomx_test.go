@@ -0,0 +1,88 @@
+package bloomx
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func item(i int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(i))
+	return b
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(10000, 0.001)
+	for i := 0; i < 10000; i++ {
+		f.Add(item(i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !f.Test(item(i)) {
+			t.Fatalf("item %d is not found", i)
+		}
+	}
+	falsePositive := 0
+	for i := 10000; i < 20000; i++ {
+		if f.Test(item(i)) {
+			falsePositive++
+		}
+	}
+	if falsePositive > 50 {
+		t.Fatalf("false positive %d is too many", falsePositive)
+	}
+}
+
+func TestRotatingFilter_TestAndAdd(t *testing.T) {
+	r := NewRotatingFilter(100, 0.0001)
+	for i := 0; i < 150; i++ {
+		if r.TestAndAdd(item(i)) {
+			t.Fatalf("item %d is seen before add", i)
+		}
+	}
+	if !r.TestAndAdd(item(0)) || !r.TestAndAdd(item(149)) {
+		t.Fatal("item in previous or current filter is not seen")
+	}
+	// the third rotation drop the first 100 items
+	for i := 150; i < 250; i++ {
+		r.TestAndAdd(item(i))
+	}
+	if r.TestAndAdd(item(0)) {
+		t.Fatal("item is not forgotten after rotation")
+	}
+}
+
+func TestRotatingFilter_SaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "replay.bloom")
+
+	r := NewRotatingFilter(100, 0.0001)
+	if err := r.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 150; i++ {
+		r.TestAndAdd(item(i))
+	}
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewRotatingFilter(100, 0.0001)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 150; i++ {
+		if !loaded.TestAndAdd(item(i)) {
+			t.Fatalf("item %d is lost after load", i)
+		}
+	}
+	if err := NewRotatingFilter(200, 0.0001).Load(path); err == nil {
+		t.Fatal("load with different capacity should fail")
+	}
+}
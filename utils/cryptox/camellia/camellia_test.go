@@ -0,0 +1,51 @@
+package camellia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// test vectors from RFC 3713
+func TestCamellia(t *testing.T) {
+	tests := []struct {
+		key, plaintext, ciphertext string
+	}{
+		{
+			"0123456789abcdeffedcba9876543210",
+			"0123456789abcdeffedcba9876543210",
+			"67673138549669730857065648eabe43",
+		},
+		{
+			"0123456789abcdeffedcba98765432100011223344556677",
+			"0123456789abcdeffedcba9876543210",
+			"b4993401b3e996f84ee5cee7d79b09b9",
+		},
+		{
+			"0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff",
+			"0123456789abcdeffedcba9876543210",
+			"9acc237dff16d76c20ef7c919e3a7509",
+		},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		plaintext, _ := hex.DecodeString(tt.plaintext)
+		ciphertext, _ := hex.DecodeString(tt.ciphertext)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]byte, BlockSize)
+		c.Encrypt(dst, plaintext)
+		if !bytes.Equal(dst, ciphertext) {
+			t.Errorf("Encrypt() with key %s = %x, want %s", tt.key, dst, tt.ciphertext)
+		}
+		c.Decrypt(dst, ciphertext)
+		if !bytes.Equal(dst, plaintext) {
+			t.Errorf("Decrypt() with key %s = %x, want %s", tt.key, dst, tt.plaintext)
+		}
+	}
+	if _, err := NewCipher(make([]byte, 10)); err == nil {
+		t.Error("NewCipher() with invalid key size want error")
+	}
+}
@@ -0,0 +1,137 @@
+// Package idea implements the IDEA block cipher
+package idea
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"strconv"
+)
+
+// BlockSize is the idea block size in bytes
+const BlockSize = 8
+
+// KeySize is the idea key size in bytes
+const KeySize = 16
+
+const rounds = 8
+
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "idea: invalid key size " + strconv.Itoa(int(k))
+}
+
+type ideaCipher struct {
+	ek [6*rounds + 4]uint16
+	dk [6*rounds + 4]uint16
+}
+
+// NewCipher creates and returns a new cipher.Block, the key must be 16 bytes
+func NewCipher(key []byte) (cipher.Block, error) {
+	if len(key) != KeySize {
+		return nil, KeySizeError(len(key))
+	}
+	c := new(ideaCipher)
+	// every 8 subkeys are taken from the key rotated left by 25 bits
+	hi, lo := binary.BigEndian.Uint64(key), binary.BigEndian.Uint64(key[8:])
+	for i := 0; i < len(c.ek); i += 8 {
+		for j := 0; j < 8 && i+j < len(c.ek); j++ {
+			if j < 4 {
+				c.ek[i+j] = uint16(hi >> (48 - 16*uint(j)))
+			} else {
+				c.ek[i+j] = uint16(lo >> (48 - 16*uint(j-4)))
+			}
+		}
+		hi, lo = hi<<25|lo>>39, lo<<25|hi>>39
+	}
+
+	ek, dk := &c.ek, &c.dk
+	n := 6 * rounds
+	dk[0], dk[1], dk[2], dk[3] = mulInv(ek[n]), -ek[n+1], -ek[n+2], mulInv(ek[n+3])
+	for r := 1; r < rounds; r++ {
+		i, j := 6*r, n-6*r
+		dk[i-2], dk[i-1] = ek[j+4], ek[j+5]
+		dk[i], dk[i+1], dk[i+2], dk[i+3] = mulInv(ek[j]), -ek[j+2], -ek[j+1], mulInv(ek[j+3])
+	}
+	dk[n-2], dk[n-1] = ek[4], ek[5]
+	dk[n], dk[n+1], dk[n+2], dk[n+3] = mulInv(ek[0]), -ek[1], -ek[2], mulInv(ek[3])
+	return c, nil
+}
+
+func (c *ideaCipher) BlockSize() int { return BlockSize }
+
+func (c *ideaCipher) Encrypt(dst, src []byte) {
+	crypt(dst, src, &c.ek)
+}
+
+func (c *ideaCipher) Decrypt(dst, src []byte) {
+	crypt(dst, src, &c.dk)
+}
+
+func crypt(dst, src []byte, k *[6*rounds + 4]uint16) {
+	x1 := binary.BigEndian.Uint16(src)
+	x2 := binary.BigEndian.Uint16(src[2:])
+	x3 := binary.BigEndian.Uint16(src[4:])
+	x4 := binary.BigEndian.Uint16(src[6:])
+	for r := 0; r < rounds; r++ {
+		z := k[6*r : 6*r+6]
+		x1 = mul(x1, z[0])
+		x2 += z[1]
+		x3 += z[2]
+		x4 = mul(x4, z[3])
+		t0 := mul(x1^x3, z[4])
+		t1 := mul(t0+(x2^x4), z[5])
+		t0 += t1
+		x1 ^= t1
+		x4 ^= t0
+		x2, x3 = x3^t1, x2^t0
+	}
+	z := k[6*rounds:]
+	binary.BigEndian.PutUint16(dst, mul(x1, z[0]))
+	binary.BigEndian.PutUint16(dst[2:], x3+z[1])
+	binary.BigEndian.PutUint16(dst[4:], x2+z[2])
+	binary.BigEndian.PutUint16(dst[6:], mul(x4, z[3]))
+}
+
+// mul is multiplication modulo 2^16+1, 0 means 2^16
+func mul(a, b uint16) uint16 {
+	if a == 0 {
+		return 1 - b
+	}
+	if b == 0 {
+		return 1 - a
+	}
+	p := uint32(a) * uint32(b)
+	lo, hi := uint16(p), uint16(p>>16)
+	if lo < hi {
+		return lo - hi + 1
+	}
+	return lo - hi
+}
+
+// mulInv is the multiplicative inverse modulo 2^16+1
+func mulInv(x uint16) uint16 {
+	if x <= 1 {
+		return x
+	}
+	// extended euclid
+	t0, t1 := uint32(1), uint32(0x10001/uint32(x))
+	y := uint16(0x10001 % uint32(x))
+	if y == 1 {
+		return uint16(1 - t1)
+	}
+	for {
+		q := x / y
+		x %= y
+		t0 += uint32(q) * t1
+		if x == 1 {
+			return uint16(t0)
+		}
+		q = y / x
+		y %= x
+		t1 += uint32(q) * t0
+		if y == 1 {
+			return uint16(1 - t1)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package idea
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestIDEA(t *testing.T) {
+	tests := []struct {
+		key, plaintext, ciphertext string
+	}{
+		{"00010002000300040005000600070008", "0000000100020003", "11fbed2b01986de5"},
+		{"2bd6459f82c5b300952c49104881ff48", "0123456789abcdef", "ca247989d6cda399"},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		plaintext, _ := hex.DecodeString(tt.plaintext)
+		ciphertext, _ := hex.DecodeString(tt.ciphertext)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]byte, BlockSize)
+		c.Encrypt(dst, plaintext)
+		if !bytes.Equal(dst, ciphertext) {
+			t.Errorf("Encrypt() with key %s = %x, want %s", tt.key, dst, tt.ciphertext)
+		}
+		c.Decrypt(dst, ciphertext)
+		if !bytes.Equal(dst, plaintext) {
+			t.Errorf("Decrypt() with key %s = %x, want %s", tt.key, dst, tt.plaintext)
+		}
+	}
+}
+
+func TestMulInv(t *testing.T) {
+	for x := 0; x < 0x10000; x++ {
+		if got := mul(uint16(x), mulInv(uint16(x))); got != 1 {
+			t.Fatalf("mul(%v, mulInv(%v)) = %v", x, x, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package seed
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// test vectors from RFC 4269
+func TestSEED(t *testing.T) {
+	tests := []struct {
+		key, plaintext, ciphertext string
+	}{
+		{"00000000000000000000000000000000", "000102030405060708090a0b0c0d0e0f", "5ebac6e0054e166819aff1cc6d346cdb"},
+		{"000102030405060708090a0b0c0d0e0f", "00000000000000000000000000000000", "c11f22f20140505084483597e4370f43"},
+		{"4706480851e61be85d74bfb3fd956185", "83a2f8a288641fb9a4e9a5cc2f131c7d", "ee54d13ebcae706d226bc3142cd40d4a"},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		plaintext, _ := hex.DecodeString(tt.plaintext)
+		ciphertext, _ := hex.DecodeString(tt.ciphertext)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := make([]byte, BlockSize)
+		c.Encrypt(dst, plaintext)
+		if !bytes.Equal(dst, ciphertext) {
+			t.Errorf("Encrypt() with key %s = %x, want %s", tt.key, dst, tt.ciphertext)
+		}
+		c.Decrypt(dst, ciphertext)
+		if !bytes.Equal(dst, plaintext) {
+			t.Errorf("Decrypt() with key %s = %x, want %s", tt.key, dst, tt.plaintext)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package sniffx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// TLSServerName return the server name indication of a tls client hello
+func TLSServerName(data []byte) (string, bool) {
+	// record header(5) + handshake header(4) + version(2) + random(32)
+	if len(data) < 44 || data[0] != 0x16 || data[5] != 0x01 {
+		return "", false
+	}
+	data = data[43:]
+	// session id
+	if len(data) < 1 || len(data) < int(data[0])+1 {
+		return "", false
+	}
+	data = data[int(data[0])+1:]
+	// cipher suites
+	if len(data) < 2 || len(data) < int(binary.BigEndian.Uint16(data))+2 {
+		return "", false
+	}
+	data = data[int(binary.BigEndian.Uint16(data))+2:]
+	// compression methods
+	if len(data) < 1 || len(data) < int(data[0])+1 {
+		return "", false
+	}
+	data = data[int(data[0])+1:]
+	if len(data) < 2 {
+		return "", false
+	}
+	extensions := data[2:]
+	if len(extensions) > int(binary.BigEndian.Uint16(data)) {
+		extensions = extensions[:binary.BigEndian.Uint16(data)]
+	}
+	for len(extensions) >= 4 {
+		extType := binary.BigEndian.Uint16(extensions)
+		extLen := int(binary.BigEndian.Uint16(extensions[2:]))
+		if len(extensions) < extLen+4 {
+			return "", false
+		}
+		ext := extensions[4 : extLen+4]
+		extensions = extensions[extLen+4:]
+		if extType != 0x0000 {
+			continue
+		}
+		// server name list length(2) + name type(1) + name length(2)
+		if len(ext) < 5 || ext[2] != 0x00 {
+			return "", false
+		}
+		nameLen := int(binary.BigEndian.Uint16(ext[3:]))
+		if len(ext) < nameLen+5 {
+			return "", false
+		}
+		return string(ext[5 : nameLen+5]), true
+	}
+	return "", false
+}
+
+// HTTPHost return the Host header of a http request without port
+func HTTPHost(data []byte) (string, bool) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		end = len(data)
+	}
+	lines := strings.Split(string(data[:end]), "\r\n")
+	if len(lines) < 2 || !strings.Contains(lines[0], " HTTP/") {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		pos := strings.Index(line, ":")
+		if pos < 0 || !strings.EqualFold(strings.TrimSpace(line[:pos]), "Host") {
+			continue
+		}
+		host := strings.TrimSpace(line[pos+1:])
+		if pos := strings.LastIndex(host, ":"); pos >= 0 && !strings.HasSuffix(host, "]") {
+			host = host[:pos]
+		}
+		return strings.Trim(host, "[]"), host != ""
+	}
+	return "", false
+}
+
+// sniffed protocols
+const (
+	ProtocolTLS        = "tls"
+	ProtocolHTTP       = "http"
+	ProtocolBitTorrent = "bittorrent"
+)
+
+// Result is the protocol and host sniffed from the first payload, host is empty when
+// protocol has no host
+type Result struct {
+	Protocol string
+	Host     string
+}
+
+// bitTorrentHandshake is the start of bittorrent peer wire handshake
+var bitTorrentHandshake = []byte("\x13BitTorrent protocol")
+
+// dhtQueries are the start of bencoded dht query and response, both start with transaction id or id
+var dhtQueries = [][]byte{[]byte("d1:ad2:id20:"), []byte("d1:rd2:id20:")}
+
+// Sniff detect the protocol of the first payload of tcp or udp
+func Sniff(data []byte, network string) (Result, bool) {
+	if network == "udp" {
+		if isUTP(data) || isDHT(data) {
+			return Result{Protocol: ProtocolBitTorrent}, true
+		}
+		return Result{}, false
+	}
+	if len(data) >= 6 && data[0] == 0x16 && data[5] == 0x01 {
+		host, _ := TLSServerName(data)
+		return Result{Protocol: ProtocolTLS, Host: host}, true
+	}
+	if host, ok := HTTPHost(data); ok {
+		return Result{Protocol: ProtocolHTTP, Host: host}, true
+	}
+	if bytes.HasPrefix(data, bitTorrentHandshake) {
+		return Result{Protocol: ProtocolBitTorrent}, true
+	}
+	return Result{}, false
+}
+
+// utpMaxWindow is the max receive window a sane uTP peer advertises
+const utpMaxWindow = 1 << 24
+
+// isUTP report whether data is the syn packet of uTP, its header is type 4 and version 1,
+// extension, connection id, timestamps, window size and sequence numbers.
+// syn carries no payload and no timestamp difference, so the extensions must end the packet
+func isUTP(data []byte) bool {
+	if len(data) < 20 || data[0] != 0x41 || data[1] > 2 {
+		return false
+	}
+	if binary.BigEndian.Uint32(data[8:]) != 0 {
+		return false
+	}
+	if window := binary.BigEndian.Uint32(data[12:]); window == 0 || window > utpMaxWindow {
+		return false
+	}
+	extension, data := data[1], data[20:]
+	for extension != 0 {
+		if extension > 2 || len(data) < 2 || len(data) < int(data[1])+2 {
+			return false
+		}
+		extension, data = data[0], data[int(data[1])+2:]
+	}
+	return len(data) == 0
+}
+
+func isDHT(data []byte) bool {
+	for _, query := range dhtQueries {
+		if bytes.HasPrefix(data, query) {
+			return true
+		}
+	}
+	return false
+}
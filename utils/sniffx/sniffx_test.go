@@ -0,0 +1,115 @@
+package sniffx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: serverName}).Handshake()
+		client.Close()
+	}()
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestTLSServerName(t *testing.T) {
+	name, ok := TLSServerName(clientHello(t, "www.example.com"))
+	if !ok || name != "www.example.com" {
+		t.Errorf("TLSServerName() = %v, %v", name, ok)
+	}
+	if _, ok := TLSServerName([]byte("GET / HTTP/1.1\r\n\r\n")); ok {
+		t.Error("TLSServerName() of http request want false")
+	}
+	data := clientHello(t, "www.example.com")
+	if _, ok := TLSServerName(data[:60]); ok {
+		t.Error("TLSServerName() of truncated client hello want false")
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	tests := map[string]string{
+		"GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n":                    "www.example.com",
+		"POST /a HTTP/1.1\r\nUser-Agent: curl\r\nhost: example.com:8080\r\n": "example.com",
+		"GET / HTTP/1.1\r\nHost: [::1]:80\r\n\r\n":                           "::1",
+	}
+	for data, want := range tests {
+		if host, ok := HTTPHost([]byte(data)); !ok || host != want {
+			t.Errorf("HTTPHost(%q) = %v, %v", data, host, ok)
+		}
+	}
+	if _, ok := HTTPHost([]byte{0x16, 0x03, 0x01, 0x00, 0x10}); ok {
+		t.Error("HTTPHost() of tls want false")
+	}
+}
+
+func TestSniff(t *testing.T) {
+	utp := make([]byte, 20)
+	utp[0] = 0x41
+	binary.BigEndian.PutUint32(utp[12:], 1<<20)
+	tests := []struct {
+		data    []byte
+		network string
+		want    Result
+	}{
+		{clientHello(t, "www.example.com"), "tcp", Result{Protocol: ProtocolTLS, Host: "www.example.com"}},
+		{[]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), "tcp", Result{Protocol: ProtocolHTTP, Host: "example.com"}},
+		{append([]byte("\x13BitTorrent protocol"), make([]byte, 48)...), "tcp", Result{Protocol: ProtocolBitTorrent}},
+		{utp, "udp", Result{Protocol: ProtocolBitTorrent}},
+		{[]byte("d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:y1:qe"), "udp", Result{Protocol: ProtocolBitTorrent}},
+	}
+	for _, test := range tests {
+		if result, ok := Sniff(test.data, test.network); !ok || result != test.want {
+			t.Errorf("Sniff(%q) = %+v, %v, want %+v", test.data, result, ok, test.want)
+		}
+	}
+	if _, ok := Sniff([]byte("SSH-2.0-OpenSSH_8.0\r\n"), "tcp"); ok {
+		t.Error("Sniff() of ssh want false")
+	}
+	if _, ok := Sniff(utp, "tcp"); ok {
+		t.Error("Sniff() of uTP over tcp want false")
+	}
+}
+
+func TestIsUTP(t *testing.T) {
+	syn := make([]byte, 20)
+	syn[0] = 0x41
+	binary.BigEndian.PutUint32(syn[12:], 1<<20)
+	if !isUTP(syn) {
+		t.Error("isUTP() of syn want true")
+	}
+	// extension bits of 8 bytes
+	ext := append(append([]byte{}, syn...), 0, 8, 0, 0, 0, 0, 0, 0, 0, 0)
+	ext[1] = 2
+	if !isUTP(ext) {
+		t.Error("isUTP() of syn with extension want true")
+	}
+	// dns query of transaction id 0x4100 for example.com
+	dns := append([]byte{0x41, 0x00, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}, "\x07example\x03com\x00\x00\x01\x00\x01"...)
+	// quic short header with connection id starting with 0x01
+	quic := append([]byte{0x41, 0x01}, bytes.Repeat([]byte{0xab}, 38)...)
+	for name, data := range map[string][]byte{
+		"dns":       dns,
+		"quic":      quic,
+		"payload":   append(append([]byte{}, syn...), "data"...),
+		"zero wnd":  append([]byte{0x41}, make([]byte, 19)...),
+		"truncated": ext[:len(ext)-1],
+	} {
+		if isUTP(data) {
+			t.Errorf("isUTP() of %v want false", name)
+		}
+		if _, ok := Sniff(data, "udp"); ok {
+			t.Errorf("Sniff() of %v want false", name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package socksproxy
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// SOCKS reply codes as defined in RFC 1928 section 6.
+const (
+	RepSucceeded           = 0
+	RepGeneralFailure      = 1
+	RepCommandNotSupported = 7
+)
+
+const (
+	socks5Version    = 5
+	methodNoAuth     = 0
+	methodNoAccepted = 0xff
+)
+
+// Handshake fast-tracks SOCKS5 server side initialization, only no auth and CONNECT command is
+// supported, it returns the target address which the client want to connect
+func Handshake(rw io.ReadWriter) (*Socks5Addr, error) {
+	buf := make([]byte, MaxAddrLen)
+	// read VER, NMETHODS
+	if _, err := io.ReadFull(rw, buf[:2]); err != nil {
+		return nil, err
+	}
+	if buf[0] != socks5Version {
+		return nil, errors.Errorf("socks version %v is not supported", buf[0])
+	}
+	nmethods := int(buf[1])
+	// read METHODS
+	if _, err := io.ReadFull(rw, buf[:nmethods]); err != nil {
+		return nil, err
+	}
+	noAuth := false
+	for _, method := range buf[:nmethods] {
+		if method == methodNoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		rw.Write([]byte{socks5Version, methodNoAccepted})
+		return nil, errors.New("socks client has no acceptable auth method")
+	}
+	if _, err := rw.Write([]byte{socks5Version, methodNoAuth}); err != nil {
+		return nil, err
+	}
+	// read VER CMD RSV
+	if _, err := io.ReadFull(rw, buf[:3]); err != nil {
+		return nil, err
+	}
+	cmd := buf[1]
+	addr, err := readAddr(rw, buf)
+	if err != nil {
+		return nil, err
+	}
+	if cmd != CmdConnect {
+		rw.Write(reply(RepCommandNotSupported))
+		return nil, ErrCommandNotSupported
+	}
+	if _, err := rw.Write(reply(RepSucceeded)); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// reply return the socks5 reply with bind address 0.0.0.0:0
+func reply(rep byte) []byte {
+	return []byte{socks5Version, rep, 0, AtypIPv4, 0, 0, 0, 0, 0, 0}
+}